@@ -10,6 +10,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() tk.Position
 }
 
 type Statement interface {
@@ -33,14 +34,30 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+func (p *Program) Pos() tk.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return tk.Position{Line: 1, Column: 1}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
-	for _, stmt := range p.Statements {
-		out.WriteString(stmt.String())
-	}
+	writeStatements(&out, p.Statements)
 	return out.String()
 }
 
+// writeStatements writes statements so that they parse back to themselves.
+// Expression statements need semicolons to be separated from the
+// statements after them.
+func writeStatements(out *bytes.Buffer, stmts []Statement) {
+	for i, s := range stmts {
+		out.WriteString(s.String())
+		if _, ok := s.(*ExpressionStatement); ok && i < len(stmts)-1 {
+			out.WriteString(";")
+		}
+	}
+}
+
 type LetStatement struct {
 	Token tk.Token // LET
 	Name  *Identifier
@@ -51,6 +68,9 @@ func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() tk.Position {
+	return ls.Token.Pos
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -64,14 +84,38 @@ func (ls *LetStatement) String() string {
 }
 
 type Identifier struct {
-	Token tk.Token // IDENT
-	Value string
+	Token   tk.Token // IDENT
+	Value   string
+	Address *Address `json:"-"` // Set by the resolver, nil if unresolved
+}
+
+// Scope tells where the binding of a resolved identifier is.
+type Scope string
+
+const (
+	GlobalScope  Scope = "GLOBAL"  // In the global environment, by name
+	LocalScope   Scope = "LOCAL"   // In a slot of the current function
+	FreeScope    Scope = "FREE"    // In a slot of an enclosing function
+	BuiltinScope Scope = "BUILTIN" // A builtin function
+)
+
+// Address locates the binding of an identifier. Local and free bindings
+// are in the slot Slot of the environment Depth levels out, where 0 is
+// the current function or catch clause. Globals and builtins are looked up by
+// name, and Slot of a builtin is its index in the sorted builtin names.
+type Address struct {
+	Scope Scope
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() tk.Position {
+	return i.Token.Pos
+}
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -85,6 +129,9 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() tk.Position {
+	return rs.Token.Pos
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -105,6 +152,9 @@ func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() tk.Position {
+	return es.Token.Pos
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -121,6 +171,9 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() tk.Position {
+	return il.Token.Pos
+}
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
@@ -135,6 +188,9 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+func (pe *PrefixExpression) Pos() tk.Position {
+	return pe.Token.Pos
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -156,6 +212,9 @@ func (oe *InfixExpression) expressionNode() {}
 func (oe *InfixExpression) TokenLiteral() string {
 	return oe.Token.Literal
 }
+func (oe *InfixExpression) Pos() tk.Position {
+	return oe.Token.Pos
+}
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -174,6 +233,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() tk.Position     { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
@@ -187,18 +247,23 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Pos() tk.Position {
+	return ie.Token.Pos
+}
 
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("if")
+	out.WriteString("if (")
 	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
+	out.WriteString(") {")
 	out.WriteString(ie.Consequence.String())
+	out.WriteString("}")
 
 	if ie.Alternative != nil {
-		out.WriteString("else ")
+		out.WriteString(" else {")
 		out.WriteString(ie.Alternative.String())
+		out.WriteString("}")
 	}
 
 	return out.String()
@@ -213,14 +278,14 @@ func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() tk.Position {
+	return bs.Token.Pos
+}
 
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
-	}
-
+	writeStatements(&out, bs.Statements)
 	return out.String()
 }
 
@@ -228,12 +293,17 @@ type FunctionLiteral struct {
 	Token      tk.Token // The 'fn' token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string   // Set when the function is bound by a let statement
+	Locals     []string `json:"-"` // Set by the resolver: the names of the slots, parameters first
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Pos() tk.Position {
+	return fl.Token.Pos
+}
 func (fl *FunctionLiteral) String() string {
 	params := []string{}
 	for _, p := range fl.Parameters {
@@ -261,6 +331,9 @@ func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Pos() tk.Position {
+	return ce.Token.Pos
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -276,3 +349,214 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+type StringLiteral struct {
+	Token tk.Token // STRING
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode() {}
+func (sl *StringLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+func (sl *StringLiteral) Pos() tk.Position {
+	return sl.Token.Pos
+}
+func (sl *StringLiteral) String() string {
+	return "\"" + sl.Token.Literal + "\""
+}
+
+// MemberExpression accesses a named member of a value, like `e.message`.
+type MemberExpression struct {
+	Token    tk.Token // The '.' token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MemberExpression) Pos() tk.Position {
+	return me.Token.Pos
+}
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type ThrowStatement struct {
+	Token tk.Token // THROW
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *ThrowStatement) Pos() tk.Position {
+	return ts.Token.Pos
+}
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// ImportStatement binds the module at Path to Name, which is the
+// base name of the path, such as `mod` for `import "path/to/mod"`.
+type ImportStatement struct {
+	Token tk.Token // IMPORT
+	Path  *StringLiteral
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *ImportStatement) Pos() tk.Position {
+	return is.Token.Pos
+}
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + is.Path.String() + ";"
+}
+
+// TryExpression has a catch block, a finally block or both.
+type TryExpression struct {
+	Token   tk.Token // The 'try' token
+	Block   *BlockStatement
+	Param   *Identifier // The caught error in the catch block
+	Catch   *BlockStatement
+	Finally *BlockStatement
+
+	// CatchLocals is set by the resolver: the names of the slots of the
+	// catch clause, the parameter first.
+	CatchLocals []string `json:"-"`
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() tk.Position {
+	return te.Token.Pos
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try {")
+	out.WriteString(te.Block.String())
+	out.WriteString("}")
+
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.Param.String())
+		out.WriteString(") {")
+		out.WriteString(te.Catch.String())
+		out.WriteString("}")
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally {")
+		out.WriteString(te.Finally.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    tk.Token // The '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) TokenLiteral() string {
+	return al.Token.Literal
+}
+func (al *ArrayLiteral) Pos() tk.Position {
+	return al.Token.Pos
+}
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token tk.Token // The '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+func (ie *IndexExpression) Pos() tk.Position {
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+type HashLiteral struct {
+	Token tk.Token    // The '{' token
+	Pairs []*HashPair // In source order
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+func (hl *HashLiteral) Pos() tk.Position {
+	return hl.Token.Pos
+}
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
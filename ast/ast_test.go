@@ -10,13 +10,13 @@ func TestString(t *testing.T) {
 	prg := &Program{
 		Statements: []Statement{
 			&LetStatement{
-				Token: tk.Token{tk.LET, "let"},
+				Token: tk.Token{Type: tk.LET, Literal: "let"},
 				Name: &Identifier{
-					Token: tk.Token{tk.IDENT, "myVar"},
+					Token: tk.Token{Type: tk.IDENT, Literal: "myVar"},
 					Value: "myVar",
 				},
 				Value: &Identifier{
-					Token: tk.Token{tk.IDENT, "anotherVar"},
+					Token: tk.Token{Type: tk.IDENT, Literal: "anotherVar"},
 					Value: "anotherVar",
 				},
 			},
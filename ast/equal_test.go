@@ -0,0 +1,44 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+)
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"a + b * c", "a + (b * c)", true},
+		{"(a + b) * c", "a + b * c", false},
+		{"let x = 1;", "let  x  =  1", true},
+		{"let x = 1;", "let y = 1;", false},
+		{"f(1, 2)", "f(\n1,\n2\n)", true},
+		{"f(1, 2)", "f(1)", false},
+		{`"a"`, `"a"`, true},
+		{`"\n"`, `"\t"`, false},
+		{"if (a) { b }", "if (a) { b } else { c }", false},
+		{"let f = fn(x) { x };", "let g = fn(x) { x };", false},
+		{"1", "true", false},
+	}
+
+	for _, tt := range tests {
+		a, b := parse(t, tt.a), parse(t, tt.b)
+		if actual := ast.Equal(a, b); actual != tt.expected {
+			t.Errorf("Equal(%q, %q) = %t, want %t", tt.a, tt.b, actual, tt.expected)
+		}
+	}
+}
+
+func TestEqualNilAndEmptyLists(t *testing.T) {
+	a := &ast.CallExpression{Function: &ast.Identifier{Value: "f"}}
+	b := &ast.CallExpression{Function: &ast.Identifier{Value: "f"}, Arguments: []ast.Expression{}}
+	if !ast.Equal(a, b) {
+		t.Errorf("nil and empty arguments are not equal")
+	}
+	if ast.Equal(a, nil) || !ast.Equal(nil, nil) {
+		t.Errorf("wrong comparison with nil")
+	}
+}
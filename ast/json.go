@@ -0,0 +1,327 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	tk "github.com/ryym/monkey/token"
+)
+
+// The JSON schema of the AST
+//
+// A node is an object whose "kind" is the name of its type, such as
+// "InfixExpression". The other members are the fields of the node in
+// declaration order, named in lower camel case:
+//
+//	{"kind": "PrefixExpression",
+//	 "token": {"type": "-", "literal": "-", "pos": {"line": 1, "column": 1}},
+//	 "operator": "-",
+//	 "right": {"kind": "Identifier", ...}}
+//
+// Child nodes are nested objects, lists of nodes are arrays, and absent
+// optional children are null. A hash pair is an object with "key" and
+// "value" and no kind. Empty lists are [] while nil lists are null, so
+// that decoding gives back exactly the encoded tree. The fields set by
+// the resolver, tagged `json:"-"`, such as the addresses of identifiers,
+// are not part of the schema: they are left out when encoding, and
+// ignored when decoding.
+
+// nodeKinds lists the node types that can be encoded, by kind.
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{},
+		&ThrowStatement{},
+		&ImportStatement{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&Boolean{},
+		&StringLiteral{},
+		&PrefixExpression{},
+		&InfixExpression{},
+		&IfExpression{},
+		&FunctionLiteral{},
+		&CallExpression{},
+		&MemberExpression{},
+		&TryExpression{},
+		&ArrayLiteral{},
+		&IndexExpression{},
+		&HashLiteral{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(tk.Token{})
+)
+
+type jsonToken struct {
+	Type    tk.TokenType `json:"type"`
+	Literal string       `json:"literal"`
+	Pos     jsonPosition `json:"pos"`
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// MarshalJSON encodes a node and its children in the JSON schema of the AST.
+func MarshalJSON(node Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(node)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encodeValue(buf, v.Elem())
+		}
+		return encodeStruct(buf, v.Elem(), v.Type().Implements(nodeType))
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+		return nil
+	case reflect.Struct:
+		if v.Type() != tokenType {
+			return fmt.Errorf("cannot encode %s", v.Type())
+		}
+		tok := v.Interface().(tk.Token)
+		return encodeScalar(buf, jsonToken{tok.Type, tok.Literal, jsonPosition{tok.Pos.Line, tok.Pos.Column}})
+	default:
+		return encodeScalar(buf, v.Interface())
+	}
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value, isNode bool) error {
+	typ := v.Type()
+	buf.WriteString("{")
+	if isNode {
+		if _, ok := nodeKinds[typ.Name()]; !ok {
+			return fmt.Errorf("unknown node type %s", typ.Name())
+		}
+		buf.WriteString(`"kind":`)
+		encodeScalar(buf, typ.Name())
+	}
+	for i, f := range schemaFields(typ) {
+		if isNode || i > 0 {
+			buf.WriteString(",")
+		}
+		encodeScalar(buf, fieldName(f))
+		buf.WriteString(":")
+		if err := encodeValue(buf, v.FieldByIndex(f.Index)); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+func encodeScalar(buf *bytes.Buffer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+// schemaFields returns the fields of a struct that are in the schema.
+func schemaFields(typ reflect.Type) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); !resolved(f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// resolved reports whether a field is set by the resolver.
+func resolved(f reflect.StructField) bool {
+	return f.Tag.Get("json") == "-"
+}
+
+// fieldName returns the JSON name of a field, like "returnValue"
+// for ReturnValue.
+func fieldName(f reflect.StructField) string {
+	return strings.ToLower(f.Name[:1]) + f.Name[1:]
+}
+
+// UnmarshalJSON decodes a node encoded by MarshalJSON.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	v := reflect.New(nodeType).Elem()
+	if err := decodeValue(raw, v, "$"); err != nil {
+		return nil, err
+	}
+	if v.IsNil() {
+		return nil, fmt.Errorf("$: node is null")
+	}
+	return v.Interface().(Node), nil
+}
+
+// decodeValue decodes data into v. The path locates the value in
+// error messages, such as `$.statements[0].value`.
+func decodeValue(data json.RawMessage, v reflect.Value, path string) error {
+	typ := v.Type()
+	isNull := bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+
+	switch {
+	case typ.Kind() == reflect.Interface || typ.Kind() == reflect.Ptr && typ.Implements(nodeType):
+		if isNull {
+			return nil
+		}
+		node, err := decodeNode(data, path)
+		if err != nil {
+			return err
+		}
+		if !node.Type().AssignableTo(typ) {
+			return fmt.Errorf("%s: %s is not allowed here (want %s)", path, node.Elem().Type().Name(), typeName(typ))
+		}
+		v.Set(node)
+		return nil
+
+	case typ.Kind() == reflect.Ptr:
+		if isNull {
+			return nil
+		}
+		elem := reflect.New(typ.Elem())
+		if err := decodeFields(data, elem.Elem(), path, false); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+
+	case typ.Kind() == reflect.Slice:
+		if isNull {
+			return nil
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		slice := reflect.MakeSlice(typ, len(items), len(items))
+		for i, item := range items {
+			if err := decodeValue(item, slice.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+
+	case typ == tokenType:
+		var tok jsonToken
+		if err := json.Unmarshal(data, &tok); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		v.Set(reflect.ValueOf(tk.Token{
+			Type:    tok.Type,
+			Literal: tok.Literal,
+			Pos:     tk.Position{Line: tok.Pos.Line, Column: tok.Pos.Column},
+		}))
+		return nil
+
+	default:
+		if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		return nil
+	}
+}
+
+// decodeNode decodes an object with a kind into a pointer to a new node.
+func decodeNode(data json.RawMessage, path string) (reflect.Value, error) {
+	var header struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return reflect.Value{}, fmt.Errorf("%s: %s", path, err)
+	}
+	typ, ok := nodeKinds[header.Kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%s: unknown node kind %q", path, header.Kind)
+	}
+
+	node := reflect.New(typ)
+	if err := decodeFields(data, node.Elem(), path, true); err != nil {
+		return reflect.Value{}, err
+	}
+	return node, nil
+}
+
+// decodeFields decodes the members of an object into the fields of a struct.
+// All the fields of the schema must be present, and no other members.
+func decodeFields(data json.RawMessage, v reflect.Value, path string, isNode bool) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	if isNode {
+		delete(members, "kind")
+	}
+	// Older encodings have the fields of the resolver, as null.
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); resolved(f) {
+			delete(members, fieldName(f))
+		}
+	}
+
+	for _, f := range schemaFields(typ) {
+		name := fieldName(f)
+		raw, ok := members[name]
+		if !ok {
+			return fmt.Errorf("%s: missing %q", path, name)
+		}
+		delete(members, name)
+		if err := decodeValue(raw, v.FieldByIndex(f.Index), path+"."+name); err != nil {
+			return err
+		}
+	}
+	for name := range members {
+		return fmt.Errorf("%s: unknown member %q", path, name)
+	}
+	return nil
+}
+
+func typeName(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem().Name()
+	}
+	return typ.Name()
+}
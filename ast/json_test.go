@@ -0,0 +1,212 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/resolver"
+	tk "github.com/ryym/monkey/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		``,
+		`let x = 5; return -x;`,
+		`import "lib/mod"; mod.f(1, "two", true)`,
+		`let add = fn(a, b) { return a + b; }; add(1, 2 * 3)`,
+		`fn() {}; f()`,
+		`if (a < b) { a } else { b }; if (x) { y }`,
+		`let h = {"k": [1, !false], 2: {}}; h["k"][0]`,
+		`try { throw "x" } catch (e) { e.message } finally { 0 }; try { 1 } finally { 2 }`,
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		data, err := ast.MarshalJSON(program)
+		if err != nil {
+			t.Fatalf("%q: marshal error: %s", input, err)
+		}
+		decoded, err := ast.UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("%q: unmarshal error: %s", input, err)
+		}
+		if !reflect.DeepEqual(decoded, program) {
+			t.Errorf("%q: round trip changed the tree.\nwant=%#v\ngot= %#v", input, program, decoded)
+		}
+	}
+}
+
+func TestJSONEncodesAllNodeTypes(t *testing.T) {
+	program := parse(t, `
+import "lib/mod";
+let add = fn(a, b) { return a + b; };
+let h = {"k": [1, true]};
+if (!h["k"][1]) { add(1, 2) } else { mod.x };
+try { throw "x" } catch (e) { e.message } finally { 0 };
+`)
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	for _, typ := range nodeTypes(t) {
+		kind := strings.TrimPrefix(typ, "*ast.")
+		if !strings.Contains(string(data), `"kind":"`+kind+`"`) {
+			t.Errorf("%s is not encoded", kind)
+		}
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := ast.MarshalJSON(parse(t, "-x"))
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	expected := `{"kind":"Program","statements":[` +
+		`{"kind":"ExpressionStatement",` +
+		`"token":{"type":"-","literal":"-","pos":{"line":1,"column":1}},` +
+		`"expression":{"kind":"PrefixExpression",` +
+		`"token":{"type":"-","literal":"-","pos":{"line":1,"column":1}},` +
+		`"operator":"-",` +
+		`"right":{"kind":"Identifier",` +
+		`"token":{"type":"IDENT","literal":"x","pos":{"line":1,"column":2}},` +
+		`"value":"x"}}}]}`
+	if string(data) != expected {
+		t.Errorf("wrong encoding.\nwant=%s\ngot= %s", expected, data)
+	}
+	if !json.Valid(data) {
+		t.Errorf("invalid JSON: %s", data)
+	}
+}
+
+func TestJSONKeepsNilAndEmptyLists(t *testing.T) {
+	tests := []*ast.CallExpression{
+		{Function: &ast.Identifier{Value: "f"}},
+		{Function: &ast.Identifier{Value: "f"}, Arguments: []ast.Expression{}},
+	}
+
+	for _, call := range tests {
+		data, err := ast.MarshalJSON(call)
+		if err != nil {
+			t.Fatalf("marshal error: %s", err)
+		}
+		decoded, err := ast.UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("unmarshal error: %s", err)
+		}
+		if !reflect.DeepEqual(decoded, call) {
+			t.Errorf("round trip changed the tree.\nwant=%#v\ngot= %#v", call, decoded)
+		}
+	}
+}
+
+func TestJSONLeavesOutResolverFields(t *testing.T) {
+	program := parse(t, `let f = fn(x) { x }; try { f(1) } catch (e) { e }`)
+	before, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	if diags := resolver.Resolve(program, resolver.NewGlobalTable(nil, nil)); len(diags) > 0 {
+		t.Fatalf("resolve errors: %v", diags)
+	}
+	after, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("resolving changed the encoding.\nbefore=%s\nafter= %s", before, after)
+	}
+	for _, name := range []string{"address", "locals", "catchLocals"} {
+		if strings.Contains(string(after), `"`+name+`"`) {
+			t.Errorf("%s is encoded: %s", name, after)
+		}
+	}
+}
+
+func TestUnmarshalJSONWithoutResolverFields(t *testing.T) {
+	tok := func(typ, literal string, col int) string {
+		return fmt.Sprintf(`{"type":%q,"literal":%q,"pos":{"line":1,"column":%d}}`, typ, literal, col)
+	}
+	// fn(x) { x }, as encoded before the resolver had fields in the tree,
+	// and with the address that encodings had for a while.
+	for _, address := range []string{``, `,"address":null`} {
+		ident := func(col int) string {
+			return `{"kind":"Identifier","token":` + tok("IDENT", "x", col) + `,"value":"x"` + address + `}`
+		}
+		data := `{"kind":"Program","statements":[{"kind":"ExpressionStatement","token":` + tok("FUNCTION", "fn", 1) + `,` +
+			`"expression":{"kind":"FunctionLiteral","token":` + tok("FUNCTION", "fn", 1) + `,` +
+			`"parameters":[` + ident(4) + `],` +
+			`"body":{"kind":"BlockStatement","token":` + tok("{", "{", 7) + `,` +
+			`"statements":[{"kind":"ExpressionStatement","token":` + tok("IDENT", "x", 9) + `,"expression":` + ident(9) + `}]},` +
+			`"name":""}}]}`
+		decoded, err := ast.UnmarshalJSON([]byte(data))
+		if err != nil {
+			t.Fatalf("%q: unmarshal error: %s", address, err)
+		}
+		if want := parse(t, `fn(x) { x }`); !reflect.DeepEqual(decoded, want) {
+			t.Errorf("%q: wrong tree.\nwant=%#v\ngot= %#v", address, want, decoded)
+		}
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	token := `{"type":"IDENT","literal":"x","pos":{"line":1,"column":1}}`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`null`, "$: node is null"},
+		{`{"kind":"Nope"}`, `$: unknown node kind "Nope"`},
+		{`{"kind":"Identifier","token":` + token + `}`, `$: missing "value"`},
+		{
+			`{"kind":"Identifier","token":` + token + `,"value":"x","extra":1}`,
+			`$: unknown member "extra"`,
+		},
+		{
+			`{"kind":"Identifier","token":` + token + `,"value":1}`,
+			"$.value: json: cannot unmarshal number into Go value of type string",
+		},
+		{
+			`{"kind":"Program","statements":[{"kind":"Identifier","token":` + token + `,"value":"x"}]}`,
+			"$.statements[0]: Identifier is not allowed here (want Statement)",
+		},
+		{
+			`{"kind":"LetStatement","token":` + token + `,` +
+				`"name":{"kind":"IntegerLiteral","token":` + token + `,"value":1},"value":null}`,
+			"$.name: IntegerLiteral is not allowed here (want Identifier)",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.UnmarshalJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%s: no error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error.\nwant=%q\ngot= %q", tt.expected, err)
+		}
+	}
+}
+
+func TestMarshalJSONPositions(t *testing.T) {
+	program := parse(t, "let a = 1;\n  a")
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	decoded, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	pos := decoded.(*ast.Program).Statements[1].Pos()
+	if pos != (tk.Position{Line: 2, Column: 3}) {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+}
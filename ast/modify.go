@@ -0,0 +1,135 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the node to put in place of the given one.
+// It can return the node itself to leave it as it is.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites an AST in post-order: the children of a node are
+// modified first and assigned back into it, then the node itself is
+// passed to the modifier and replaced by the result.
+//
+// Nodes are updated in place, so a node whose children are replaced keeps
+// its own token and position. A replacement must fit the slot it goes
+// into; for instance, the name of a let statement can only be replaced
+// by an *Identifier. Modify panics otherwise.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		for i, stmt := range n.Statements {
+			n.Statements[i] = modifyStatement(stmt, modifier)
+		}
+	case *BlockStatement:
+		for i, stmt := range n.Statements {
+			n.Statements[i] = modifyStatement(stmt, modifier)
+		}
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		if n.Value != nil {
+			n.Value = modifyExpression(n.Value, modifier)
+		}
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			n.Expression = modifyExpression(n.Expression, modifier)
+		}
+	case *ThrowStatement:
+		if n.Value != nil {
+			n.Value = modifyExpression(n.Value, modifier)
+		}
+	case *ImportStatement:
+		modified := Modify(n.Path, modifier)
+		path, ok := modified.(*StringLiteral)
+		if !ok {
+			panic(fmt.Sprintf("ast.Modify: import path replaced by %T", modified))
+		}
+		n.Path = path
+		n.Name = modifyIdentifier(n.Name, modifier)
+
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		if n.Alternative != nil {
+			n.Alternative = modifyBlock(n.Alternative, modifier)
+		}
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			n.Parameters[i] = modifyIdentifier(p, modifier)
+		}
+		n.Body = modifyBlock(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		for i, arg := range n.Arguments {
+			n.Arguments[i] = modifyExpression(arg, modifier)
+		}
+	case *MemberExpression:
+		n.Object = modifyExpression(n.Object, modifier)
+		n.Property = modifyIdentifier(n.Property, modifier)
+	case *TryExpression:
+		n.Block = modifyBlock(n.Block, modifier)
+		if n.Catch != nil {
+			n.Param = modifyIdentifier(n.Param, modifier)
+			n.Catch = modifyBlock(n.Catch, modifier)
+		}
+		if n.Finally != nil {
+			n.Finally = modifyBlock(n.Finally, modifier)
+		}
+	case *ArrayLiteral:
+		for i, el := range n.Elements {
+			n.Elements[i] = modifyExpression(el, modifier)
+		}
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			pair.Key = modifyExpression(pair.Key, modifier)
+			pair.Value = modifyExpression(pair.Value, modifier)
+		}
+	}
+
+	return modifier(node)
+}
+
+func modifyStatement(stmt Statement, modifier ModifierFunc) Statement {
+	modified, ok := Modify(stmt, modifier).(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: statement %T replaced by a non-statement", stmt))
+	}
+	return modified
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	modified, ok := Modify(exp, modifier).(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: expression %T replaced by a non-expression", exp))
+	}
+	return modified
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	modified := Modify(ident, modifier)
+	result, ok := modified.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: identifier %s replaced by %T", ident.Value, modified))
+	}
+	return result
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	modified := Modify(block, modifier)
+	result, ok := modified.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: block replaced by %T", modified))
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	tk "github.com/ryym/monkey/token"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	x := func() *Identifier { return &Identifier{Value: "x"} }
+	block := func(exp Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: exp}}}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+		},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two())},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: x(), Value: one()}, &LetStatement{Name: x(), Value: two()}},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{x()}, Body: block(one())},
+			&FunctionLiteral{Parameters: []*Identifier{x()}, Body: block(two())},
+		},
+		{
+			&CallExpression{Function: x(), Arguments: []Expression{one(), two(), one()}},
+			&CallExpression{Function: x(), Arguments: []Expression{two(), two(), two()}},
+		},
+		{&ThrowStatement{Value: one()}, &ThrowStatement{Value: two()}},
+		{
+			&MemberExpression{Object: &ArrayLiteral{Elements: []Expression{one()}}, Property: x()},
+			&MemberExpression{Object: &ArrayLiteral{Elements: []Expression{two()}}, Property: x()},
+		},
+		{
+			&TryExpression{Block: block(one()), Param: x(), Catch: block(one()), Finally: block(one())},
+			&TryExpression{Block: block(two()), Param: x(), Catch: block(two()), Finally: block(two())},
+		},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{
+			&HashLiteral{Pairs: []*HashPair{{Key: one(), Value: one()}, {Key: x(), Value: one()}}},
+			&HashLiteral{Pairs: []*HashPair{{Key: two(), Value: two()}, {Key: x(), Value: two()}}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal.\nwant=%#v\ngot= %#v", tt.expected, modified)
+		}
+	}
+}
+
+func TestModifyIsPostOrder(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &InfixExpression{
+			Left:     &Identifier{Value: "a"},
+			Operator: "+",
+			Right:    &PrefixExpression{Operator: "-", Right: &Identifier{Value: "b"}},
+		}},
+	}}
+
+	visited := []string{}
+	Modify(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier:
+			visited = append(visited, node.Value)
+		default:
+			visited = append(visited, reflect.TypeOf(node).Elem().Name())
+		}
+		return node
+	})
+
+	expected := []string{"a", "b", "PrefixExpression", "InfixExpression", "ExpressionStatement", "Program"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong order.\nwant=%q\ngot= %q", expected, visited)
+	}
+}
+
+func TestModifyKeepsPositions(t *testing.T) {
+	pos := func(line, col int) tk.Token {
+		return tk.Token{Pos: tk.Position{Line: line, Column: col}}
+	}
+	infix := &InfixExpression{
+		Token:    pos(1, 3),
+		Left:     &Identifier{Token: pos(1, 1), Value: "a"},
+		Operator: "+",
+		Right:    &Identifier{Token: pos(1, 5), Value: "b"},
+	}
+
+	// Replace identifiers with new nodes at positions of their own.
+	modified := Modify(infix, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok {
+			return &IntegerLiteral{Token: pos(9, 9), Value: int64(len(ident.Value))}
+		}
+		return node
+	})
+
+	if modified != infix {
+		t.Fatalf("parent node replaced. got=%#v", modified)
+	}
+	if infix.Pos() != (tk.Position{Line: 1, Column: 3}) {
+		t.Errorf("position of parent changed. got=%s", infix.Pos())
+	}
+	if infix.Left.Pos() != (tk.Position{Line: 9, Column: 9}) {
+		t.Errorf("position of replacement changed. got=%s", infix.Left.Pos())
+	}
+}
+
+func TestModifyPanicsOnMismatchedReplacement(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "ast.Modify: identifier x replaced by *ast.IntegerLiteral" {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	let := &LetStatement{Name: &Identifier{Value: "x"}, Value: &IntegerLiteral{Value: 1}}
+	Modify(let, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return &IntegerLiteral{Value: 0}
+		}
+		return node
+	})
+}
@@ -0,0 +1,334 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// edge is a child of a node, labelled with the field it belongs to.
+type edge struct {
+	label string
+	node  Node
+}
+
+// edges returns the children of a node in the order Walk visits them,
+// which leaves out absent optional children.
+func edges(node Node) []edge {
+	labels := fieldLabels(node)
+	es := []edge{}
+	Inspect(node, func(n Node) bool {
+		if n == node {
+			return true
+		}
+		if n != nil {
+			es = append(es, edge{labels[n], n})
+		}
+		return false
+	})
+	return es
+}
+
+// renamedFields are the fields labelled otherwise than by their JSON names.
+var renamedFields = map[string]string{"ReturnValue": "value"}
+
+// fieldLabels maps the children of a node to the fields holding them,
+// named like `left`, `statements[0]` or `pairs[1].key`.
+func fieldLabels(node Node) map[Node]string {
+	labels := make(map[Node]string)
+	var collect func(label string, v reflect.Value)
+	collect = func(label string, v reflect.Value) {
+		if v.Type().Implements(nodeType) {
+			if !v.IsNil() {
+				labels[v.Interface().(Node)] = label
+			}
+			return
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				collect(fmt.Sprintf("%s[%d]", label, i), v.Index(i))
+			}
+		case reflect.Ptr:
+			if !v.IsNil() {
+				collect(label, v.Elem())
+			}
+		case reflect.Struct:
+			if v.Type() == tokenType {
+				return
+			}
+			for i := 0; i < v.NumField(); i++ {
+				collect(label+"."+fieldLabel(v.Type().Field(i)), v.Field(i))
+			}
+		}
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		collect(fieldLabel(v.Type().Field(i)), v.Field(i))
+	}
+	return labels
+}
+
+func fieldLabel(f reflect.StructField) string {
+	if label, ok := renamedFields[f.Name]; ok {
+		return label
+	}
+	return fieldName(f)
+}
+
+// DOT returns the tree of a node as a Graphviz graph, with one graph node
+// per AST node and edges labelled with the fields of the parents:
+//
+//	digraph AST {
+//		node [shape=box];
+//		n0 [label="InfixExpression +"];
+//		n1 [label="Identifier a"];
+//		n0 -> n1 [label="left"];
+//		...
+//	}
+func DOT(node Node) string {
+	var out strings.Builder
+	out.WriteString("digraph AST {\n\tnode [shape=box];\n")
+
+	id := 0
+	var visit func(n Node) int
+	visit = func(n Node) int {
+		self := id
+		id++
+		fmt.Fprintf(&out, "\tn%d [label=%s];\n", self, dotString(dotLabel(n)))
+		for _, e := range edges(n) {
+			child := visit(e.node)
+			fmt.Fprintf(&out, "\tn%d -> n%d [label=%s];\n", self, child, dotString(e.label))
+		}
+		return self
+	}
+	visit(node)
+
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// Tree returns the tree of a node as an outline, with one node per line
+// and the children indented under their parents, labelled like in DOT:
+//
+//	InfixExpression +
+//	  left: Identifier a
+//	  right: IntegerLiteral 1
+func Tree(node Node) string {
+	var out strings.Builder
+	var visit func(label string, n Node, depth int)
+	visit = func(label string, n Node, depth int) {
+		out.WriteString(strings.Repeat("  ", depth))
+		if label != "" {
+			out.WriteString(label + ": ")
+		}
+		out.WriteString(dotLabel(n) + "\n")
+		for _, e := range edges(n) {
+			visit(e.label, e.node, depth+1)
+		}
+	}
+	visit("", node, 0)
+	return out.String()
+}
+
+// dotLabel returns the kind of a node followed by its value, if any.
+func dotLabel(node Node) string {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	switch n := node.(type) {
+	case *Identifier:
+		return kind + " " + n.Value
+	case *IntegerLiteral:
+		return kind + " " + strconv.FormatInt(n.Value, 10)
+	case *Boolean:
+		return kind + " " + strconv.FormatBool(n.Value)
+	case *StringLiteral:
+		return kind + " " + strconv.Quote(n.Value)
+	case *PrefixExpression:
+		return kind + " " + n.Operator
+	case *InfixExpression:
+		return kind + " " + n.Operator
+	}
+	return kind
+}
+
+// dotString quotes s as a DOT string.
+func dotString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// sexpWidth is the width below which a list is printed on one line.
+const sexpWidth = 60
+
+// Sexp returns the tree of a node as an S-expression, such as
+// `(let x (+ 1 (* 2 3)))`. Lists too long for a line are broken with
+// one child per line, indented by two spaces. Expression statements are
+// shown as their expressions.
+func Sexp(node Node) string {
+	var w sexpWriter
+	toSexp(node).write(&w)
+	w.WriteString("\n")
+	return w.out.String()
+}
+
+// sexp is an atom, or a list whose first `head` elements stay on the
+// line of its opening parenthesis when the list is broken.
+type sexp struct {
+	atom string
+	list []sexp
+	head int
+}
+
+func atom(s string) sexp { return sexp{atom: s} }
+
+func list(head int, items ...sexp) sexp { return sexp{list: items, head: head} }
+
+// sexpForms are the heads of the lists of nodes, and how many elements
+// stay on the first line when a list is broken. Other nodes are listed
+// under the name of their type.
+var sexpForms = map[string]struct {
+	name string
+	head int
+}{
+	"Program":          {"program", 1},
+	"BlockStatement":   {"block", 1},
+	"LetStatement":     {"let", 2},
+	"ReturnStatement":  {"return", 1},
+	"ThrowStatement":   {"throw", 1},
+	"ImportStatement":  {"import", 3},
+	"IfExpression":     {"if", 2},
+	"CallExpression":   {"call", 2},
+	"MemberExpression": {".", 1},
+	"ArrayLiteral":     {"array", 1},
+	"IndexExpression":  {"index", 1},
+}
+
+func toSexp(node Node) sexp {
+	switch n := node.(type) {
+	case nil:
+		return atom("nil")
+	case *ExpressionStatement:
+		return toSexp(n.Expression)
+	case *Identifier:
+		return atom(n.Value)
+	case *IntegerLiteral:
+		return atom(strconv.FormatInt(n.Value, 10))
+	case *Boolean:
+		return atom(strconv.FormatBool(n.Value))
+	case *StringLiteral:
+		return atom(strconv.Quote(n.Value))
+
+	// Forms grouping some of the children
+	case *FunctionLiteral:
+		params := []sexp{}
+		for _, p := range n.Parameters {
+			params = append(params, toSexp(p))
+		}
+		return list(2, atom("fn"), list(len(params), params...), toSexp(n.Body))
+	case *TryExpression:
+		items := []sexp{atom("try"), toSexp(n.Block)}
+		if n.Catch != nil {
+			items = append(items, list(2, atom("catch"), toSexp(n.Param), toSexp(n.Catch)))
+		}
+		if n.Finally != nil {
+			items = append(items, list(1, atom("finally"), toSexp(n.Finally)))
+		}
+		return list(1, items...)
+	case *HashLiteral:
+		items := []sexp{atom("hash")}
+		for _, pair := range n.Pairs {
+			items = append(items, list(1, toSexp(pair.Key), toSexp(pair.Value)))
+		}
+		return list(1, items...)
+	}
+
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	form, ok := sexpForms[kind]
+	switch n := node.(type) {
+	case *PrefixExpression:
+		form.name, form.head = n.Operator, 1
+	case *InfixExpression:
+		form.name, form.head = n.Operator, 1
+	default:
+		if !ok {
+			form.name, form.head = kind, 1
+		}
+	}
+	items := []sexp{atom(form.name)}
+	for _, e := range edges(node) {
+		items = append(items, toSexp(e.node))
+	}
+	return list(form.head, items...)
+}
+
+// flat returns the expression on one line.
+func (s sexp) flat() string {
+	if s.list == nil {
+		return s.atom
+	}
+	items := make([]string, len(s.list))
+	for i, item := range s.list {
+		items[i] = item.flat()
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
+// width returns the length of the expression on one line, but stops
+// counting once it is over max.
+func (s sexp) width(max int) int {
+	if s.list == nil {
+		return len(s.atom)
+	}
+	n := 2 // The parentheses
+	for i, item := range s.list {
+		if n > max {
+			break
+		}
+		if i > 0 {
+			n++
+		}
+		n += item.width(max - n)
+	}
+	return n
+}
+
+// sexpWriter writes expressions, keeping the column where the next
+// write starts.
+type sexpWriter struct {
+	out    strings.Builder
+	column int
+}
+
+func (w *sexpWriter) WriteString(s string) {
+	w.out.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		w.column = len(s) - i - 1
+	} else {
+		w.column += len(s)
+	}
+}
+
+// write prints the expression at the end of out.
+func (s sexp) write(out *sexpWriter) {
+	column := out.column
+	if s.list == nil || s.width(sexpWidth-column) <= sexpWidth-column {
+		out.WriteString(s.flat())
+		return
+	}
+
+	out.WriteString("(")
+	indent := strings.Repeat(" ", column+2)
+	for i, item := range s.list {
+		switch {
+		case i == 0:
+		case i < s.head:
+			out.WriteString(" ")
+		default:
+			out.WriteString("\n" + indent)
+		}
+		item.write(out)
+	}
+	out.WriteString(")")
+}
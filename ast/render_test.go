@@ -0,0 +1,156 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+)
+
+func TestDOT(t *testing.T) {
+	actual := ast.DOT(parse(t, `if (a < 1) { "x\"y" }`))
+
+	expected := `digraph AST {
+	node [shape=box];
+	n0 [label="Program"];
+	n1 [label="ExpressionStatement"];
+	n2 [label="IfExpression"];
+	n3 [label="InfixExpression <"];
+	n4 [label="Identifier a"];
+	n3 -> n4 [label="left"];
+	n5 [label="IntegerLiteral 1"];
+	n3 -> n5 [label="right"];
+	n2 -> n3 [label="condition"];
+	n6 [label="BlockStatement"];
+	n7 [label="ExpressionStatement"];
+	n8 [label="StringLiteral \"x\\\"y\""];
+	n7 -> n8 [label="expression"];
+	n6 -> n7 [label="statements[0]"];
+	n2 -> n6 [label="consequence"];
+	n1 -> n2 [label="expression"];
+	n0 -> n1 [label="statements[0]"];
+}
+`
+	if actual != expected {
+		t.Errorf("wrong graph.\nwant=%s\ngot= %s", expected, actual)
+	}
+}
+
+func TestTree(t *testing.T) {
+	actual := ast.Tree(parse(t, `let x = f(-1, "a");`))
+
+	expected := `Program
+  statements[0]: LetStatement
+    name: Identifier x
+    value: CallExpression
+      function: Identifier f
+      arguments[0]: PrefixExpression -
+        right: IntegerLiteral 1
+      arguments[1]: StringLiteral "a"
+`
+	if actual != expected {
+		t.Errorf("wrong tree.\nwant=%s\ngot= %s", expected, actual)
+	}
+}
+
+func TestDOTHasNodePerASTNode(t *testing.T) {
+	program := parse(t, allNodeTypes)
+	count := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			count++
+		}
+		return true
+	})
+
+	graph := ast.DOT(program)
+	nodes := strings.Count(graph, " [label=") - strings.Count(graph, " -> ")
+	if nodes != count {
+		t.Errorf("wrong number of graph nodes. want=%d, got=%d", count, nodes)
+	}
+	if edges := strings.Count(graph, " -> "); edges != count-1 {
+		t.Errorf("wrong number of edges. want=%d, got=%d", count-1, edges)
+	}
+}
+
+// TestRenderAllNodeTypes checks that the edges to every type of node are
+// labelled, and that no node is listed under the name of its type, as
+// one missing from sexpForms would be.
+func TestRenderAllNodeTypes(t *testing.T) {
+	program := parse(t, allNodeTypes)
+	if graph := ast.DOT(program); strings.Contains(graph, `[label=""]`) {
+		t.Errorf("an edge has no label:\n%s", graph)
+	}
+	sexp := ast.Sexp(program)
+	for _, typ := range nodeTypes(t) {
+		if name := strings.TrimPrefix(typ, "*ast."); strings.Contains(sexp, name) {
+			t.Errorf("%s has no form:\n%s", name, sexp)
+		}
+	}
+}
+
+func TestSexp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "(program (+ 1 (* 2 3)))"},
+		{"(1 + 2) * 3", "(program (* (+ 1 2) 3))"},
+		{"-a[0]", "(program (- (index a 0)))"},
+		{"let x = f(1, true).y;", `(program (let x (. (call f 1 true) y)))`},
+		{`import "lib/m"; return 1;`, `(program (import "lib/m" m) (return 1))`},
+		{`fn() {}; [1, "a"]`, `(program (fn () (block)) (array 1 "a"))`},
+		{`{"a": 1}`, `(program (hash ("a" 1)))`},
+		{"if (x) { 1 }", "(program (if x (block 1)))"},
+		{"try { throw 1 } finally { 2 }", "(program (try (block (throw 1)) (finally (block 2))))"},
+		{
+			"let f = fn(a, b) { if (a > b) { return a; } else { return b; } };",
+			`(program
+  (let f
+    (fn (a b)
+      (block
+        (if (> a b) (block (return a)) (block (return b)))))))`,
+		},
+		{
+			`try { f(1) } catch (err) { puts("failed:", err.message) }`,
+			`(program
+  (try
+    (block (call f 1))
+    (catch err
+      (block (call puts "failed:" (. err message))))))`,
+		},
+	}
+
+	for _, tt := range tests {
+		actual := ast.Sexp(parse(t, tt.input))
+		if actual != tt.expected+"\n" {
+			t.Errorf("%q: wrong output.\nwant=%s\ngot= %s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSexpBreaksLongLists(t *testing.T) {
+	args := []string{}
+	for i := 0; i < 30; i++ {
+		args = append(args, fmt.Sprint(i))
+	}
+	actual := ast.Sexp(parse(t, "f("+strings.Join(args, ", ")+")"))
+
+	expected := "(program\n  (call f\n    " + strings.Join(args, "\n    ") + "))\n"
+	if actual != expected {
+		t.Errorf("wrong output.\nwant=%s\ngot= %s", expected, actual)
+	}
+}
+
+func BenchmarkSexp(b *testing.B) {
+	var src strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&src, "let f = fn(a, b) { if (a < b) { [a, b * %d, {\"k\": a}] } else { f(b, a) } };\n", i)
+	}
+	program := parse(b, src.String())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ast.Sexp(program)
+	}
+}
@@ -0,0 +1,190 @@
+package ast_test
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+)
+
+func parse(t testing.TB, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	return program
+}
+
+// nodeTypes lists the types in ast.go that implement ast.Node,
+// so that a node added to the package cannot be missed by Walk.
+func nodeTypes(t *testing.T) []string {
+	t.Helper()
+	f, err := goparser.ParseFile(token.NewFileSet(), "ast.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := []string{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != "Pos" {
+			continue
+		}
+		star, ok := fn.Recv.List[0].Type.(*goast.StarExpr)
+		if !ok {
+			continue
+		}
+		types = append(types, "*ast."+star.X.(*goast.Ident).Name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// allNodeTypes is a program with a node of every type.
+const allNodeTypes = `
+import "lib/mod";
+let add = fn(a, b) { return a + b; };
+let h = {"k": [1, true]};
+if (!h["k"][1]) { add(1, 2) } else { mod.x };
+try { throw "x" } catch (e) { e.message } finally { 0 };
+`
+
+func TestInspectVisitsAllNodeTypes(t *testing.T) {
+	program := parse(t, allNodeTypes)
+
+	visited := make(map[string]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			visited[fmt.Sprintf("%T", node)] = true
+		}
+		return true
+	})
+
+	types := nodeTypes(t)
+	if len(types) == 0 {
+		t.Fatal("no node types found in ast.go")
+	}
+	for _, typ := range types {
+		if !visited[typ] {
+			t.Errorf("%s is not visited", typ)
+		}
+	}
+}
+
+func TestInspectOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`if (a) { b } else { c }`,
+			[]string{
+				"Program", "ExpressionStatement", "IfExpression", "Identifier a",
+				"BlockStatement", "ExpressionStatement", "Identifier b",
+				"BlockStatement", "ExpressionStatement", "Identifier c",
+			},
+		},
+		{
+			`fn(x, y) { x }`,
+			[]string{
+				"Program", "ExpressionStatement", "FunctionLiteral",
+				"Identifier x", "Identifier y",
+				"BlockStatement", "ExpressionStatement", "Identifier x",
+			},
+		},
+		{
+			`f(1, g(2))`,
+			[]string{
+				"Program", "ExpressionStatement", "CallExpression", "Identifier f",
+				"IntegerLiteral 1", "CallExpression", "Identifier g", "IntegerLiteral 2",
+			},
+		},
+		{
+			`let x = {"a": -1}`,
+			[]string{
+				"Program", "LetStatement", "Identifier x", "HashLiteral",
+				`StringLiteral "a"`, "PrefixExpression", "IntegerLiteral 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		visited := []string{}
+		ast.Inspect(parse(t, tt.input), func(node ast.Node) bool {
+			if node == nil {
+				return false
+			}
+			name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+			switch node.(type) {
+			case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral:
+				name += " " + node.String()
+			}
+			visited = append(visited, name)
+			return true
+		})
+
+		if strings.Join(visited, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: wrong order.\nwant=%q\ngot= %q", tt.input, tt.expected, visited)
+		}
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parse(t, `let f = fn(x) { x + 1 }; f(2)`)
+
+	idents := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	if strings.Join(idents, " ") != "f f" {
+		t.Errorf("wrong identifiers visited. got=%q", idents)
+	}
+}
+
+// depthVisitor checks that every visited node is followed by Visit(nil)
+// after its children.
+type depthVisitor struct {
+	depth    *int
+	maxDepth *int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depth++
+	if *v.depth > *v.maxDepth {
+		*v.maxDepth = *v.depth
+	}
+	return v
+}
+
+func TestWalkVisitsNilAfterChildren(t *testing.T) {
+	depth, maxDepth := 0, 0
+	ast.Walk(depthVisitor{&depth, &maxDepth}, parse(t, `[1, [2, [3]]]`))
+
+	if depth != 0 {
+		t.Errorf("unbalanced visits. depth=%d", depth)
+	}
+	// Program, ExpressionStatement and three nested arrays with a literal
+	if maxDepth != 6 {
+		t.Errorf("wrong max depth. want=6, got=%d", maxDepth)
+	}
+}
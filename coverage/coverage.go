@@ -0,0 +1,170 @@
+// Package coverage measures which statements of Monkey programs run and
+// which sides of their if expressions are taken.
+//
+// A Coverage is a hook of the evaluator, set with Interpreter.SetHook.
+// Once the program ends, Report parses the files that ran and matches
+// what was recorded to their statements:
+//
+//	cov := coverage.New()
+//	in.SetHook(cov)
+//	_, err := in.EvalFile("main.mk")
+//	report, err := cov.Report()
+//	report.WriteText(os.Stderr)
+package coverage
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+	tk "github.com/ryym/monkey/token"
+)
+
+type Coverage struct {
+	counts map[point]int
+	files  []string // The files that ran, in the order they started
+	seen   map[string]bool
+}
+
+// point is a node evaluated in a file. Nodes are told apart by their
+// kind too, since an if starts where the statement holding it does.
+type point struct {
+	file string
+	pos  tk.Position
+	kind kind
+}
+
+type kind int
+
+const (
+	statement kind = iota
+	ifExpression
+	block
+)
+
+func New() *Coverage {
+	return &Coverage{counts: make(map[point]int), seen: make(map[string]bool)}
+}
+
+func (c *Coverage) Before(node ast.Node, env *object.Environment) {
+	var k kind
+	switch node.(type) {
+	case *ast.BlockStatement:
+		k = block
+	case ast.Statement:
+		k = statement
+	case *ast.IfExpression:
+		k = ifExpression
+	default:
+		return
+	}
+	if !c.seen[env.File] {
+		c.seen[env.File] = true
+		c.files = append(c.files, env.File)
+	}
+	c.counts[point{file: env.File, pos: node.Pos(), kind: k}]++
+}
+
+func (c *Coverage) Call(*ast.CallExpression, *object.Function, *object.Environment) {}
+
+func (c *Coverage) Return(*ast.CallExpression, *object.Function, object.Object) {}
+
+// Report is the coverage of the files that ran.
+type Report struct {
+	Files []*File
+}
+
+type File struct {
+	Name       string
+	Source     []byte
+	Statements []Statement
+	Branches   []Branch
+}
+
+// Statement is a statement and the number of times it ran.
+type Statement struct {
+	Pos   tk.Position
+	Count int
+}
+
+// Branch is an if expression and the number of times each side of it
+// was taken. An if without else takes its else side whenever it does
+// not take its consequence.
+type Branch struct {
+	Pos  tk.Position
+	Then int
+	Else int
+}
+
+// Report matches what was recorded to the statements and branches of
+// the files that ran, whose sources must not have changed.
+func (c *Coverage) Report() (*Report, error) {
+	r := &Report{}
+	for _, name := range c.files {
+		if name == "" {
+			continue // Code that is not from a file
+		}
+		f, err := c.file(name)
+		if err != nil {
+			return nil, err
+		}
+		r.Files = append(r.Files, f)
+	}
+	return r, nil
+}
+
+func (c *Coverage) file(name string) (*File, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("%s: parse error: %s", name, p.Errors()[0])
+	}
+
+	f := &File{Name: name, Source: src}
+	count := func(node ast.Node, k kind) int {
+		return c.counts[point{file: name, pos: node.Pos(), kind: k}]
+	}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program, *ast.BlockStatement:
+		case ast.Statement:
+			f.Statements = append(f.Statements, Statement{Pos: node.Pos(), Count: count(node, statement)})
+		case *ast.IfExpression:
+			b := Branch{Pos: node.Pos(), Then: count(node.Consequence, block)}
+			if node.Alternative != nil {
+				b.Else = count(node.Alternative, block)
+			} else {
+				b.Else = count(node, ifExpression) - b.Then
+			}
+			f.Branches = append(f.Branches, b)
+		}
+		return true
+	})
+	return f, nil
+}
+
+// Covered returns the number of statements that ran, and the number of
+// sides of branches that were taken.
+func (f *File) Covered() (statements, branches int) {
+	for _, s := range f.Statements {
+		if s.Count > 0 {
+			statements++
+		}
+	}
+	for _, b := range f.Branches {
+		if b.Then > 0 {
+			branches++
+		}
+		if b.Else > 0 {
+			branches++
+		}
+	}
+	return statements, branches
+}
@@ -0,0 +1,174 @@
+package coverage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/internal/scripttest"
+	"github.com/ryym/monkey/interp"
+	tk "github.com/ryym/monkey/token"
+)
+
+const sign = `let sign = fn(n) {
+  if (n < 0) {
+    return "negative";
+  }
+  if (n == 0) { "zero" } else { "positive" }
+};
+let unused = fn() {
+  puts("never");
+};
+sign(5);
+sign(-1);
+`
+
+// measure runs the files from main.mk with their coverage measured, and
+// returns the report and the directory of the files.
+func measure(t *testing.T, files map[string]string) (*Report, string) {
+	t.Helper()
+	dir, _ := scripttest.WriteFiles(t, files)
+
+	evaluator.Stdout = ioutil.Discard
+	t.Cleanup(func() { evaluator.Stdout = os.Stdout })
+	cov := New()
+	in := interp.New()
+	in.SetHook(cov)
+	if _, err := in.EvalFile(filepath.Join(dir, "main.mk")); err != nil {
+		t.Fatal(err)
+	}
+	report, err := cov.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report, dir
+}
+
+func TestReport(t *testing.T) {
+	report, _ := measure(t, map[string]string{"main.mk": sign})
+	if len(report.Files) != 1 {
+		t.Fatalf("wrong number of files. got=%d", len(report.Files))
+	}
+	f := report.Files[0]
+
+	counts := map[tk.Position]int{}
+	for _, s := range f.Statements {
+		counts[s.Pos] = s.Count
+	}
+	expected := map[tk.Position]int{
+		{Line: 1, Column: 1}:  1,
+		{Line: 2, Column: 3}:  2,
+		{Line: 3, Column: 5}:  1,
+		{Line: 5, Column: 3}:  1,
+		{Line: 5, Column: 17}: 0,
+		{Line: 5, Column: 33}: 1,
+		{Line: 7, Column: 1}:  1,
+		{Line: 8, Column: 3}:  0,
+		{Line: 10, Column: 1}: 1,
+		{Line: 11, Column: 1}: 1,
+	}
+	if len(counts) != len(expected) {
+		t.Errorf("wrong statements. want=%v, got=%v", expected, counts)
+	}
+	for pos, want := range expected {
+		if got, ok := counts[pos]; !ok || got != want {
+			t.Errorf("wrong count of the statement at %s. want=%d, got=%d", pos, want, got)
+		}
+	}
+
+	branches := []Branch{
+		{Pos: tk.Position{Line: 2, Column: 3}, Then: 1, Else: 1},
+		{Pos: tk.Position{Line: 5, Column: 3}, Then: 0, Else: 1},
+	}
+	if len(f.Branches) != len(branches) {
+		t.Fatalf("wrong branches. want=%v, got=%v", branches, f.Branches)
+	}
+	for i, b := range branches {
+		if f.Branches[i] != b {
+			t.Errorf("wrong branch %d. want=%v, got=%v", i, b, f.Branches[i])
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	report, dir := measure(t, map[string]string{
+		"main.mk": "import \"util\";\nutil.abs(-1);\n",
+		"util.mk": "let abs = fn(n) { if (n < 0) { -n } else { n } };\nlet zero = fn() { 0 };\n",
+	})
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `main.mk: 100.0% of 2 statements, no branches
+util.mk: 66.7% of 6 statements, 50.0% of 2 branches
+total: 75.0% of 8 statements, 50.0% of 2 branches
+`
+	if got := strings.ReplaceAll(out.String(), dir+string(filepath.Separator), ""); got != expected {
+		t.Errorf("wrong text.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLCOV(t *testing.T) {
+	report, dir := measure(t, map[string]string{"main.mk": sign})
+	var out bytes.Buffer
+	if err := report.WriteLCOV(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TN:
+SF:main.mk
+BRDA:2,0,0,1
+BRDA:2,0,1,1
+BRDA:5,1,0,0
+BRDA:5,1,1,1
+BRF:4
+BRH:3
+DA:1,1
+DA:2,2
+DA:3,1
+DA:5,1
+DA:7,1
+DA:8,0
+DA:10,1
+DA:11,1
+LF:8
+LH:7
+end_of_record
+`
+	if got := strings.ReplaceAll(out.String(), dir+string(filepath.Separator), ""); got != expected {
+		t.Errorf("wrong LCOV.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLCOVIfNeverRun(t *testing.T) {
+	report, _ := measure(t, map[string]string{"main.mk": "let f = fn(x) { if (x) { 1 } };\n"})
+	var out bytes.Buffer
+	if err := report.WriteLCOV(&out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "BRDA:1,0,0,-\nBRDA:1,0,1,-\nBRF:2\nBRH:0\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("LCOV does not contain %q. got:\n%s", want, out.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	report, _ := measure(t, map[string]string{"main.mk": sign})
+	var out bytes.Buffer
+	if err := report.WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<p>80.0% of 10 statements, 75.0% of 4 branches</p>`,
+		`<span class="run"><span class="number">2</span><span class="count">2</span>  if (n &lt; 0) {</span>`,
+		`<span><span class="number">4</span><span class="count"></span>  }</span>`,
+		`<span class="partial" title="a statement not run; consequence never taken"><span class="number">5</span>`,
+		`<span class="not-run"><span class="number">8</span><span class="count">0</span>  puts(&#34;never&#34;);</span>`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("HTML does not contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// WriteText writes the share of statements and branches covered in each
+// file and in total.
+func (r *Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var stmts, stmtsRun, branches, taken int
+	for _, f := range r.Files {
+		run, t := f.Covered()
+		fmt.Fprintf(bw, "%s: %s\n", f.Name, summary(run, len(f.Statements), t, 2*len(f.Branches)))
+		stmts, stmtsRun = stmts+len(f.Statements), stmtsRun+run
+		branches, taken = branches+2*len(f.Branches), taken+t
+	}
+	fmt.Fprintf(bw, "total: %s\n", summary(stmtsRun, stmts, taken, branches))
+	return bw.Flush()
+}
+
+func summary(run, stmts, taken, branches int) string {
+	s := fmt.Sprintf("%s of %d statements", percent(run, stmts), stmts)
+	if branches == 0 {
+		return s + ", no branches"
+	}
+	return s + fmt.Sprintf(", %s of %d branches", percent(taken, branches), branches)
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// WriteLCOV writes the report in the tracefile format of LCOV. A line
+// counts the runs of the statement that ran most on it, and each if has
+// a block of two branches, the consequence and the alternative.
+func (r *Report) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Files {
+		path, err := filepath.Abs(f.Name)
+		if err != nil {
+			path = f.Name
+		}
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", path)
+
+		hit := 0
+		for i, b := range f.Branches {
+			for j, n := range []int{b.Then, b.Else} {
+				taken := "-" // The if never ran
+				if b.Then+b.Else > 0 {
+					taken = fmt.Sprint(n)
+				}
+				fmt.Fprintf(bw, "BRDA:%d,%d,%d,%s\n", b.Pos.Line, i, j, taken)
+				if n > 0 {
+					hit++
+				}
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", 2*len(f.Branches), hit)
+
+		lines := f.lines()
+		found, hitLines := 0, 0
+		for _, l := range lines {
+			if l.status == noCode {
+				continue
+			}
+			found++
+			if l.count > 0 {
+				hitLines++
+			}
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.number, l.count)
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", found, hitLines)
+	}
+	return bw.Flush()
+}
+
+type lineStatus int
+
+const (
+	noCode  lineStatus = iota
+	run                // Every statement ran, and branches took both sides
+	notRun             // No statement ran
+	partial            // Some statements or sides of branches were missed
+)
+
+type line struct {
+	number int
+	text   string
+	status lineStatus
+	count  int    // Runs of the statement that ran most on the line
+	note   string // What was missed
+}
+
+// lines returns the lines of the source with their coverage.
+func (f *File) lines() []line {
+	texts := strings.Split(strings.TrimSuffix(string(f.Source), "\n"), "\n")
+	lines := make([]line, len(texts))
+	for i, text := range texts {
+		lines[i] = line{number: i + 1, text: text}
+	}
+	missed := make(map[int]int)
+	for _, s := range f.Statements {
+		l := &lines[s.Pos.Line-1]
+		l.status = run
+		if s.Count > l.count {
+			l.count = s.Count
+		}
+		if s.Count == 0 {
+			missed[s.Pos.Line]++
+		}
+	}
+	for i := range lines {
+		l := &lines[i]
+		switch n := missed[l.number]; {
+		case n > 0 && l.count == 0:
+			l.status = notRun
+		case n > 0:
+			l.status = partial
+			l.note = fmt.Sprintf("%d statements not run", n)
+			if n == 1 {
+				l.note = "a statement not run"
+			}
+		}
+	}
+	for _, b := range f.Branches {
+		l := &lines[b.Pos.Line-1]
+		if l.status != run && l.status != partial || b.Then > 0 && b.Else > 0 {
+			continue
+		}
+		missing := "consequence never taken"
+		switch {
+		case b.Then+b.Else == 0:
+			missing = "if never run"
+		case b.Then > 0:
+			missing = "alternative never taken"
+		}
+		l.status = partial
+		l.note = strings.TrimPrefix(l.note+"; "+missing, "; ")
+	}
+	return lines
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { line-height: 1.3; }
+.number { color: #888; display: inline-block; text-align: right; width: 4em; margin-right: 1em; }
+.count { color: #888; display: inline-block; text-align: right; width: 4em; margin-right: 1em; }
+.run { background: #dfd; }
+.not-run { background: #fdd; }
+.partial { background: #ffd; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Name}}</h2>
+<p>{{.Summary}}</p>
+<pre>{{range .Lines}}<span{{with .Class}} class="{{.}}"{{end}}{{if .Note}} title="{{.Note}}"{{end}}><span class="number">{{.Number}}</span><span class="count">{{if .Class}}{{.Count}}{{end}}</span>{{.Text}}</span>
+{{end}}</pre>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes a page showing the source of each file, with the
+// lines that ran, that did not, and that ran in part in different
+// colors. Each line shows how many times it ran.
+func (r *Report) WriteHTML(w io.Writer) error {
+	type htmlLine struct {
+		Number, Count     int
+		Text, Class, Note string
+	}
+	type htmlFile struct {
+		Name, Summary string
+		Lines         []htmlLine
+	}
+	classes := map[lineStatus]string{run: "run", notRun: "not-run", partial: "partial"}
+
+	files := []htmlFile{}
+	for _, f := range r.Files {
+		stmts, taken := f.Covered()
+		hf := htmlFile{Name: f.Name, Summary: summary(stmts, len(f.Statements), taken, 2*len(f.Branches))}
+		for _, l := range f.lines() {
+			hf.Lines = append(hf.Lines, htmlLine{
+				Number: l.number,
+				Count:  l.count,
+				Text:   l.text,
+				Class:  classes[l.status],
+				Note:   l.note,
+			})
+		}
+		files = append(files, hf)
+	}
+	return htmlTemplate.Execute(w, files)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ryym/monkey/dap"
+)
+
+// serveDAP runs a debug adapter over the standard streams, or over the
+// first connection to a port on localhost, until the client disconnects.
+func (c *cli) serveDAP(args []string) int {
+	flags := flag.NewFlagSet("dap", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		io.WriteString(c.stderr, "usage: monkey dap [-port n]\n")
+		flags.PrintDefaults()
+	}
+	port := flags.Int("port", -1, "listen on a TCP port of localhost, or any free one if 0")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var in io.Reader = c.stdin
+	var out io.Writer = c.stdout
+	if *port >= 0 {
+		ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(*port)))
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey dap: %s\n", err)
+			return exitError
+		}
+		fmt.Fprintf(c.stderr, "listening on %s\n", ln.Addr())
+		conn, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey dap: %s\n", err)
+			return exitError
+		}
+		defer conn.Close()
+		in, out = conn, conn
+	}
+
+	server := dap.NewServer(in, out)
+	server.SearchPath = filepath.SplitList(os.Getenv("MONKEY_PATH"))
+	if err := server.Run(); err != nil {
+		fmt.Fprintf(c.stderr, "monkey dap: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,297 @@
+package dap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/internal/stepper"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+)
+
+// abandonSignal is panicked to abandon the program from inside the
+// evaluator.
+type abandonSignal struct{}
+
+// program is a launched program. It is the hook of its interpreter,
+// and runs in its own goroutine.
+type program struct {
+	s    *Server
+	args *LaunchArguments
+
+	steps *stepper.Stepper
+	entry bool // Stopping for the first time
+
+	// Guarded by the mutex of the server.
+	stopped   bool
+	abandoned bool
+	refs      []interface{} // What the variable references refer to, from 1
+
+	resumed chan stepper.Mode
+	done    chan struct{}
+}
+
+type breakpoint struct {
+	id   int
+	line int
+}
+
+// start runs the launched program in a new goroutine.
+func (s *Server) start() {
+	p := &program{
+		s:       s,
+		args:    s.launch,
+		steps:   stepper.New(s.launch.Program, stepper.Continue),
+		resumed: make(chan stepper.Mode),
+		done:    make(chan struct{}),
+	}
+	if p.args.StopOnEntry {
+		p.steps.Resume(stepper.Step)
+		p.entry = true
+	}
+	s.mu.Lock()
+	s.prog = p
+	s.mu.Unlock()
+
+	go func() {
+		defer close(p.done)
+		code, abandoned := p.run()
+		if !abandoned {
+			s.sendEvent("exited", map[string]int{"exitCode": code})
+			s.sendEvent("terminated", nil)
+		}
+	}()
+}
+
+// run runs the program and returns its exit code, or reports that it
+// was abandoned.
+func (p *program) run() (code int, abandoned bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(abandonSignal); !ok {
+				panic(r)
+			}
+			code, abandoned = 1, true
+		}
+	}()
+
+	stdout := evaluator.Stdout
+	defer func() { evaluator.Stdout = stdout }()
+	evaluator.Stdout = &output{s: p.s, category: "stdout"}
+	in := interp.New()
+	in.SetSearchPath(p.s.SearchPath...)
+	args := p.args.Args
+	if args == nil {
+		args = []string{}
+	}
+	if err := in.SetGlobal("args", args); err != nil {
+		p.report(err)
+		return 1, false
+	}
+	if !p.args.NoDebug {
+		in.SetHook(p)
+	}
+	if _, err := in.EvalFile(p.args.Program); err != nil {
+		p.report(err)
+		return 1, false
+	}
+	return 0, false
+}
+
+// report writes an error of the program as `monkey run` does.
+func (p *program) report(err error) {
+	var b strings.Builder
+	name := p.args.Program
+	switch err := err.(type) {
+	case *interp.ParseError:
+		fmt.Fprintf(&b, "%s: parse error\n", name)
+		for _, msg := range err.Errors {
+			fmt.Fprintf(&b, "\t%s\n", msg)
+		}
+	case *interp.ResolveError:
+		fmt.Fprintf(&b, "%s: resolve error\n", name)
+		for _, d := range err.Diagnostics {
+			fmt.Fprintf(&b, "\t%s\n", d)
+		}
+	case *object.Error:
+		fmt.Fprintf(&b, "%s: %s\n", name, err)
+		for _, frame := range err.Stack {
+			fmt.Fprintf(&b, "\t%s\n", frame)
+		}
+	default:
+		fmt.Fprintf(&b, "%s: %s\n", name, err)
+	}
+	p.s.sendEvent("output", map[string]string{"category": "stderr", "output": b.String()})
+}
+
+// output sends what the program writes as output events.
+type output struct {
+	s        *Server
+	category string
+}
+
+func (o *output) Write(data []byte) (int, error) {
+	err := o.s.sendEvent("output", map[string]string{"category": o.category, "output": string(data)})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (p *program) Before(node ast.Node, env *object.Environment) {
+	p.s.mu.Lock()
+	abandoned := p.abandoned
+	p.s.mu.Unlock()
+	if abandoned {
+		panic(abandonSignal{})
+	}
+
+	stop, arrived := p.steps.Before(node, env)
+	reason := ""
+	switch {
+	case stop && p.entry:
+		reason = reasonEntry
+	case stop:
+		reason = reasonStep
+	}
+	var hit []int
+	if arrived {
+		if bp := p.s.breakpointAt(env.File, node.Pos().Line); bp != nil {
+			reason, hit = reasonBreakpoint, []int{bp.id}
+		}
+	}
+	if reason != "" {
+		p.stop(reason, hit)
+	}
+}
+
+func (p *program) Call(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	p.steps.Call(call, fn, env)
+}
+
+func (p *program) Return(call *ast.CallExpression, fn *object.Function, result object.Object) {
+	p.steps.Return()
+}
+
+// stop tells the client that the program stopped, and waits until it
+// is resumed.
+func (p *program) stop(reason string, hit []int) {
+	p.s.mu.Lock()
+	if p.abandoned {
+		p.s.mu.Unlock()
+		panic(abandonSignal{})
+	}
+	p.stopped = true
+	p.refs = nil
+	p.s.mu.Unlock()
+	p.entry = false
+
+	body := map[string]interface{}{
+		"reason":            reason,
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	}
+	if hit != nil {
+		body["hitBreakpointIds"] = hit
+	}
+	p.s.sendEvent("stopped", body)
+
+	m := <-p.resumed
+	p.s.mu.Lock()
+	abandoned := p.abandoned
+	p.s.mu.Unlock()
+	if abandoned {
+		panic(abandonSignal{})
+	}
+	p.steps.Resume(m)
+}
+
+// resume resumes the stopped program.
+func (p *program) resume(m stepper.Mode) {
+	p.s.mu.Lock()
+	p.stopped = false
+	p.s.mu.Unlock()
+	p.resumed <- m
+}
+
+// breakpointAt finds a breakpoint on a line of a file.
+func (s *Server) breakpointAt(file string, line int) *breakpoint {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bp := range s.breakpoints[abs] {
+		if bp.line == line {
+			return bp
+		}
+	}
+	return nil
+}
+
+// setBreakpoints replaces the breakpoints of a source file. Those on
+// lines where no statement starts are not verified, since the program
+// never stops there.
+func (s *Server) setBreakpoints(args json.RawMessage) (interface{}, error) {
+	var a SetBreakpointsArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(a.Source.Path)
+	if err != nil || a.Source.Path == "" {
+		return nil, fmt.Errorf("bad source path: %q", a.Source.Path)
+	}
+	lines, err := statementLines(abs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bps := []*breakpoint{}
+	result := []Breakpoint{}
+	for _, sb := range a.Breakpoints {
+		s.lastID++
+		bp := Breakpoint{ID: s.lastID, Line: sb.Line, Source: &a.Source}
+		switch {
+		case err != nil:
+			bp.Message = err.Error()
+		case !lines[sb.Line]:
+			bp.Message = fmt.Sprintf("no statement on line %d", sb.Line)
+		default:
+			bp.Verified = true
+			bps = append(bps, &breakpoint{id: bp.ID, line: sb.Line})
+		}
+		result = append(result, bp)
+	}
+	s.breakpoints[abs] = bps
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// statementLines returns the lines of a file where statements start.
+func statementLines(file string) (map[int]bool, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("parse error: %s", p.Errors()[0])
+	}
+	lines := make(map[int]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.Program, *ast.BlockStatement:
+		case ast.Statement:
+			lines[node.Pos().Line] = true
+		}
+		return true
+	})
+	return lines, nil
+}
@@ -0,0 +1,241 @@
+// Package dap implements a Debug Adapter Protocol server for Monkey.
+//
+// The server talks to one client over a pair of streams, the standard
+// input and output of `monkey dap` or a TCP connection. It launches a
+// script in its own goroutine with the server as the hook of the
+// evaluator, and pauses it at breakpoints and steps so that the client
+// can inspect its stack and variables.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ryym/monkey/internal/framing"
+	"github.com/ryym/monkey/internal/stepper"
+)
+
+// Server serves one client.
+type Server struct {
+	// SearchPath is the search path of the modules the program imports.
+	SearchPath []string
+
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	launch     *LaunchArguments
+	configured bool
+	prog       *program // Set once the program starts
+
+	// afterReply is run once the response to the current request is
+	// written, for requests whose effects must follow their response.
+	afterReply func()
+
+	// mu guards the breakpoints and the state of the program that the
+	// requests inspect, which runs in its own goroutine.
+	mu          sync.Mutex
+	breakpoints map[string][]*breakpoint // By absolute path
+	lastID      int
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: make(map[string][]*breakpoint),
+	}
+}
+
+// handler handles a request, returning the body of its response.
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+// Assigned in init since the handlers refer to the server methods.
+func init() {
+	handlers = map[string]handler{
+		"initialize":        (*Server).initialize,
+		"launch":            (*Server).launchProgram,
+		"setBreakpoints":    (*Server).setBreakpoints,
+		"configurationDone": (*Server).configurationDone,
+		"threads":           (*Server).threads,
+		"stackTrace":        (*Server).stackTrace,
+		"scopes":            (*Server).scopes,
+		"variables":         (*Server).variables,
+		"continue":          resume(stepper.Continue),
+		"next":              resume(stepper.Next),
+		"stepIn":            resume(stepper.Step),
+		"stepOut":           resume(stepper.Out),
+		"disconnect":        func(*Server, json.RawMessage) (interface{}, error) { return nil, nil },
+	}
+}
+
+// Run serves requests until the client disconnects or closes the
+// connection. A program still running then is abandoned.
+func (s *Server) Run() error {
+	defer s.abandon()
+	for {
+		body, err := framing.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("bad message: %s", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if err := s.handle(&req); err != nil {
+			return err
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// handle dispatches a request and replies to it. It only fails if the
+// reply cannot be written.
+func (s *Server) handle(req *request) error {
+	resp := &response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: true}
+	s.afterReply = nil
+	if h, ok := handlers[req.Command]; ok {
+		body, err := h(s, req.Arguments)
+		if err != nil {
+			resp.Success, resp.Message = false, err.Error()
+		} else {
+			resp.Body = body
+		}
+	} else {
+		resp.Success, resp.Message = false, "unknown command: "+req.Command
+	}
+
+	if err := s.write(func(seq int) interface{} { resp.Seq = seq; return resp }); err != nil {
+		return err
+	}
+	if s.afterReply != nil {
+		s.afterReply()
+	}
+	return nil
+}
+
+// write writes a message with the next sequence number. Responses and
+// the events of the program are written from different goroutines.
+func (s *Server) write(msg func(seq int) interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	return framing.Write(s.out, msg(s.seq))
+}
+
+func (s *Server) sendEvent(name string, body interface{}) error {
+	return s.write(func(seq int) interface{} {
+		return &event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// decode reads the arguments of a request.
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("bad arguments: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	s.afterReply = func() { s.sendEvent("initialized", nil) }
+	return map[string]interface{}{
+		"supportsConfigurationDoneRequest": true,
+	}, nil
+}
+
+// launchProgram accepts the program to run, which starts once the
+// client is done configuring breakpoints.
+func (s *Server) launchProgram(args json.RawMessage) (interface{}, error) {
+	if s.launch != nil {
+		return nil, errors.New("already launched")
+	}
+	var a LaunchArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if a.Program == "" {
+		return nil, errors.New("no program to launch")
+	}
+	s.launch = &a
+	if s.configured {
+		s.afterReply = s.start
+	}
+	return nil, nil
+}
+
+func (s *Server) configurationDone(json.RawMessage) (interface{}, error) {
+	s.configured = true
+	if s.launch != nil && s.prog == nil {
+		s.afterReply = s.start
+	}
+	return nil, nil
+}
+
+func (s *Server) threads(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"threads": []Thread{{ID: threadID, Name: "main"}},
+	}, nil
+}
+
+// resume returns a handler that resumes the stopped program until it
+// stops in the given mode.
+func resume(m stepper.Mode) handler {
+	return func(s *Server, _ json.RawMessage) (interface{}, error) {
+		p, err := s.stopped()
+		if err != nil {
+			return nil, err
+		}
+		s.afterReply = func() { p.resume(m) }
+		if m == stepper.Continue {
+			return map[string]bool{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+	}
+}
+
+// stopped returns the program if it is stopped.
+func (s *Server) stopped() (*program, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prog == nil || !s.prog.stopped {
+		return nil, errors.New("the program is not stopped")
+	}
+	return s.prog, nil
+}
+
+// abandon makes the program stop running, if it is, and waits for it.
+func (s *Server) abandon() {
+	if s.prog == nil {
+		return
+	}
+	s.mu.Lock()
+	p := s.prog
+	p.abandoned = true
+	wasStopped := p.stopped
+	s.mu.Unlock()
+	if wasStopped {
+		p.resume(stepper.Continue)
+	}
+	<-p.done
+}
@@ -0,0 +1,215 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/monkey/internal/framing"
+	"github.com/ryym/monkey/internal/scripttest"
+)
+
+// normalize compacts a JSON message, drops its seq and sorts its keys.
+func normalize(t *testing.T, msg string) string {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &v); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, msg)
+	}
+	delete(v, "seq")
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// replay drives a server with a recorded session. A line starting with
+// "->" is a request to send, and one starting with "<-" is the next
+// message the server must write, without its seq. $FILE stands for the
+// path of the script. The server must write nothing more once the
+// session ends by disconnecting or closing the connection.
+func replay(t *testing.T, path string, session string) {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := NewServer(inR, outW)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run()
+		outW.Close()
+	}()
+
+	messages := make(chan string)
+	go func() {
+		defer close(messages)
+		r := bufio.NewReader(outR)
+		for {
+			body, err := framing.Read(r)
+			if err != nil {
+				return
+			}
+			messages <- string(body)
+		}
+	}()
+	next := func() (string, bool) {
+		select {
+		case msg, ok := <-messages:
+			return msg, ok
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a message")
+			return "", false
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(session), "\n") {
+		line = strings.ReplaceAll(strings.TrimSpace(line), "$FILE", path)
+		switch {
+		case strings.HasPrefix(line, "->"):
+			msg := strings.TrimSpace(line[2:])
+			fmt.Fprintf(inW, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+		case strings.HasPrefix(line, "<-"):
+			want := normalize(t, strings.TrimSpace(line[2:]))
+			msg, ok := next()
+			if !ok {
+				t.Fatalf("no more messages.\nwant: %s", want)
+			}
+			if got := normalize(t, msg); got != want {
+				t.Fatalf("wrong message.\nwant: %s\ngot:  %s", want, got)
+			}
+		}
+	}
+
+	inW.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Run failed: %s", err)
+	}
+	for msg := range messages {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
+
+const closures = `let make = fn(base) {
+  let items = [base, {"n": base}];
+  fn(x) {
+    let total = base + x;
+    total
+  }
+};
+let add = make(10);
+puts(add(5));
+`
+
+func TestBreakpointsAndVariables(t *testing.T) {
+	replay(t, scripttest.WriteFile(t, "main.mk", closures), `
+-> {"seq":1,"type":"request","command":"initialize","arguments":{"adapterID":"monkey"}}
+<- {"type":"response","request_seq":1,"success":true,"command":"initialize","body":{"supportsConfigurationDoneRequest":true}}
+<- {"type":"event","event":"initialized"}
+-> {"seq":2,"type":"request","command":"launch","arguments":{"program":"$FILE"}}
+<- {"type":"response","request_seq":2,"success":true,"command":"launch"}
+-> {"seq":3,"type":"request","command":"setBreakpoints","arguments":{"source":{"path":"$FILE"},"breakpoints":[{"line":4},{"line":6}]}}
+<- {"type":"response","request_seq":3,"success":true,"command":"setBreakpoints","body":{"breakpoints":[{"id":1,"verified":true,"source":{"path":"$FILE"},"line":4},{"id":2,"verified":false,"message":"no statement on line 6","source":{"path":"$FILE"},"line":6}]}}
+-> {"seq":4,"type":"request","command":"configurationDone"}
+<- {"type":"response","request_seq":4,"success":true,"command":"configurationDone"}
+<- {"type":"event","event":"stopped","body":{"reason":"breakpoint","threadId":1,"allThreadsStopped":true,"hitBreakpointIds":[1]}}
+-> {"seq":5,"type":"request","command":"threads"}
+<- {"type":"response","request_seq":5,"success":true,"command":"threads","body":{"threads":[{"id":1,"name":"main"}]}}
+-> {"seq":6,"type":"request","command":"stackTrace","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":6,"success":true,"command":"stackTrace","body":{"stackFrames":[{"id":1,"name":"<anonymous>","source":{"name":"main.mk","path":"$FILE"},"line":4,"column":5},{"id":2,"name":"<main>","source":{"name":"main.mk","path":"$FILE"},"line":9,"column":9}],"totalFrames":2}}
+-> {"seq":7,"type":"request","command":"scopes","arguments":{"frameId":1}}
+<- {"type":"response","request_seq":7,"success":true,"command":"scopes","body":{"scopes":[{"name":"Locals","variablesReference":1,"expensive":false},{"name":"Closure","variablesReference":2,"expensive":false},{"name":"Globals","variablesReference":3,"expensive":false}]}}
+-> {"seq":8,"type":"request","command":"variables","arguments":{"variablesReference":1}}
+<- {"type":"response","request_seq":8,"success":true,"command":"variables","body":{"variables":[{"name":"x","value":"5","type":"INTEGER","variablesReference":0}]}}
+-> {"seq":9,"type":"request","command":"variables","arguments":{"variablesReference":2}}
+<- {"type":"response","request_seq":9,"success":true,"command":"variables","body":{"variables":[{"name":"base","value":"10","type":"INTEGER","variablesReference":0},{"name":"items","value":"[10, {n: 10}]","type":"ARRAY","variablesReference":4}]}}
+-> {"seq":10,"type":"request","command":"variables","arguments":{"variablesReference":4}}
+<- {"type":"response","request_seq":10,"success":true,"command":"variables","body":{"variables":[{"name":"[0]","value":"10","type":"INTEGER","variablesReference":0},{"name":"[1]","value":"{n: 10}","type":"HASH","variablesReference":5}]}}
+-> {"seq":11,"type":"request","command":"variables","arguments":{"variablesReference":5}}
+<- {"type":"response","request_seq":11,"success":true,"command":"variables","body":{"variables":[{"name":"\"n\"","value":"10","type":"INTEGER","variablesReference":0}]}}
+-> {"seq":12,"type":"request","command":"variables","arguments":{"variablesReference":3}}
+<- {"type":"response","request_seq":12,"success":true,"command":"variables","body":{"variables":[{"name":"add","value":"fn(x)","type":"FUNCTION","variablesReference":6},{"name":"args","value":"[]","type":"ARRAY","variablesReference":0},{"name":"make","value":"fn(base)","type":"FUNCTION","variablesReference":0}]}}
+-> {"seq":13,"type":"request","command":"variables","arguments":{"variablesReference":6}}
+<- {"type":"response","request_seq":13,"success":true,"command":"variables","body":{"variables":[{"name":"base","value":"10","type":"INTEGER","variablesReference":0},{"name":"items","value":"[10, {n: 10}]","type":"ARRAY","variablesReference":7}]}}
+-> {"seq":14,"type":"request","command":"next","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":14,"success":true,"command":"next"}
+<- {"type":"event","event":"stopped","body":{"reason":"step","threadId":1,"allThreadsStopped":true}}
+-> {"seq":15,"type":"request","command":"variables","arguments":{"variablesReference":1}}
+<- {"type":"response","request_seq":15,"success":false,"command":"variables","message":"no variables 1"}
+-> {"seq":16,"type":"request","command":"scopes","arguments":{"frameId":1}}
+<- {"type":"response","request_seq":16,"success":true,"command":"scopes","body":{"scopes":[{"name":"Locals","variablesReference":1,"expensive":false},{"name":"Closure","variablesReference":2,"expensive":false},{"name":"Globals","variablesReference":3,"expensive":false}]}}
+-> {"seq":17,"type":"request","command":"variables","arguments":{"variablesReference":1}}
+<- {"type":"response","request_seq":17,"success":true,"command":"variables","body":{"variables":[{"name":"total","value":"15","type":"INTEGER","variablesReference":0},{"name":"x","value":"5","type":"INTEGER","variablesReference":0}]}}
+-> {"seq":18,"type":"request","command":"continue","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":18,"success":true,"command":"continue","body":{"allThreadsContinued":true}}
+<- {"type":"event","event":"output","body":{"category":"stdout","output":"15\n"}}
+<- {"type":"event","event":"exited","body":{"exitCode":0}}
+<- {"type":"event","event":"terminated"}
+-> {"seq":19,"type":"request","command":"stackTrace","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":19,"success":false,"command":"stackTrace","message":"the program is not stopped"}
+-> {"seq":20,"type":"request","command":"disconnect"}
+<- {"type":"response","request_seq":20,"success":true,"command":"disconnect"}
+`)
+}
+
+func TestStepping(t *testing.T) {
+	replay(t, scripttest.WriteFile(t, "main.mk", closures), `
+-> {"seq":1,"type":"request","command":"initialize"}
+<- {"type":"response","request_seq":1,"success":true,"command":"initialize","body":{"supportsConfigurationDoneRequest":true}}
+<- {"type":"event","event":"initialized"}
+-> {"seq":2,"type":"request","command":"configurationDone"}
+<- {"type":"response","request_seq":2,"success":true,"command":"configurationDone"}
+-> {"seq":3,"type":"request","command":"launch","arguments":{"program":"$FILE","stopOnEntry":true}}
+<- {"type":"response","request_seq":3,"success":true,"command":"launch"}
+<- {"type":"event","event":"stopped","body":{"reason":"entry","threadId":1,"allThreadsStopped":true}}
+-> {"seq":4,"type":"request","command":"next","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":4,"success":true,"command":"next"}
+<- {"type":"event","event":"stopped","body":{"reason":"step","threadId":1,"allThreadsStopped":true}}
+-> {"seq":5,"type":"request","command":"stepIn","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":5,"success":true,"command":"stepIn"}
+<- {"type":"event","event":"stopped","body":{"reason":"step","threadId":1,"allThreadsStopped":true}}
+-> {"seq":6,"type":"request","command":"stackTrace","arguments":{"threadId":1,"levels":1}}
+<- {"type":"response","request_seq":6,"success":true,"command":"stackTrace","body":{"stackFrames":[{"id":1,"name":"make","source":{"name":"main.mk","path":"$FILE"},"line":2,"column":3}],"totalFrames":2}}
+-> {"seq":7,"type":"request","command":"stepOut","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":7,"success":true,"command":"stepOut"}
+<- {"type":"event","event":"stopped","body":{"reason":"step","threadId":1,"allThreadsStopped":true}}
+-> {"seq":8,"type":"request","command":"stepIn","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":8,"success":true,"command":"stepIn"}
+<- {"type":"event","event":"stopped","body":{"reason":"step","threadId":1,"allThreadsStopped":true}}
+-> {"seq":9,"type":"request","command":"stackTrace","arguments":{"threadId":1,"startFrame":1}}
+<- {"type":"response","request_seq":9,"success":true,"command":"stackTrace","body":{"stackFrames":[{"id":2,"name":"<main>","source":{"name":"main.mk","path":"$FILE"},"line":9,"column":9}],"totalFrames":2}}
+-> {"seq":10,"type":"request","command":"frob"}
+<- {"type":"response","request_seq":10,"success":false,"command":"frob","message":"unknown command: frob"}
+-> {"seq":11,"type":"request","command":"disconnect"}
+<- {"type":"response","request_seq":11,"success":true,"command":"disconnect"}
+`)
+}
+
+func TestLaunchErrors(t *testing.T) {
+	replay(t, scripttest.WriteFile(t, "main.mk", "let x = 1;\nputs(x + true);\n"), `
+-> {"seq":1,"type":"request","command":"launch","arguments":{}}
+<- {"type":"response","request_seq":1,"success":false,"command":"launch","message":"no program to launch"}
+-> {"seq":2,"type":"request","command":"next","arguments":{"threadId":1}}
+<- {"type":"response","request_seq":2,"success":false,"command":"next","message":"the program is not stopped"}
+-> {"seq":3,"type":"request","command":"launch","arguments":{"program":"$FILE","noDebug":true}}
+<- {"type":"response","request_seq":3,"success":true,"command":"launch"}
+-> {"seq":4,"type":"request","command":"launch","arguments":{"program":"$FILE"}}
+<- {"type":"response","request_seq":4,"success":false,"command":"launch","message":"already launched"}
+-> {"seq":5,"type":"request","command":"configurationDone"}
+<- {"type":"response","request_seq":5,"success":true,"command":"configurationDone"}
+<- {"type":"event","event":"output","body":{"category":"stderr","output":"$FILE: TypeError: type mismatch: INTEGER + BOOLEAN\n\tat <main> ($FILE:2:8)\n"}}
+<- {"type":"event","event":"exited","body":{"exitCode":1}}
+<- {"type":"event","event":"terminated"}
+`)
+}
+
+func TestCloseWhileStopped(t *testing.T) {
+	// The program is abandoned without telling that it exited.
+	replay(t, scripttest.WriteFile(t, "main.mk", "puts(1);\n"), `
+-> {"seq":1,"type":"request","command":"launch","arguments":{"program":"$FILE","stopOnEntry":true}}
+<- {"type":"response","request_seq":1,"success":true,"command":"launch"}
+-> {"seq":2,"type":"request","command":"configurationDone"}
+<- {"type":"response","request_seq":2,"success":true,"command":"configurationDone"}
+<- {"type":"event","event":"stopped","body":{"reason":"entry","threadId":1,"allThreadsStopped":true}}
+`)
+}
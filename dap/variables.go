@@ -0,0 +1,212 @@
+package dap
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ryym/monkey/object"
+)
+
+// scope is the bindings of a chain of environments, innermost first.
+// A name bound in more than one of them shows its innermost binding.
+type scope []*object.Environment
+
+type StackTraceArguments struct {
+	ThreadID   int `json:"threadId"`
+	StartFrame int `json:"startFrame"`
+	Levels     int `json:"levels"`
+}
+
+// stackTrace returns the frames of the stopped program, innermost first.
+// The ID of a frame is its index from 1.
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+	var a StackTraceArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	p, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	frames := []StackFrame{}
+	stack := p.steps.Stack
+	for i := len(stack) - 1; i >= 0; i-- {
+		f := stack[i]
+		frame := StackFrame{ID: len(stack) - i, Name: f.Function, Line: f.Pos.Line, Column: f.Pos.Column}
+		if f.File != "" {
+			path, err := filepath.Abs(f.File)
+			if err != nil {
+				path = f.File
+			}
+			frame.Source = &Source{Name: filepath.Base(f.File), Path: path}
+		}
+		frames = append(frames, frame)
+	}
+	total := len(frames)
+	if a.StartFrame > 0 {
+		if a.StartFrame > len(frames) {
+			a.StartFrame = len(frames)
+		}
+		frames = frames[a.StartFrame:]
+	}
+	if a.Levels > 0 && a.Levels < len(frames) {
+		frames = frames[:a.Levels]
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": total}, nil
+}
+
+type ScopesArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+// scopes returns the scopes of a frame: the locals of a function, the
+// environments it closes over, and the globals of its file.
+func (s *Server) scopes(args json.RawMessage) (interface{}, error) {
+	var a ScopesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	p, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+	stack := p.steps.Stack
+	if a.FrameID < 1 || a.FrameID > len(stack) {
+		return nil, fmt.Errorf("no frame %d", a.FrameID)
+	}
+	env := stack[len(stack)-a.FrameID].Env
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scopes := []Scope{}
+	for e, name := env, "Locals"; e != nil; e, name = e.Outer(), "Closure" {
+		if e.Outer() == nil {
+			name = "Globals"
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: p.ref(scope{e})})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+type VariablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+// variables returns the variables of a scope, or the elements of a
+// value: those of arrays and hashes, the fields of records, the exports
+// of modules and the environments that functions close over.
+func (s *Server) variables(args json.RawMessage) (interface{}, error) {
+	var a VariablesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	p, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.VariablesReference < 1 || a.VariablesReference > len(p.refs) {
+		return nil, fmt.Errorf("no variables %d", a.VariablesReference)
+	}
+	vars := []Variable{}
+	switch v := p.refs[a.VariablesReference-1].(type) {
+	case scope:
+		seen := make(map[string]bool)
+		for _, env := range v {
+			for _, name := range env.OwnNames() {
+				if !seen[name] {
+					seen[name] = true
+					value, _ := env.Get(name)
+					vars = append(vars, p.variable(name, value))
+				}
+			}
+		}
+	case *object.Array:
+		for i, el := range v.Elements {
+			vars = append(vars, p.variable(fmt.Sprintf("[%d]", i), el))
+		}
+	case *object.Hash:
+		for _, pair := range v.OrderedPairs() {
+			name := pair.Key.Inspect()
+			if str, ok := pair.Key.(*object.String); ok {
+				name = strconv.Quote(str.Value)
+			}
+			vars = append(vars, p.variable(name, pair.Value))
+		}
+	case *object.Record:
+		for _, f := range v.Fields {
+			vars = append(vars, p.variable(f.Name, f.Value))
+		}
+	case *object.Module:
+		for _, name := range v.Exports {
+			value, _ := v.Env.Get(name)
+			vars = append(vars, p.variable(name, value))
+		}
+	}
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+// variable describes a value, giving a reference to its elements if it
+// has any.
+func (p *program) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: summary(value), Type: string(value.Type())}
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) > 0 {
+			v.VariablesReference = p.ref(value)
+		}
+	case *object.Hash:
+		if len(value.Keys) > 0 {
+			v.VariablesReference = p.ref(value)
+		}
+	case *object.Record:
+		if len(value.Fields) > 0 {
+			v.VariablesReference = p.ref(value)
+		}
+	case *object.Module:
+		if len(value.Exports) > 0 {
+			v.VariablesReference = p.ref(value)
+		}
+	case *object.Function:
+		// Functions defined at the top level close over the globals
+		// only, which have a scope of their own.
+		var captured scope
+		for env := value.Env; env != nil && env.Outer() != nil; env = env.Outer() {
+			captured = append(captured, env)
+		}
+		if len(captured) > 0 {
+			v.VariablesReference = p.ref(captured)
+		}
+	}
+	return v
+}
+
+// ref returns a new reference to a scope or a value. References are
+// valid until the program resumes.
+func (p *program) ref(v interface{}) int {
+	p.refs = append(p.refs, v)
+	return len(p.refs)
+}
+
+// summary shows a value in one line. Strings are quoted, and functions
+// show their parameters but not their bodies.
+func summary(value object.Object) string {
+	if str, ok := value.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	fn, ok := value.(*object.Function)
+	if !ok {
+		return value.Inspect()
+	}
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.Value
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
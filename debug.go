@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+
+	"github.com/ryym/monkey/debugger"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/object"
+)
+
+// debugFile runs a script under the debugger, which reads its commands
+// from the standard input.
+func (c *cli) debugFile(args []string) int {
+	if len(args) == 0 {
+		io.WriteString(c.stderr, "usage: monkey debug <file> [args...]\n")
+		return exitUsage
+	}
+	d := debugger.New(c.stdin, c.stdout)
+	d.Main = args[0]
+	quit := false
+	_, code := c.exec(args[0], args[1:], func(in *interp.Interpreter) (object.Object, error) {
+		in.SetHook(d)
+		result, err := d.Run(func() (object.Object, error) {
+			return in.EvalFile(args[0])
+		})
+		if err == debugger.ErrQuit {
+			quit = true
+			return nil, nil
+		}
+		return result, err
+	})
+	if quit {
+		return exitError
+	}
+	return code
+}
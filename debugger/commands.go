@@ -0,0 +1,202 @@
+package debugger
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ryym/monkey/internal/stepper"
+)
+
+// command is a debugger command. Its run function reports whether the
+// program resumes.
+type command struct {
+	alias string
+	args  string // Description of the arguments, if any
+	help  string
+	run   func(d *Debugger, arg string) bool
+}
+
+var commands map[string]command
+
+// Assigned in init since help refers to the commands.
+func init() {
+	commands = map[string]command{
+		"break":     {"b", "[[file:]line [if cond]]", "set a breakpoint, or list them", (*Debugger).setBreakpoint},
+		"delete":    {"d", "[id]", "delete a breakpoint, or all of them", (*Debugger).deleteBreakpoint},
+		"continue":  {"c", "", "run until a breakpoint", resume(stepper.Continue)},
+		"step":      {"s", "", "run to the next statement, entering calls", resume(stepper.Step)},
+		"next":      {"n", "", "run to the next statement, stepping over calls", resume(stepper.Next)},
+		"out":       {"o", "", "run until the current function returns", (*Debugger).stepOut},
+		"print":     {"p", "<expr>", "evaluate an expression where the program stopped", (*Debugger).print},
+		"backtrace": {"bt", "", "show the calls being executed", (*Debugger).backtrace},
+		"list":      {"l", "", "show the source around the current line", (*Debugger).list},
+		"help":      {"h", "", "show this help", (*Debugger).help},
+		"quit":      {"q", "", "abandon the program", (*Debugger).quit},
+	}
+}
+
+var commandOrder = []string{"break", "delete", "continue", "step", "next", "out", "print", "backtrace", "list", "help", "quit"}
+
+func (d *Debugger) runCommand(line string) bool {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	for full, cmd := range commands {
+		if cmd.alias == name {
+			name = full
+		}
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(d.out, "unknown command: %s (try help)\n", name)
+		return false
+	}
+	if cmd.args == "" && arg != "" {
+		fmt.Fprintf(d.out, "usage: %s\n", name)
+		return false
+	}
+	if strings.HasPrefix(cmd.args, "<") && arg == "" {
+		fmt.Fprintf(d.out, "usage: %s %s\n", name, cmd.args)
+		return false
+	}
+	return cmd.run(d, arg)
+}
+
+// resume returns a command that resumes the program until it stops in
+// the given mode.
+func resume(m stepper.Mode) func(d *Debugger, arg string) bool {
+	return func(d *Debugger, _ string) bool {
+		d.steps.Resume(m)
+		return true
+	}
+}
+
+func (d *Debugger) stepOut(arg string) bool {
+	if len(d.steps.Stack) == 1 {
+		io.WriteString(d.out, "not in a function\n")
+		return false
+	}
+	return resume(stepper.Out)(d, arg)
+}
+
+func (d *Debugger) setBreakpoint(arg string) bool {
+	if arg == "" {
+		if len(d.breakpoints) == 0 {
+			io.WriteString(d.out, "no breakpoints\n")
+		}
+		for _, bp := range d.breakpoints {
+			fmt.Fprintln(d.out, bp)
+		}
+		return false
+	}
+
+	bp := &breakpoint{file: d.Main}
+	spec := arg
+	if i := strings.Index(arg, " if "); i >= 0 {
+		spec, bp.cond = strings.TrimSpace(arg[:i]), strings.TrimSpace(arg[i+len(" if "):])
+	}
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		bp.file, spec = spec[:i], spec[i+1:]
+	}
+	line, err := strconv.Atoi(spec)
+	if err != nil || line < 1 {
+		fmt.Fprintf(d.out, "bad line: %s\n", spec)
+		return false
+	}
+	bp.line = line
+	if bp.cond != "" {
+		prog, ok := d.parse(bp.cond)
+		if !ok {
+			return false
+		}
+		bp.prog = prog
+	}
+
+	d.lastID++
+	bp.id = d.lastID
+	d.breakpoints = append(d.breakpoints, bp)
+	fmt.Fprintln(d.out, bp)
+	return false
+}
+
+func (d *Debugger) deleteBreakpoint(arg string) bool {
+	if arg == "" {
+		d.breakpoints = nil
+		io.WriteString(d.out, "deleted all breakpoints\n")
+		return false
+	}
+	id, err := strconv.Atoi(arg)
+	if err == nil {
+		for i, bp := range d.breakpoints {
+			if bp.id == id {
+				d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+				fmt.Fprintf(d.out, "deleted breakpoint %d\n", id)
+				return false
+			}
+		}
+	}
+	fmt.Fprintf(d.out, "no breakpoint %s\n", arg)
+	return false
+}
+
+func (d *Debugger) print(arg string) bool {
+	program, ok := d.parse(arg)
+	if !ok {
+		return false
+	}
+	if result := d.eval(program, d.steps.Top().Env); result != nil {
+		fmt.Fprintln(d.out, result.Inspect())
+	} else {
+		io.WriteString(d.out, "no value\n")
+	}
+	return false
+}
+
+func (d *Debugger) backtrace(string) bool {
+	stack := d.steps.Stack
+	for i := range stack {
+		fmt.Fprintf(d.out, "#%d %s\n", i, stack[len(stack)-1-i].StackFrame)
+	}
+	return false
+}
+
+// list shows five lines before and after the current one.
+func (d *Debugger) list(string) bool {
+	top := d.steps.Top()
+	lines := d.source(top.File)
+	if len(lines) == 0 {
+		io.WriteString(d.out, "no source\n")
+		return false
+	}
+	for n := top.Pos.Line - 5; n <= top.Pos.Line+5; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		marker := "  "
+		if n == top.Pos.Line {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s%4d\t%s\n", marker, n, lines[n-1])
+	}
+	return false
+}
+
+func (d *Debugger) help(string) bool {
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		usage := name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		fmt.Fprintf(d.out, "  %-32s %s (%s)\n", usage, cmd.help, cmd.alias)
+	}
+	return false
+}
+
+func (d *Debugger) quit(string) bool {
+	panic(quitSignal{})
+}
@@ -0,0 +1,218 @@
+// Package debugger implements an interactive debugger for Monkey programs.
+//
+// A Debugger is a hook of the evaluator. It stops before the statements
+// where a breakpoint is set or where a step ends, and reads commands to
+// inspect the program until one resumes it. It stops before the first
+// statement so that breakpoints can be set.
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/internal/stepper"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+)
+
+// ErrQuit is returned by Run if the user quit before the program ended.
+var ErrQuit = errors.New("quit")
+
+// quitSignal is panicked to abandon the program from inside the evaluator.
+type quitSignal struct{}
+
+type Debugger struct {
+	// Main is the file that breakpoints without a file refer to.
+	Main string
+
+	in  *bufio.Scanner
+	out io.Writer
+
+	breakpoints []*breakpoint
+	lastID      int
+
+	steps *stepper.Stepper
+
+	busy     bool // Evaluating code for a command
+	detached bool // No more commands to read
+
+	sources map[string][]string
+}
+
+type breakpoint struct {
+	id   int
+	file string // As given, or the main file
+	line int
+	cond string // The source of the condition, if any
+	prog *ast.Program
+}
+
+func (b *breakpoint) String() string {
+	s := fmt.Sprintf("breakpoint %d at %s:%d", b.id, b.file, b.line)
+	if b.cond != "" {
+		s += " if " + b.cond
+	}
+	return s
+}
+
+func New(in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		in:      bufio.NewScanner(in),
+		out:     out,
+		sources: make(map[string][]string),
+	}
+}
+
+// Run runs a program under the debugger, which must be set as the hook
+// of the interpreter that run uses. The program keeps running without
+// stopping once there are no more commands to read.
+func (d *Debugger) Run(run func() (object.Object, error)) (result object.Object, err error) {
+	d.steps = stepper.New(d.Main, stepper.Step)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(quitSignal); !ok {
+				panic(r)
+			}
+			result, err = nil, ErrQuit
+		}
+	}()
+	return run()
+}
+
+func (d *Debugger) Before(node ast.Node, env *object.Environment) {
+	if d.busy || d.detached {
+		return
+	}
+	stop, arrived := d.steps.Before(node, env)
+	line := node.Pos().Line
+	reason := ""
+	if arrived {
+		if bp := d.breakpointAt(env, line); bp != nil {
+			stop = true
+			reason = fmt.Sprintf("breakpoint %d ", bp.id)
+		}
+	}
+	if !stop {
+		return
+	}
+
+	fmt.Fprintf(d.out, "%s%s\n", reason, d.steps.Top().StackFrame)
+	if text, ok := d.sourceLine(env.File, line); ok {
+		fmt.Fprintf(d.out, "%4d\t%s\n", line, text)
+	}
+	d.prompt()
+}
+
+func (d *Debugger) Call(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	if d.busy || d.detached {
+		return
+	}
+	d.steps.Call(call, fn, env)
+}
+
+func (d *Debugger) Return(call *ast.CallExpression, fn *object.Function, result object.Object) {
+	if d.busy || d.detached {
+		return
+	}
+	d.steps.Return()
+}
+
+// breakpointAt finds a breakpoint on a line whose condition holds.
+// A condition that fails to evaluate stops the program too.
+func (d *Debugger) breakpointAt(env *object.Environment, line int) *breakpoint {
+	for _, bp := range d.breakpoints {
+		if bp.line != line || !d.sameFile(bp.file, env.File) {
+			continue
+		}
+		if bp.prog == nil {
+			return bp
+		}
+		result := d.eval(bp.prog, env)
+		if err, ok := result.(*object.Error); ok {
+			fmt.Fprintf(d.out, "breakpoint %d: condition failed: %s\n", bp.id, err.Inspect())
+			return bp
+		}
+		if result != nil && result != evaluator.NULL && result != evaluator.FALSE {
+			return bp
+		}
+	}
+	return nil
+}
+
+// sameFile reports whether the file of a breakpoint is the given one.
+// A file given without a directory matches files of that name anywhere.
+func (d *Debugger) sameFile(bpFile, file string) bool {
+	if filepath.Base(bpFile) == bpFile {
+		return filepath.Base(file) == bpFile
+	}
+	a, errA := filepath.Abs(bpFile)
+	b, errB := filepath.Abs(file)
+	return errA == nil && errB == nil && a == b
+}
+
+// eval evaluates code for a command without stopping in it.
+func (d *Debugger) eval(program *ast.Program, env *object.Environment) object.Object {
+	d.busy = true
+	defer func() { d.busy = false }()
+	return evaluator.Eval(program, env)
+}
+
+func (d *Debugger) sourceLine(file string, line int) (string, bool) {
+	lines := d.source(file)
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return lines[line-1], true
+}
+
+func (d *Debugger) source(file string) []string {
+	if lines, ok := d.sources[file]; ok {
+		return lines
+	}
+	var lines []string
+	if src, err := ioutil.ReadFile(file); err == nil {
+		lines = strings.Split(string(src), "\n")
+	}
+	d.sources[file] = lines
+	return lines
+}
+
+// prompt reads commands until one resumes the program.
+func (d *Debugger) prompt() {
+	for {
+		io.WriteString(d.out, "(debug) ")
+		if !d.in.Scan() {
+			io.WriteString(d.out, "\n")
+			d.detached = true
+			return
+		}
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			continue
+		}
+		if d.runCommand(line) {
+			return
+		}
+	}
+}
+
+// parse parses the source of a command, reporting its errors.
+func (d *Debugger) parse(src string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(d.out, "parse error: %s\n", msg)
+		}
+		return nil, false
+	}
+	return program, true
+}
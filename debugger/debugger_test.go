@@ -0,0 +1,191 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/internal/scripttest"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/object"
+)
+
+// session runs main.mk of the files under the debugger with the commands
+// as its input, and returns what was written, with the paths of the
+// files relative to their directory.
+func session(t *testing.T, files map[string]string, commands ...string) string {
+	t.Helper()
+	dir, _ := scripttest.WriteFiles(t, files)
+
+	out := &bytes.Buffer{}
+	evaluator.Stdout = out
+	t.Cleanup(func() { evaluator.Stdout = os.Stdout })
+
+	main := filepath.Join(dir, "main.mk")
+	d := New(strings.NewReader(strings.Join(commands, "\n")), out)
+	d.Main = main
+	in := interp.New()
+	in.SetHook(d)
+	if _, err := d.Run(func() (object.Object, error) { return in.EvalFile(main) }); err != nil {
+		fmt.Fprintf(out, "error: %s\n", err)
+	}
+	return strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+}
+
+func checkSession(t *testing.T, got string, expected ...string) {
+	t.Helper()
+	if want := strings.Join(expected, "\n") + "\n"; got != want {
+		t.Errorf("wrong session.\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+const add = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let total = 0;
+let i = add(1, 2);
+puts(add(i, 10));
+`
+
+func TestBreakpoints(t *testing.T) {
+	got := session(t, map[string]string{"main.mk": add},
+		"break 2",
+		"break",
+		"continue",
+		"print a + b",
+		"backtrace",
+		"c",
+		"p a",
+		"c",
+	)
+	checkSession(t, got,
+		"at <main> (main.mk:1:1)",
+		"   1\tlet add = fn(a, b) {",
+		"(debug) breakpoint 1 at main.mk:2",
+		"(debug) breakpoint 1 at main.mk:2",
+		"(debug) breakpoint 1 at add (main.mk:2:3)",
+		"   2\t  let sum = a + b;",
+		"(debug) 3",
+		"(debug) #0 at add (main.mk:2:3)",
+		"#1 at <main> (main.mk:6:12)",
+		"(debug) breakpoint 1 at add (main.mk:2:3)",
+		"   2\t  let sum = a + b;",
+		"(debug) 3",
+		"(debug) 13",
+	)
+}
+
+func TestStepping(t *testing.T) {
+	got := session(t, map[string]string{"main.mk": add},
+		"out",
+		"next",
+		"n",
+		"step",
+		"s",
+		"out",
+		"step",
+		"bt",
+		"quit",
+	)
+	checkSession(t, got,
+		"at <main> (main.mk:1:1)",
+		"   1\tlet add = fn(a, b) {",
+		"(debug) not in a function",
+		"(debug) at <main> (main.mk:5:1)",
+		"   5\tlet total = 0;",
+		"(debug) at <main> (main.mk:6:1)",
+		"   6\tlet i = add(1, 2);",
+		"(debug) at add (main.mk:2:3)",
+		"   2\t  let sum = a + b;",
+		"(debug) at add (main.mk:3:3)",
+		"   3\t  sum",
+		"(debug) at <main> (main.mk:7:1)",
+		"   7\tputs(add(i, 10));",
+		"(debug) at add (main.mk:2:3)",
+		"   2\t  let sum = a + b;",
+		"(debug) #0 at add (main.mk:2:3)",
+		"#1 at <main> (main.mk:7:9)",
+		"(debug) error: quit",
+	)
+}
+
+const fact = `let fact = fn(n) {
+  if (n < 2) { return 1; }
+  n * fact(n - 1)
+};
+fact(4)
+`
+
+func TestConditionalBreakpoints(t *testing.T) {
+	got := session(t, map[string]string{"main.mk": fact},
+		"break x",
+		"break 3 if n +",
+		"break 3 if n == 2",
+		"continue",
+		"print n",
+		"bt",
+		"list",
+		"delete 1",
+		"delete 1",
+		"break 2 if n + true",
+		"c",
+		"print nope",
+		"frob",
+		"bt now",
+		"delete",
+	)
+	checkSession(t, got,
+		"at <main> (main.mk:1:1)",
+		"   1\tlet fact = fn(n) {",
+		"(debug) bad line: x",
+		"(debug) parse error: no prefix parse function for EOF found",
+		"(debug) breakpoint 1 at main.mk:3 if n == 2",
+		"(debug) breakpoint 1 at fact (main.mk:3:3)",
+		"   3\t  n * fact(n - 1)",
+		"(debug) 2",
+		"(debug) #0 at fact (main.mk:3:3)",
+		"#1 at fact (main.mk:3:11)",
+		"#2 at fact (main.mk:3:11)",
+		"#3 at <main> (main.mk:5:5)",
+		"(debug)      1\tlet fact = fn(n) {",
+		"     2\t  if (n < 2) { return 1; }",
+		"=>   3\t  n * fact(n - 1)",
+		"     4\t};",
+		"     5\tfact(4)",
+		"     6\t",
+		"(debug) deleted breakpoint 1",
+		"(debug) no breakpoint 1",
+		"(debug) breakpoint 2 at main.mk:2 if n + true",
+		"(debug) breakpoint 2: condition failed: ERROR: type mismatch: INTEGER + BOOLEAN",
+		"breakpoint 2 at fact (main.mk:2:3)",
+		"   2\t  if (n < 2) { return 1; }",
+		"(debug) ERROR: identifier not found: nope",
+		"(debug) unknown command: frob (try help)",
+		"(debug) usage: backtrace",
+		"(debug) deleted all breakpoints",
+		"(debug) ",
+	)
+}
+
+func TestModuleBreakpoints(t *testing.T) {
+	files := map[string]string{
+		"main.mk": "import \"util\";\nutil.twice(2)\n",
+		"util.mk": "let twice = fn(x) {\n  x * 2\n};\n",
+	}
+	got := session(t, files, "break util.mk:2", "c", "bt")
+	checkSession(t, got,
+		"at <main> (main.mk:1:1)",
+		"   1\timport \"util\";",
+		"(debug) breakpoint 1 at util.mk:2",
+		"(debug) breakpoint 1 at twice (util.mk:2:3)",
+		"   2\t  x * 2",
+		"(debug) #0 at twice (util.mk:2:3)",
+		"#1 at <main> (main.mk:2:11)",
+		"(debug) ",
+	)
+}
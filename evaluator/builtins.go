@@ -0,0 +1,79 @@
+package evaluator
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ryym/monkey/object"
+)
+
+// Stdout is where the `puts` builtin writes.
+var Stdout io.Writer = os.Stdout
+
+var builtins = map[string]*object.Builtin{
+	// puts(args...) prints the arguments separated by spaces.
+	"puts": {
+		Fn: func(args ...object.Object) object.Object {
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				strs[i] = arg.Inspect()
+			}
+			io.WriteString(Stdout, strings.Join(strs, " ")+"\n")
+			return NULL
+		},
+	},
+
+	"json_parse": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.TYPE_ERROR, "wrong number of arguments: want=1, got=%d", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `json_parse` must be STRING, got %s", args[0].Type())
+			}
+			return parseJSON(str.Value)
+		},
+	},
+
+	// json_stringify(value, indent) pretty-prints the output when an indent is
+	// given, either as a number of spaces or as a string.
+	"json_stringify": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.TYPE_ERROR, "wrong number of arguments: want=1 or 2, got=%d", len(args))
+			}
+
+			indent := ""
+			if len(args) == 2 {
+				switch arg := args[1].(type) {
+				case *object.Integer:
+					if arg.Value < 0 || arg.Value > 10 {
+						return newError(object.VALUE_ERROR, "indent of `json_stringify` must be between 0 and 10, got %d", arg.Value)
+					}
+					for i := int64(0); i < arg.Value; i++ {
+						indent += " "
+					}
+				case *object.String:
+					indent = arg.Value
+				default:
+					return newError(object.TYPE_ERROR, "indent of `json_stringify` must be INTEGER or STRING, got %s", args[1].Type())
+				}
+			}
+
+			return stringifyJSON(args[0], indent)
+		},
+	},
+}
+
+// BuiltinNames returns the names of all builtin functions in alphabetical order.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -13,46 +13,122 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
-func Eval(node ast.Node) object.Object {
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	if env.Hook != nil {
+		env.Hook.Before(node, env)
+	}
+	obj := eval(node, env)
+
+	// The innermost node that sees an error is the one that raised it.
+	if err, ok := obj.(*object.Error); ok && len(err.Stack) == 0 {
+		err.Stack = []object.StackFrame{{Function: env.Function, File: env.File, Pos: node.Pos()}}
+	}
+
+	return obj
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// Statements
 	case *ast.Program:
-		return evalProgram(node.Statements)
+		return evalProgram(node.Statements, env)
 	case *ast.BlockStatement:
-		return evalBlockStatements(node.Statements)
+		return evalBlockStatements(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression)
+		return Eval(node.Expression, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue)
+		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		bind(node.Name, val, env)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return newThrownError(val)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
 
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
 	case *ast.PrefixExpression:
-		right := Eval(node.Right)
+		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left)
+		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right)
+		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
-		return evalIfExpression(node)
+		return evalIfExpression(node, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{
+			Parameters: node.Parameters,
+			Body:       node.Body,
+			Env:        env,
+			Name:       node.Name,
+			Locals:     node.Locals,
+		}
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(node, function, args, env)
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Property.Value)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
 	}
 
 	return nil
@@ -62,10 +138,10 @@ func isError(obj object.Object) bool {
 	return obj != nil && obj.Type() == object.ERROR_OBJ
 }
 
-func evalProgram(stmts []ast.Statement) object.Object {
+func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range stmts {
-		result = Eval(stmt)
+		result = Eval(stmt, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
@@ -76,14 +152,18 @@ func evalProgram(stmts []ast.Statement) object.Object {
 	return result
 }
 
-func evalBlockStatements(stmts []ast.Statement) object.Object {
+func evalBlockStatements(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range stmts {
-		result = Eval(stmt)
-		if result != nil && result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+		result = Eval(stmt, env)
+		if result != nil && (result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ) {
 			return result
 		}
 	}
+	if result == nil {
+		// Blocks are values, even if empty or made of let statements.
+		return NULL
+	}
 	return result
 }
 
@@ -101,7 +181,7 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -121,7 +201,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 	value := right.(*object.Integer).Value
 	return &object.Integer{Value: -value}
@@ -129,18 +209,20 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	if left.Type() != right.Type() {
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	}
 
 	var evaluated object.Object = NULL
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		evaluated = evalIntegerInfixExpression(operator, left, right)
+	} else if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		evaluated = evalStringInfixExpression(operator, left, right)
 	} else {
 		evaluated = evalBooleanInfixExpression(operator, left, right)
 	}
 
 	if evaluated == NULL {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 	return evaluated
 }
@@ -157,6 +239,9 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: lval * rval}
 	case "/":
+		if rval == 0 {
+			return newError(object.VALUE_ERROR, "division by zero")
+		}
 		return &object.Integer{Value: lval / rval}
 	case ">":
 		return nativeBoolToBooleanObject(lval > rval)
@@ -171,6 +256,22 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	lval := left.(*object.String).Value
+	rval := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: lval + rval}
+	case "==":
+		return nativeBoolToBooleanObject(lval == rval)
+	case "!=":
+		return nativeBoolToBooleanObject(lval != rval)
+	default:
+		return NULL
+	}
+}
+
 func evalBooleanInfixExpression(operator string, left, right object.Object) object.Object {
 	switch operator {
 	case "==":
@@ -182,16 +283,16 @@ func evalBooleanInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
-func evalIfExpression(node *ast.IfExpression) object.Object {
-	c := Eval(node.Condition)
+func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
+	c := Eval(node.Condition, env)
 	if isError(c) {
 		return c
 	}
 	if isTruthy(c) {
-		return Eval(node.Consequence)
+		return Eval(node.Consequence, env)
 	}
 	if node.Alternative != nil {
-		return Eval(node.Alternative)
+		return Eval(node.Alternative, env)
 	}
 	return NULL
 }
@@ -200,6 +301,244 @@ func isTruthy(obj object.Object) bool {
 	return !(obj == NULL || obj == FALSE)
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// A resolved identifier is looked up by its address. A local slot which is
+// not bound yet, as when its let statement was skipped by an if, falls back
+// to the lookup by name of unresolved identifiers.
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if addr := node.Address; addr != nil {
+		switch addr.Scope {
+		case ast.LocalScope, ast.FreeScope:
+			if val := env.Slot(addr.Depth, addr.Slot); val != nil {
+				return val
+			}
+		case ast.BuiltinScope:
+			return builtins[node.Value]
+		}
+	}
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	return newError(object.REFERENCE_ERROR, "identifier not found: %s", node.Value)
+}
+
+// bind binds a name of a let statement, a catch clause or an import,
+// in its slot if it is a resolved local.
+func bind(name *ast.Identifier, val object.Object, env *object.Environment) {
+	if addr := name.Address; addr != nil && addr.Scope == ast.LocalScope {
+		env.SetSlot(addr.Slot, val)
+		return
+	}
+	env.Set(name.Value, val)
+}
+
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// Apply calls a function from Go code, as a builtin that takes a function
+// does. There is no call expression, so hooks are not told of the call
+// and an error raised by the function gets no frame for it.
+func Apply(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(nil, fn, args, nil)
+}
+
+func applyFunction(
+	call *ast.CallExpression,
+	fn object.Object,
+	args []object.Object,
+	env *object.Environment,
+) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		return builtin.Fn(args...)
+	}
+
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError(object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+	if len(args) != len(function.Parameters) {
+		return newError(
+			object.TYPE_ERROR,
+			"wrong number of arguments: want=%d, got=%d",
+			len(function.Parameters),
+			len(args),
+		)
+	}
+
+	extendedEnv := extendFunctionEnv(function, args)
+	hook := extendedEnv.Hook
+	if call == nil {
+		hook = nil
+	}
+	if hook != nil {
+		hook.Call(call, function, extendedEnv)
+	}
+	evaluated := unwrapReturnValue(Eval(function.Body, extendedEnv))
+	if hook != nil {
+		hook.Return(call, function, evaluated)
+	}
+
+	// The error leaves the callee, so the caller gets a frame at the call site.
+	if err, ok := evaluated.(*object.Error); ok && call != nil {
+		err.Stack = append(err.Stack, object.StackFrame{Function: env.Function, File: env.File, Pos: call.Pos()})
+		return err
+	}
+	return evaluated
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	var env *object.Environment
+	if fn.Locals != nil {
+		env = object.NewFunctionEnvironment(fn.Env, fn.Locals)
+	} else {
+		env = object.NewEnclosedEnvironment(fn.Env)
+	}
+	env.Function = fn.Name
+	if env.Function == "" {
+		env.Function = "<anonymous>"
+	}
+	for i, param := range fn.Parameters {
+		bind(param, args[i], env)
+	}
+	return env
+}
+
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
+	}
+}
+
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return hash
+}
+
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	if members, ok := obj.(object.Members); ok {
+		if member, ok := members.Member(name); ok {
+			return member
+		}
+	}
+	return newError(object.TYPE_ERROR, "unknown member: %s.%s", obj.Type(), name)
+}
+
+func newThrownError(val object.Object) *object.Error {
+	switch val := val.(type) {
+	case *object.ErrorValue:
+		// Rethrowing a caught error starts a new stack from here.
+		return newError(val.Error.Kind, "%s", val.Error.Message)
+	case *object.String:
+		return newError(object.THROWN_ERROR, "%s", val.Value)
+	default:
+		return newError(object.THROWN_ERROR, "%s", val.Inspect())
+	}
+}
+
+// The catch block runs in an environment of its own, where the error is
+// bound, and the finally block runs last whatever happened before it.
+// The result of the finally block is discarded unless it returns or raises.
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		var catchEnv *object.Environment
+		if node.CatchLocals != nil {
+			catchEnv = object.NewFunctionEnvironment(env, node.CatchLocals)
+		} else {
+			catchEnv = object.NewEnclosedEnvironment(env)
+		}
+		catchEnv.Function = env.Function
+		bind(node.Param, &object.ErrorValue{Error: err}, catchEnv)
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		finally := Eval(node.Finally, env)
+		if finally != nil && (finally.Type() == object.RETURN_VALUE_OBJ || finally.Type() == object.ERROR_OBJ) {
+			return finally
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
@@ -1,8 +1,14 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/internal/astgen"
 	"github.com/ryym/monkey/lexer"
 	"github.com/ryym/monkey/object"
 	"github.com/ryym/monkey/parser"
@@ -148,6 +154,14 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"let x = 0; 10 / x",
+			"division by zero",
+		},
+		{
+			"if (true) {} + 1",
+			"type mismatch: NULL + INTEGER",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -169,6 +183,18 @@ func TestErrorHandling(t *testing.T) {
 			`,
 			"unknown operator: BOOLEAN + BOOLEAN",
 		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			"let f = fn(x) { x }; f(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
+		{
+			"5()",
+			"not a function: INTEGER",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -182,11 +208,615 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+	if fn.Body.String() != "(x + 2)" {
+		t.Fatalf("body is not %q. got=%q", "(x + 2)", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+	fn(y) { x + y };
+};
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestApply(t *testing.T) {
+	add := testEval(`fn(x, y) { return x + y; }`)
+	testIntegerObject(t, Apply(add, &object.Integer{Value: 1}, &object.Integer{Value: 2}), 3)
+
+	err, ok := Apply(add, &object.Integer{Value: 1}).(*object.Error)
+	if !ok || err.Message != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong result of a call with missing arguments. got=%v", err)
+	}
+	if _, ok := Apply(&object.Integer{Value: 1}).(*object.Error); !ok {
+		t.Errorf("no error for calling an integer")
+	}
+}
+
+func TestResolvedEvaluation(t *testing.T) {
+	tests := []string{
+		`let newAdder = fn(x) { fn(y) { x + y } }; newAdder(2)(3)`,
+		`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)`,
+		`let f = fn(a, b) { let c = a * b; let g = fn() { c + a }; g() }; f(2, 3)`,
+		`let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10) }; f()`,
+		`let x = 1; let f = fn() { let y = x; let x = 10; x + y }; f()`,
+		`let x = 1; let f = fn(c) { if (c) { let x = 2 }; x }; [f(true), f(false)]`,
+		`let f = fn() { try { throw "oops" } catch (e) { e.message } }; f()`,
+		`let f = fn(x) { let outer = x; fn() { let x = outer + 1; x } }; f(1)()`,
+		`let f = fn(n) { puts; json_parse }; f(1)`,
+		`let f = fn() { y }; let y = 5; f()`,
+		`let f = fn() { 1 + true }; f()`,
+	}
+
+	for _, input := range tests {
+		want := inspect(testEval(input))
+		if got := inspect(testEvalResolved(t, input)); got != want {
+			t.Errorf("%q: resolved program gave %s instead of %s", input, got, want)
+		}
+	}
+}
+
+func TestFunctionEnvironmentSlots(t *testing.T) {
+	program := parser.New(lexer.New(`fn(a) { let b = a + 1; b }`)).ParseProgram()
+	Resolve(program, nil)
+
+	fn := Eval(program, object.NewEnvironment()).(*object.Function)
+	if len(fn.Locals) != 2 {
+		t.Fatalf("wrong locals. got=%v", fn.Locals)
+	}
+	env := extendFunctionEnv(fn, []object.Object{&object.Integer{Value: 1}})
+	testIntegerObject(t, env.Slot(0, 0), 1)
+	if env.Slot(0, 1) != nil {
+		t.Errorf("slot of b is bound before its let statement")
+	}
+	if _, ok := env.Get("a"); !ok {
+		t.Errorf("local a is not found by name")
+	}
+
+	Eval(fn.Body, env)
+	testIntegerObject(t, env.Slot(0, 1), 2)
+	if names := env.Names(); strings.Join(names, " ") != "a b" {
+		t.Errorf("wrong names. got=%v", names)
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+	x + true
+};
+let outer = fn() {
+	fn() { inner(1) }()
+};
+outer();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []string{
+		"at inner (2:4)",
+		"at <anonymous> (5:14)",
+		"at outer (5:19)",
+		"at <main> (7:6)",
+	}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack depth. want=%d, got=%d (%v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+	for i, frame := range errObj.Stack {
+		if frame.String() != expected[i] {
+			t.Errorf("stack[%d] wrong. want=%q, got=%q", i, expected[i], frame.String())
+		}
+	}
+}
+
+// recorder is a hook that records what it sees.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Before(node ast.Node, env *object.Environment) {
+	r.events = append(r.events, fmt.Sprintf("%T %s", node, node.Pos()))
+}
+
+func (r *recorder) Call(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	r.events = append(r.events, fmt.Sprintf("call %s %s", env.Function, call.Pos()))
+}
+
+func (r *recorder) Return(call *ast.CallExpression, fn *object.Function, result object.Object) {
+	r.events = append(r.events, fmt.Sprintf("return %s %s", fn.Name, result.Inspect()))
+}
+
+func TestHook(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) { x };\nf(1)")).ParseProgram()
+	r := &recorder{}
+	env := object.NewEnvironment()
+	env.Hook = r
+	testIntegerObject(t, Eval(program, env), 1)
+
+	expected := []string{
+		"*ast.Program 1:1",
+		"*ast.LetStatement 1:1",
+		"*ast.FunctionLiteral 1:9",
+		"*ast.ExpressionStatement 2:1",
+		"*ast.CallExpression 2:2",
+		"*ast.Identifier 2:1",
+		"*ast.IntegerLiteral 2:3",
+		"call f 2:2",
+		"*ast.BlockStatement 1:15",
+		"*ast.ExpressionStatement 1:17",
+		"*ast.Identifier 1:17",
+		"return f 1",
+	}
+	if strings.Join(r.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nwant=%q\ngot= %q", expected, r.events)
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"Hello World!"`, "Hello World!"},
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { 2 }`, 2},
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+		{`try { throw "boom" } catch (e) { e.kind }`, "Error"},
+		{`try { throw 5 } catch (e) { e.message }`, "5"},
+		{`try { 1 + true } catch (e) { e.kind }`, "TypeError"},
+		{`try { 1 + true } catch (e) { e.message }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { -true } catch (e) { e.message }`, "unknown operator: -BOOLEAN"},
+		{`try { foo } catch (e) { e.kind }`, "ReferenceError"},
+		{
+			`let f = fn() { throw "inner" };
+			let g = fn() { f() };
+			try { g() } catch (e) { e.message }`,
+			"inner",
+		},
+		{
+			`try {
+				try { throw "first" } catch (e) { throw e }
+			} catch (e) { e.message }`,
+			"first",
+		},
+		{
+			`let f = fn() {
+				try { return 1 } finally { 2 }
+			};
+			f()`,
+			1,
+		},
+		{
+			`let f = fn() {
+				try { return 1 } finally { return 2 }
+			};
+			f()`,
+			2,
+		},
+		{
+			// The x of the catch block is its own, and gone by the finally block.
+			`let x = 1;
+			try { throw "x" } catch (e) { let x = 2 } finally { let x = x * 10 };
+			x`,
+			10,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestCatchScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let e = 5; try { throw "boom" } catch (e) { 1 }; e`, 5},
+		{`let f = fn() { let e = 5; try { throw "boom" } catch (e) { 1 }; e }; f()`, 5},
+		{`let f = fn(e) { try { throw "boom" } catch (e) { 1 }; e }; f(5)`, 5},
+		{`let f = fn() { let n = 2; try { throw "boom" } catch (e) { let m = n * 3; m } }; f()`, 6},
+		{`let g = try { throw "boom" } catch (e) { fn() { e.message } }; g()`, "boom"},
+		{`let f = fn() { try { throw "a" } catch (e) { try { throw "b" } catch (e) { 1 }; e.message } }; f()`, "a"},
+	}
+	for _, tt := range tests {
+		for _, evaluated := range []object.Object{testEval(tt.input), testEvalResolved(t, tt.input)} {
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				testStringObject(t, evaluated, expected)
+			}
+		}
+	}
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedKind    string
+		expectedMessage string
+	}{
+		{`throw "boom"; 1`, "Error", "boom"},
+		{`try { throw "a" } finally { 1 }`, "Error", "a"},
+		{`try { 1 } finally { throw "b" }`, "Error", "b"},
+		{`try { throw "a" } catch (e) { throw "c" }`, "Error", "c"},
+		{`try { throw "a" } catch (e) { e.foo }`, "TypeError", "unknown member: ERROR_VALUE.foo"},
+		{`5.foo`, "TypeError", "unknown member: INTEGER.foo"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind. expected=%q, got=%q", tt.expectedKind, errObj.Kind)
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestCaughtErrorStack(t *testing.T) {
+	input := `let fail = fn() { throw "boom" };
+let run = fn() {
+	try { fail() } catch (e) { e.stack }
+};
+run()`
+
+	expected := "at fail (1:19)\nat run (3:12)"
+	testStringObject(t, testEval(input), expected)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`5[0]`, "index operator not supported: INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var out bytes.Buffer
+	orig := Stdout
+	Stdout = &out
+	defer func() { Stdout = orig }()
+
+	evaluated := testEval(`puts("a", 1, [true]); puts()`)
+	testNullObject(t, evaluated)
+
+	if want := "a 1 [true]\n\n"; out.String() != want {
+		t.Errorf("wrong output. want=%q, got=%q", want, out.String())
+	}
+}
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("1")`, "1"},
+		{`json_parse("-42")`, "-42"},
+		{`json_parse("true")`, "true"},
+		{`json_parse("\"hi\\n\"")`, "hi\n"},
+		{`json_parse("[1, [2, \"x\"], {}]")`, "[1, [2, x], {}]"},
+		{`json_parse("{\"b\": 1, \"a\": {\"d\": null, \"c\": false}}")`, "{b: 1, a: {d: null, c: false}}"},
+		{`json_parse("{\"a\": 1, \"b\": 2, \"a\": 3}")`, "{a: 3, b: 2}"},
+		{`json_parse("{\"a\": [1, 2]}")["a"][1]`, "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	testNullObject(t, testEval(`json_parse("null")`))
+	testNullObject(t, testEval(`json_parse("[null]")[0]`))
+}
+
+func TestJSONStringify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_stringify(1)`, "1"},
+		{`json_stringify("a\"b<")`, `"a\"b<"`},
+		{`json_stringify(if (false) { 1 })`, "null"},
+		{`json_stringify([1, true, "x", [], {}])`, `[1,true,"x",[],{}]`},
+		{`json_stringify({"z": 1, "a": [2]})`, `{"z":1,"a":[2]}`},
+		{`json_stringify({"z": 1, "a": [2, 3]}, 2)`, "{\n  \"z\": 1,\n  \"a\": [\n    2,\n    3\n  ]\n}"},
+		{`json_stringify([1], "\t")`, "[\n\t1\n]"},
+		{`json_stringify({"a": []}, 2)`, "{\n  \"a\": []\n}"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `{"name":"monkey","tags":["a","b"],"nested":{"z":null,"y":-1,"x":true}}`
+
+	evaluated := testEval("json_stringify(json_parse(\"" + strings.ReplaceAll(input, `"`, `\"`) + "\"))")
+	testStringObject(t, evaluated, input)
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedKind    string
+		expectedMessage string
+	}{
+		{`json_parse("1.5")`, "ValueError", "json_parse: number 1.5 is not a 64-bit integer"},
+		{`json_parse("[1,")`, "ValueError", "json_parse: unexpected end of JSON input"},
+		{`json_parse("1 2")`, "ValueError", "json_parse: unexpected data after top-level value"},
+		{`json_parse(1)`, "TypeError", "argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_parse()`, "TypeError", "wrong number of arguments: want=1, got=0"},
+		{`json_stringify(fn(x) { x })`, "TypeError", "json_stringify: cannot encode FUNCTION"},
+		{`json_stringify({"f": [json_parse]})`, "TypeError", "json_stringify: cannot encode BUILTIN"},
+		{`json_stringify({1: 2})`, "TypeError", "json_stringify: object key must be STRING, got INTEGER"},
+		{`json_stringify(1, true)`, "TypeError", "indent of `json_stringify` must be INTEGER or STRING, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("%s: wrong error kind. expected=%q, got=%q", tt.input, tt.expectedKind, errObj.Kind)
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestJSONStringifyCycle(t *testing.T) {
+	array := &object.Array{}
+	hash := object.NewHash()
+	key := &object.String{Value: "self"}
+	hash.Set(key.HashKey(), object.HashPair{Key: key, Value: array})
+	array.Elements = []object.Object{hash}
+
+	evaluated := stringifyJSON(array, "")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "json_stringify: cycle detected in ARRAY" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	// The same value can appear twice without being a cycle.
+	shared := &object.Array{Elements: []object.Object{TRUE}}
+	evaluated = stringifyJSON(&object.Array{Elements: []object.Object{shared, shared}}, "")
+	testStringObject(t, evaluated, "[[true],[true]]")
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	return Eval(program)
+	env := object.NewEnvironment()
+	return Eval(program, env)
+}
+
+// testEvalResolved evaluates the input after resolving it, which must
+// succeed.
+func testEvalResolved(t *testing.T, input string) object.Object {
+	t.Helper()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if diags := Resolve(program, nil); len(diags) > 0 {
+		t.Fatalf("%q: resolve errors: %v", input, diags)
+	}
+	return Eval(program, object.NewEnvironment())
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -222,3 +852,132 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+// evalTwice evaluates a program in two fresh environments, and fails
+// unless both give the same result.
+func evalTwice(t *testing.T, program *ast.Program) object.Object {
+	t.Helper()
+	orig := Stdout
+	Stdout = ioutil.Discard
+	defer func() { Stdout = orig }()
+
+	first := Eval(program, object.NewEnvironment())
+	second := Eval(program, object.NewEnvironment())
+	if inspect(first) != inspect(second) {
+		t.Fatalf("results differ: %s and %s\n%s", inspect(first), inspect(second), program)
+	}
+	return first
+}
+
+// inspect describes a result for comparisons. An empty program gives nil.
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return string(obj.Type()) + " " + obj.Inspect()
+}
+
+// FuzzEval evaluates random well-typed programs, which must succeed
+// and give the same result every time, whether resolved or not.
+func FuzzEval(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		program := astgen.New(seed).Program()
+		result := evalTwice(t, program)
+		if err, ok := result.(*object.Error); ok {
+			t.Fatalf("well-typed program failed: %s\n%s", err, program)
+		}
+
+		resolved := astgen.New(seed).Program()
+		if diags := Resolve(resolved, nil); len(diags) > 0 {
+			t.Fatalf("well-typed program has resolve errors: %v\n%s", diags, resolved)
+		}
+		if got := evalTwice(t, resolved); inspect(got) != inspect(result) {
+			t.Fatalf("resolved program gave %s instead of %s\n%s", inspect(got), inspect(result), program)
+		}
+	})
+}
+
+// FuzzEvalSource evaluates any program without functions, which always
+// terminates, and checks that it does not panic and gives the same
+// result every time.
+func FuzzEvalSource(f *testing.F) {
+	for _, src := range []string{
+		"",
+		"1 + 2 * 3; -5 / 0",
+		`let h = {"a": [1, true]}; h["a"][1] == !false`,
+		`try { throw "x" } catch (e) { e.message + e.kind } finally { puts(1) }`,
+		`json_stringify(json_parse("[1, {\"a\": null}]"), 2)`,
+		`import "mod"; mod.x`,
+		`"a" - "b"; [1][5]; {}[fn]`,
+	} {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		p := parser.New(lexer.New(src))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			return
+		}
+		hasFunction := false
+		ast.Inspect(program, func(node ast.Node) bool {
+			if _, ok := node.(*ast.FunctionLiteral); ok {
+				hasFunction = true
+			}
+			return !hasFunction
+		})
+		if hasFunction {
+			return
+		}
+		evalTwice(t, program)
+	})
+}
+
+// BenchmarkEval compares the evaluation of a program with its names
+// resolved to slots and without, where they are looked up by name.
+func BenchmarkEval(b *testing.B) {
+	const input = `
+let fib = fn(n) {
+  let a = n - 1;
+  let b = n - 2;
+  if (n < 2) { n } else { fib(a) + fib(b) }
+};
+fib(15);
+`
+	for _, resolved := range []bool{true, false} {
+		name := "unresolved"
+		if resolved {
+			name = "resolved"
+		}
+		b.Run(name, func(b *testing.B) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			if resolved {
+				if diags := Resolve(program, nil); len(diags) > 0 {
+					b.Fatalf("resolve errors: %v", diags)
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package evaluator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/optimizer"
+	"github.com/ryym/monkey/parser"
+)
+
+// Extension is added to import paths that have none.
+const Extension = ".mk"
+
+// Loader imports modules from source files. Each file is evaluated once
+// in its own environment, and importing it again gives the same module.
+//
+// A path is resolved from the directory of the importing file first.
+// Unless it starts with "./" or "../", the directories of the search
+// path are tried next, in order.
+type Loader struct {
+	Path []string // The search path
+
+	// Hook is set on the environments of the modules, which are not
+	// optimized then so that the hook sees them as written.
+	Hook object.Hook
+
+	// Globals are the names that the host defines, which every module
+	// sees as well as the program importing it.
+	Globals map[string]object.Object
+
+	modules map[string]*object.Module // By absolute path
+	root    string                    // The file that started the import chain
+	loading []loadingFile             // The import chain, outermost first
+}
+
+type loadingFile struct {
+	file string // As resolved, for messages
+	abs  string
+}
+
+func NewLoader(path []string) *Loader {
+	return &Loader{Path: path, Globals: make(map[string]object.Object), modules: make(map[string]*object.Module)}
+}
+
+func (l *Loader) Import(path, from string) object.Object {
+	if len(l.loading) == 0 {
+		l.root = from
+	}
+
+	file, ok := l.resolve(path, from)
+	if !ok {
+		return newError(object.IMPORT_ERROR, "cannot find module %q%s", path, l.chain())
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return newError(object.IMPORT_ERROR, "cannot import %q: %s", path, err)
+	}
+
+	if mod, ok := l.modules[abs]; ok {
+		return mod
+	}
+	for i, f := range l.loading {
+		if f.abs == abs {
+			cycle := []string{}
+			for _, f := range l.loading[i:] {
+				cycle = append(cycle, f.file)
+			}
+			cycle = append(cycle, file)
+			return newError(object.IMPORT_ERROR, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	l.loading = append(l.loading, loadingFile{file: file, abs: abs})
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	mod, errObj := l.load(file)
+	if errObj != nil {
+		return errObj
+	}
+	l.modules[abs] = mod
+	return mod
+}
+
+// resolve finds the file of an import path.
+func (l *Loader) resolve(path, from string) (string, bool) {
+	name := filepath.FromSlash(path)
+	if filepath.Ext(name) == "" {
+		name += Extension
+	}
+
+	if filepath.IsAbs(name) {
+		return name, isFile(name)
+	}
+
+	dir := "."
+	if from != "" {
+		dir = filepath.Dir(from)
+	}
+	candidates := []string{filepath.Join(dir, name)}
+	if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		for _, d := range l.Path {
+			candidates = append(candidates, filepath.Join(d, name))
+		}
+	}
+
+	for _, c := range candidates {
+		if isFile(c) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// load evaluates a module while it is the last one of the import chain.
+func (l *Loader) load(file string) (*object.Module, object.Object) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, newError(object.IMPORT_ERROR, "cannot read module: %s%s", err, l.chain())
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, newError(object.IMPORT_ERROR, "parse error in %s: %s%s",
+			file, strings.Join(p.Errors(), "; "), l.chain())
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	env := object.NewEnvironment()
+	for global, value := range l.Globals {
+		env.Set(global, value)
+	}
+
+	if diags := Resolve(program, env); len(diags) > 0 {
+		msgs := make([]string, len(diags))
+		for i, d := range diags {
+			msgs[i] = d.String()
+		}
+		return nil, newError(object.IMPORT_ERROR, "resolve error in %s: %s%s",
+			file, strings.Join(msgs, "; "), l.chain())
+	}
+	if l.Hook == nil {
+		optimizer.Optimize(program)
+	}
+
+	env.Function = "<module " + name + ">"
+	env.File = file
+	env.Importer = l
+	env.Hook = l.Hook
+
+	if result := Eval(program, env); isError(result) {
+		return nil, result
+	}
+
+	return &object.Module{Name: name, Path: file, Env: env, Exports: exports(program)}, nil
+}
+
+// exports returns the names bound by top-level let statements,
+// except for the private ones starting with an underscore.
+func exports(program *ast.Program) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		name := let.Name.Value
+		if strings.HasPrefix(name, "_") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// chain describes the import chain for error messages.
+func (l *Loader) chain() string {
+	files := []string{}
+	if l.root != "" {
+		files = append(files, l.root)
+	}
+	for _, f := range l.loading {
+		files = append(files, f.file)
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (import chain: %s)", strings.Join(files, " -> "))
+}
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if env.Importer == nil {
+		return newError(object.IMPORT_ERROR, "cannot import %q: imports are not enabled", node.Path.Value)
+	}
+
+	mod := env.Importer.Import(node.Path.Value, env.File)
+	if err, ok := mod.(*object.Error); ok {
+		// An error raised inside the module gets the import site as its caller.
+		if len(err.Stack) > 0 {
+			err.Stack = append(err.Stack, object.StackFrame{Function: env.Function, File: env.File, Pos: node.Pos()})
+		}
+		return err
+	}
+
+	bind(node.Name, mod, env)
+	return nil
+}
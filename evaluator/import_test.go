@@ -0,0 +1,201 @@
+package evaluator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ryym/monkey/internal/scripttest"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+)
+
+// testEvalFile evaluates a file the way a script is run.
+func testEvalFile(t *testing.T, file string, searchPath ...string) object.Object {
+	t.Helper()
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	checkNoParseErrors(t, p)
+
+	env := object.NewEnvironment()
+	env.File = file
+	env.Importer = NewLoader(searchPath)
+	return Eval(program, env)
+}
+
+func checkNoParseErrors(t *testing.T, p *parser.Parser) {
+	t.Helper()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"main.mk": `
+			import "lib/math";
+			import "./lib/greet.mk";
+			greet.hello(math.double(21));
+		`,
+		"lib/math.mk": `
+			let double = fn(x) { x * _two };
+			let _two = 2;
+		`,
+		"lib/greet.mk": `
+			import "math";
+			let hello = fn(n) { "hello " + json_stringify(math.double(n)) };
+		`,
+	})
+
+	evaluated := testEvalFile(t, filepath.Join(dir, "main.mk"))
+	testStringObject(t, evaluated, "hello 84")
+}
+
+func TestImportEvaluatesModulesOnce(t *testing.T) {
+	var out bytes.Buffer
+	orig := Stdout
+	Stdout = &out
+	defer func() { Stdout = orig }()
+
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"main.mk": `import "a"; import "b"; a.counter == b.counter`,
+		"a.mk":    `import "counter"; let counter = counter;`,
+		"b.mk":    `import "./counter"; let counter = counter;`,
+		"counter.mk": `
+			puts("loading");
+			let value = 1;
+		`,
+	})
+
+	evaluated := testEvalFile(t, filepath.Join(dir, "main.mk"))
+	testBooleanObject(t, evaluated, true)
+	if out.String() != "loading\n" {
+		t.Errorf("module not evaluated once. output=%q", out.String())
+	}
+}
+
+func TestImportSearchPath(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"app/main.mk":     `import "util"; import "shadowed"; [util.name, shadowed.name]`,
+		"app/shadowed.mk": `let name = "local";`,
+		"lib/util.mk":     `let name = "util";`,
+		"lib/shadowed.mk": `let name = "lib";`,
+	})
+
+	evaluated := testEvalFile(t, filepath.Join(dir, "app", "main.mk"), filepath.Join(dir, "lib"))
+	if evaluated.Inspect() != "[util, local]" {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"missing.mk":   `import "nope";`,
+		"indirect.mk":  `import "missing";`,
+		"relative.mk":  `import "./util";`,
+		"lib/util.mk":  `let x = 1;`,
+		"cycle_a.mk":   `import "cycle_b";`,
+		"cycle_b.mk":   `import "cycle_c";`,
+		"cycle_c.mk":   `import "cycle_a";`,
+		"broken.mk":    `import "syntax";`,
+		"syntax.mk":    `let x = ;`,
+		"unbound.mk":   `import "undefined";`,
+		"undefined.mk": `let f = fn() { nope };`,
+		"private.mk":   `import "priv"; priv._secret`,
+		"priv.mk":      `let _secret = 1;`,
+		"notmodule.mk": `import "priv"; priv.missing`,
+	})
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{
+			"missing.mk",
+			`cannot find module "nope" (import chain: ` + file("missing.mk") + `)`,
+		},
+		{
+			"indirect.mk",
+			`cannot find module "nope" (import chain: ` + file("indirect.mk") + " -> " + file("missing.mk") + `)`,
+		},
+		{
+			"relative.mk",
+			`cannot find module "./util" (import chain: ` + file("relative.mk") + `)`,
+		},
+		{
+			"cycle_a.mk",
+			"import cycle: " + file("cycle_b.mk") + " -> " + file("cycle_c.mk") + " -> " +
+				file("cycle_a.mk") + " -> " + file("cycle_b.mk"),
+		},
+		{
+			"broken.mk",
+			"parse error in " + file("syntax.mk") + ": no prefix parse function for ; found" +
+				" (import chain: " + file("broken.mk") + " -> " + file("syntax.mk") + ")",
+		},
+		{
+			"unbound.mk",
+			"resolve error in " + file("undefined.mk") + ": 1:16: undefined: nope" +
+				" (import chain: " + file("unbound.mk") + " -> " + file("undefined.mk") + ")",
+		},
+		{"private.mk", "unknown member: MODULE._secret"},
+		{"notmodule.mk", "unknown member: MODULE.missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalFile(t, file(tt.file), filepath.Join(dir, "lib"))
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", tt.file, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message.\nwant=%q\ngot= %q", tt.file, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestImportStackTrace(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"main.mk": "import \"lib\";\n",
+		"lib.mk":  "let f = fn() { throw \"boom\" };\nf();\n",
+	})
+	main := filepath.Join(dir, "main.mk")
+	lib := filepath.Join(dir, "lib.mk")
+
+	errObj, ok := testEvalFile(t, main).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	expected := []string{
+		"at f (" + lib + ":1:16)",
+		"at <module lib> (" + lib + ":2:2)",
+		"at <main> (" + main + ":1:1)",
+	}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack length. want=%d, got=%d (%v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+	for i, frame := range errObj.Stack {
+		if frame.String() != expected[i] {
+			t.Errorf("wrong frame %d. want=%q, got=%q", i, expected[i], frame.String())
+		}
+	}
+}
+
+func TestImportNotEnabled(t *testing.T) {
+	evaluated := testEval(`import "x"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if want := `cannot import "x": imports are not enabled`; errObj.Message != want {
+		t.Errorf("wrong error message. want=%q, got=%q", want, errObj.Message)
+	}
+}
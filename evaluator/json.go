@@ -0,0 +1,211 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ryym/monkey/object"
+)
+
+// parseJSON decodes a JSON text token by token rather than with
+// json.Unmarshal so that the key order of objects is kept.
+func parseJSON(input string) object.Object {
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+
+	value, err := decodeJSONValue(dec)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return value
+		}
+		err = errors.New("unexpected data after top-level value")
+	}
+	return newError(object.VALUE_ERROR, "json_parse: %s", err)
+}
+
+func decodeJSONValue(dec *json.Decoder) (object.Object, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, errors.New("unexpected end of JSON input")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			return decodeJSONArray(dec)
+		}
+		return decodeJSONObject(dec)
+	case json.Number:
+		n, err := strconv.ParseInt(tok.String(), 10, 64)
+		if err != nil {
+			return nil, errors.New("number " + tok.String() + " is not a 64-bit integer")
+		}
+		return &object.Integer{Value: n}, nil
+	case string:
+		return &object.String{Value: tok}, nil
+	case bool:
+		return nativeBoolToBooleanObject(tok), nil
+	default:
+		return NULL, nil
+	}
+}
+
+func decodeJSONArray(dec *json.Decoder) (object.Object, error) {
+	elements := []object.Object{}
+	for dec.More() {
+		el, err := decodeJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, el)
+	}
+	if _, err := dec.Token(); err != nil { // ']'
+		return nil, err
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+func decodeJSONObject(dec *json.Decoder) (object.Object, error) {
+	hash := object.NewHash()
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := &object.String{Value: tok.(string)}
+
+		value, err := decodeJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(key.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+	if _, err := dec.Token(); err != nil { // '}'
+		return nil, err
+	}
+	return hash, nil
+}
+
+func stringifyJSON(obj object.Object, indent string) object.Object {
+	e := &jsonEncoder{indent: indent, visiting: make(map[object.Object]bool)}
+	if err := e.encode(obj, 0); err != nil {
+		return err
+	}
+	return &object.String{Value: e.out.String()}
+}
+
+type jsonEncoder struct {
+	out    bytes.Buffer
+	indent string
+
+	// Containers being encoded, to detect cycles.
+	visiting map[object.Object]bool
+}
+
+func (e *jsonEncoder) encode(obj object.Object, depth int) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *object.Boolean:
+		e.out.WriteString(strconv.FormatBool(obj.Value))
+	case *object.Null:
+		e.out.WriteString("null")
+	case *object.String:
+		e.writeString(obj.Value)
+
+	case *object.Array:
+		if e.visiting[obj] {
+			return newError(object.VALUE_ERROR, "json_stringify: cycle detected in ARRAY")
+		}
+		e.visiting[obj] = true
+		defer delete(e.visiting, obj)
+
+		e.out.WriteByte('[')
+		for i, el := range obj.Elements {
+			if i > 0 {
+				e.out.WriteByte(',')
+			}
+			e.newline(depth + 1)
+			if err := e.encode(el, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(obj.Elements) > 0 {
+			e.newline(depth)
+		}
+		e.out.WriteByte(']')
+
+	case *object.Hash:
+		if e.visiting[obj] {
+			return newError(object.VALUE_ERROR, "json_stringify: cycle detected in HASH")
+		}
+		e.visiting[obj] = true
+		defer delete(e.visiting, obj)
+
+		pairs := obj.OrderedPairs()
+		fields := make([]object.RecordField, len(pairs))
+		for i, pair := range pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "json_stringify: object key must be STRING, got %s", pair.Key.Type())
+			}
+			fields[i] = object.RecordField{Name: key.Value, Value: pair.Value}
+		}
+		return e.encodeObject(fields, depth)
+
+	case *object.Record:
+		return e.encodeObject(obj.Fields, depth)
+
+	default:
+		return newError(object.TYPE_ERROR, "json_stringify: cannot encode %s", obj.Type())
+	}
+	return nil
+}
+
+func (e *jsonEncoder) encodeObject(fields []object.RecordField, depth int) *object.Error {
+	e.out.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			e.out.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		e.writeString(f.Name)
+		e.out.WriteByte(':')
+		if e.indent != "" {
+			e.out.WriteByte(' ')
+		}
+		if err := e.encode(f.Value, depth+1); err != nil {
+			return err
+		}
+	}
+	if len(fields) > 0 {
+		e.newline(depth)
+	}
+	e.out.WriteByte('}')
+	return nil
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.out.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		e.out.WriteString(e.indent)
+	}
+}
+
+func (e *jsonEncoder) writeString(s string) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.out.Write(bytes.TrimRight(buf.Bytes(), "\n"))
+}
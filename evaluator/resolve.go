@@ -0,0 +1,18 @@
+package evaluator
+
+import (
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/resolver"
+)
+
+// Resolve resolves a program to run in an environment, whose names are
+// globals along with the builtins. The environment may be nil for a
+// program that runs in a new one, such as a module.
+func Resolve(program *ast.Program, env *object.Environment) []resolver.Diagnostic {
+	var globals []string
+	if env != nil {
+		globals = env.Names()
+	}
+	return resolver.Resolve(program, resolver.NewGlobalTable(globals, BuiltinNames()))
+}
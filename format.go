@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/format"
+	"github.com/ryym/monkey/internal/diff"
+)
+
+type formatOptions struct {
+	write bool
+	list  bool
+	diff  bool
+}
+
+// formatFiles formats the given files, and the Monkey files found in the
+// given directories. Without paths, it formats the standard input.
+func (c *cli) formatFiles(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		io.WriteString(c.stderr, "usage: monkey fmt [-w] [-l] [-d] [path...]\n")
+		flags.PrintDefaults()
+	}
+	var opts formatOptions
+	flags.BoolVar(&opts.write, "w", false, "write the result to the file instead of stdout")
+	flags.BoolVar(&opts.list, "l", false, "list the files whose formatting differs")
+	flags.BoolVar(&opts.diff, "d", false, "show diffs instead of the formatted source")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		if opts.write {
+			io.WriteString(c.stderr, "monkey fmt: cannot use -w with standard input\n")
+			return exitUsage
+		}
+		src, err := ioutil.ReadAll(c.stdin)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey fmt: %s\n", err)
+			return exitError
+		}
+		if !c.formatSource("<standard input>", src, opts) {
+			return exitError
+		}
+		return exitOK
+	}
+
+	code := exitOK
+	for _, path := range flags.Args() {
+		err := walkScripts(path, func(file string) {
+			if !c.formatFile(file, opts) {
+				code = exitError
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey fmt: %s\n", err)
+			code = exitError
+		}
+	}
+	return code
+}
+
+// walkScripts calls fn with the path if it is a file, or with each Monkey
+// file found in it if it is a directory. Files are taken whatever their
+// names, unless found in a directory. An empty path is given as it is.
+func walkScripts(path string, fn func(file string)) error {
+	if path == "" {
+		fn(path)
+		return nil
+	}
+	return filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || file != path && !strings.HasSuffix(file, evaluator.Extension) {
+			return nil
+		}
+		fn(file)
+		return nil
+	})
+}
+
+func (c *cli) formatFile(path string, opts formatOptions) bool {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey fmt: %s\n", err)
+		return false
+	}
+	return c.formatSource(path, src, opts)
+}
+
+// formatSource formats a source and outputs the result as the options
+// tell. It reports whether the source could be formatted.
+func (c *cli) formatSource(name string, src []byte, opts formatOptions) bool {
+	formatted, err := format.Source(src)
+	if err != nil {
+		if perr, ok := err.(*format.ParseError); ok {
+			fmt.Fprintf(c.stderr, "%s: parse error\n", name)
+			for _, msg := range perr.Errors {
+				fmt.Fprintf(c.stderr, "\t%s\n", msg)
+			}
+		} else {
+			fmt.Fprintf(c.stderr, "%s: %s\n", name, err)
+		}
+		return false
+	}
+
+	changed := !bytes.Equal(src, formatted)
+	if opts.list && changed {
+		fmt.Fprintln(c.stdout, name)
+	}
+	if opts.write && changed {
+		info, err := os.Stat(name)
+		if err == nil {
+			err = ioutil.WriteFile(name, formatted, info.Mode().Perm())
+		}
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey fmt: %s\n", err)
+			return false
+		}
+	}
+	if opts.diff && changed {
+		io.WriteString(c.stdout, diff.Unified(name+".orig", name, string(src), string(formatted)))
+	}
+	if !opts.list && !opts.write && !opts.diff {
+		c.stdout.Write(formatted)
+	}
+	return true
+}
@@ -0,0 +1,443 @@
+// Package format prints Monkey programs in the canonical style.
+//
+// Statements are put on their own lines and blocks are indented with
+// tabs. Parentheses are only kept where the precedences of the parser
+// require them. A few layout choices of the source are preserved:
+// single blank lines between statements, blocks written on one line,
+// and array, hash and argument lists whose first element starts on a
+// new line, which are printed one element per line. Comments are kept
+// in place, except that comments inside an expression printed on one
+// line move to the end of that line.
+package format
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+	tk "github.com/ryym/monkey/token"
+)
+
+// ParseError is returned for source that cannot be parsed.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Errors, "; ")
+}
+
+// Source formats a program. Formatting the result again gives the same result.
+// A `#!` line at the start, which the lexer skips, is kept as it is.
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	pr := newPrinter(string(src), l.Comments())
+	pr.program(program)
+	return []byte(shebang(src) + pr.out.String()), nil
+}
+
+// shebang returns the `#!` line that starts a source with its newline, or
+// an empty string if there is none.
+func shebang(src []byte) string {
+	if !bytes.HasPrefix(src, []byte("#!")) {
+		return ""
+	}
+	if i := bytes.IndexByte(src, '\n'); i >= 0 {
+		src = src[:i]
+	}
+	return string(src) + "\n"
+}
+
+// Node formats a node without its source. Blocks and lists are printed
+// with their default layout and there are no comments.
+func Node(node ast.Node) string {
+	pr := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.program(node)
+	case ast.Statement:
+		pr.statement(node, false)
+	case ast.Expression:
+		pr.expression(node, parser.LOWEST)
+	}
+	return pr.out.String()
+}
+
+// primary is the precedence of expressions that never need parentheses.
+const primary = parser.INDEX + 1
+
+type printer struct {
+	out         strings.Builder
+	indent      int
+	atLineStart bool
+	blockStart  bool // Nothing has been printed in the current block yet
+
+	// The source layout, empty when printing a node alone.
+	tokens   []tk.Token
+	closing  map[tk.Position]tk.Position // Closing brackets by opening ones
+	comments []tk.Comment
+	next     int // The first comment not printed yet
+	end      tk.Position
+}
+
+func newPrinter(src string, comments []tk.Comment) *printer {
+	p := &printer{comments: comments, closing: make(map[tk.Position]tk.Position)}
+
+	l := lexer.New(src)
+	opening := []tk.Position{}
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		p.tokens = append(p.tokens, tok)
+		switch tok.Type {
+		case tk.LPAREN, tk.LBRACE, tk.LBRACKET:
+			opening = append(opening, tok.Pos)
+		case tk.RPAREN, tk.RBRACE, tk.RBRACKET:
+			if n := len(opening); n > 0 {
+				p.closing[opening[n-1]] = tok.Pos
+				opening = opening[:n-1]
+			}
+		}
+		if tok.Type == tk.EOF {
+			p.end = tok.Pos
+			break
+		}
+	}
+	return p
+}
+
+// Output
+
+func (p *printer) write(s string) {
+	if p.atLineStart {
+		p.out.WriteString(strings.Repeat("\t", p.indent))
+		p.atLineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+func (p *printer) lineBreak() {
+	if !p.atLineStart {
+		p.out.WriteString("\n")
+		p.atLineStart = true
+	}
+}
+
+// startLine starts a line for an item at the given source position,
+// keeping a blank line from the source before it.
+func (p *printer) startLine(pos tk.Position) {
+	p.lineBreak()
+	if !p.blockStart && p.tokens != nil && pos.Line-p.prevLine(pos) > 1 {
+		p.out.WriteString("\n")
+	}
+	p.blockStart = false
+}
+
+// prevLine returns the line of the last token or comment before pos.
+func (p *printer) prevLine(pos tk.Position) int {
+	line := 0
+	i := sort.Search(len(p.tokens), func(i int) bool { return !p.tokens[i].Pos.Before(pos) })
+	if i > 0 {
+		line = p.tokens[i-1].Pos.Line
+	}
+	j := sort.Search(len(p.comments), func(j int) bool { return !p.comments[j].Pos.Before(pos) })
+	if j > 0 && p.comments[j-1].Pos.Line > line {
+		line = p.comments[j-1].Pos.Line
+	}
+	return line
+}
+
+// flushComments prints the comments before pos. A trailing comment
+// stays on the current line, and the others get lines of their own.
+func (p *printer) flushComments(pos tk.Position) {
+	for ; p.next < len(p.comments) && p.comments[p.next].Pos.Before(pos); p.next++ {
+		c := p.comments[p.next]
+		if c.Trailing && !p.atLineStart {
+			p.write(" " + c.Text)
+		} else {
+			p.startLine(c.Pos)
+			p.write(c.Text)
+		}
+		p.lineBreak()
+	}
+}
+
+// hasComments reports whether there are comments left before pos.
+func (p *printer) hasComments(pos tk.Position) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Pos.Before(pos)
+}
+
+// closingOf returns the position of the bracket that closes the one
+// at pos, or the zero position if the source is not known.
+func (p *printer) closingOf(pos tk.Position) tk.Position {
+	return p.closing[pos]
+}
+
+// Statements
+
+func (p *printer) program(program *ast.Program) {
+	p.atLineStart = true
+	p.blockStart = true
+	p.statements(program.Statements)
+	p.flushComments(p.end)
+	p.lineBreak()
+	if strings.TrimSpace(p.out.String()) == "" {
+		p.out.Reset()
+	}
+}
+
+func (p *printer) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		p.flushComments(stmt.Pos())
+		p.startLine(stmt.Pos())
+		p.statement(stmt, false)
+	}
+}
+
+// statement prints a statement. A statement inlined in a one-line block
+// is not terminated with a semicolon if it is an expression.
+func (p *printer) statement(stmt ast.Statement, inline bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+		p.write(";")
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ImportStatement:
+		p.write("import \"" + stmt.Path.Token.Literal + "\";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+		if !inline && !endsWithBlock(stmt.Expression) {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+// endsWithBlock reports whether an expression statement looks like
+// a statement of its own, without a semicolon.
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.TryExpression:
+		return true
+	}
+	return false
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	closing := p.closingOf(block.Token.Pos)
+
+	if p.isOneLine(block, closing) {
+		if len(block.Statements) == 0 {
+			p.write("{}")
+			return
+		}
+		p.write("{ ")
+		p.statement(block.Statements[0], true)
+		p.write(" }")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.blockStart = true
+	p.statements(block.Statements)
+	p.flushComments(closing)
+	p.indent--
+	p.lineBreak()
+	p.write("}")
+	p.blockStart = false
+}
+
+// isOneLine reports whether a block is kept on one line: it must have
+// been written on one line, and have at most one statement that is
+// printed on one line too.
+func (p *printer) isOneLine(block *ast.BlockStatement, closing tk.Position) bool {
+	if p.tokens == nil {
+		return len(block.Statements) == 0
+	}
+	if closing.Line != block.Token.Pos.Line || len(block.Statements) > 1 || p.hasComments(closing) {
+		return false
+	}
+	if len(block.Statements) == 0 {
+		return true
+	}
+
+	sub := &printer{tokens: p.tokens, closing: p.closing}
+	sub.statement(block.Statements[0], true)
+	return !strings.Contains(sub.out.String(), "\n")
+}
+
+// Expressions
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression, *ast.MemberExpression, *ast.IndexExpression:
+		return parser.CALL
+	}
+	return primary
+}
+
+// expression prints an expression that is an operand of an operator
+// of the given precedence, with parentheses if it binds less tightly.
+func (p *printer) expression(exp ast.Expression, prec int) {
+	own := precedence(exp)
+	if own < prec {
+		p.write("(")
+		p.expression(exp, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(exp.Token.Literal)
+	case *ast.Boolean:
+		p.write(exp.Token.Literal)
+	case *ast.StringLiteral:
+		p.write("\"" + exp.Token.Literal + "\"")
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.expression(exp.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		// Operators are left-associative, so an operand on the right
+		// of the same precedence needs parentheses.
+		p.expression(exp.Left, own)
+		p.write(" " + exp.Operator + " ")
+		p.expression(exp.Right, own+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(exp.Block)
+		if exp.Catch != nil {
+			p.write(" catch (" + exp.Param.Value + ") ")
+			p.block(exp.Catch)
+		}
+		if exp.Finally != nil {
+			p.write(" finally ")
+			p.block(exp.Finally)
+		}
+	case *ast.FunctionLiteral:
+		params := make([]string, len(exp.Parameters))
+		for i, param := range exp.Parameters {
+			params[i] = param.Value
+		}
+		p.write("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.expression(exp.Function, parser.CALL)
+		p.list("(", ")", exp.Token.Pos, expressionNodes(exp.Arguments), func(i int) {
+			p.expression(exp.Arguments[i], parser.LOWEST)
+		})
+	case *ast.MemberExpression:
+		p.expression(exp.Object, parser.CALL)
+		p.write("." + exp.Property.Value)
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.CALL)
+		p.write("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.ArrayLiteral:
+		p.list("[", "]", exp.Token.Pos, expressionNodes(exp.Elements), func(i int) {
+			p.expression(exp.Elements[i], parser.LOWEST)
+		})
+	case *ast.HashLiteral:
+		keys := make([]ast.Node, len(exp.Pairs))
+		for i, pair := range exp.Pairs {
+			keys[i] = pair.Key
+		}
+		p.list("{", "}", exp.Token.Pos, keys, func(i int) {
+			p.expression(exp.Pairs[i].Key, parser.LOWEST)
+			p.write(": ")
+			p.expression(exp.Pairs[i].Value, parser.LOWEST)
+		})
+	}
+}
+
+func expressionNodes(exps []ast.Expression) []ast.Node {
+	nodes := make([]ast.Node, len(exps))
+	for i, exp := range exps {
+		nodes[i] = exp
+	}
+	return nodes
+}
+
+// list prints comma-separated items, given the nodes they start with.
+// The items are put on lines of their own if the first one started on
+// a new line in the source.
+func (p *printer) list(open, close string, pos tk.Position, items []ast.Node, printItem func(i int)) {
+	multiLine := len(items) > 0 && p.tokens != nil && start(items[0]).Line != pos.Line
+
+	p.write(open)
+	if !multiLine {
+		for i := range items {
+			if i > 0 {
+				p.write(", ")
+			}
+			printItem(i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.indent++
+	p.blockStart = true
+	for i, item := range items {
+		p.flushComments(start(item))
+		p.startLine(start(item))
+		printItem(i)
+		if i < len(items)-1 {
+			p.write(",")
+		}
+	}
+	p.flushComments(p.closingOf(pos))
+	p.indent--
+	p.lineBreak()
+	p.write(close)
+	p.blockStart = false
+}
+
+// start returns the position of the first token of a node. The position
+// of an operator expression is that of its operator.
+func start(node ast.Node) tk.Position {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return start(node.Left)
+	case *ast.CallExpression:
+		return start(node.Function)
+	case *ast.MemberExpression:
+		return start(node.Object)
+	case *ast.IndexExpression:
+		return start(node.Left)
+	}
+	return node.Pos()
+}
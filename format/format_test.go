@@ -0,0 +1,269 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=1", "let x = 1;\n"},
+		{"let a = 1; let b = 2;", "let a = 1;\nlet b = 2;\n"},
+		{`import "lib/util"`, "import \"lib/util\";\n"},
+		{`"a\"b\n"`, "\"a\\\"b\\n\";\n"},
+		{"return 1; throw 2", "return 1;\nthrow 2;\n"},
+
+		// Parentheses
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"(1 - 2) - 3", "1 - 2 - 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"(a < b) == (c > d)", "a < b == c > d;\n"},
+		{"a == (b == c)", "a == (b == c);\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"-(-a)", "--a;\n"},
+		{"!(a)", "!a;\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"-(a[0])", "-a[0];\n"},
+		{"(f(1))(2)", "f(1)(2);\n"},
+		{"(a + b).c", "(a + b).c;\n"},
+		{"(a.b)[c](d)", "a.b[c](d);\n"},
+		{"(fn(x) { x })(1)", "fn(x) { x }(1);\n"},
+
+		// Blocks
+		{"if (x) { 1 } else { 2 }", "if (x) { 1 } else { 2 }\n"},
+		{"if (x) { 1; 2 }", "if (x) {\n\t1;\n\t2;\n}\n"},
+		{"if (x) {\n1 }", "if (x) {\n\t1;\n}\n"},
+		{"fn() {}", "fn() {};\n"},
+		{"fn() {\n}", "fn() {\n};\n"},
+		{"let f = fn(x) { return x; };", "let f = fn(x) { return x; };\n"},
+		{
+			"try { a } catch (e) { b } finally { c }",
+			"try { a } catch (e) { b } finally { c }\n",
+		},
+		{
+			"let f = fn() { if (a) {\nb } };",
+			"let f = fn() {\n\tif (a) {\n\t\tb;\n\t}\n};\n",
+		},
+
+		// Lists
+		{"[1,2,  3]", "[1, 2, 3];\n"},
+		{"{\"a\":1,\"b\":2,}", "{\"a\": 1, \"b\": 2};\n"},
+		{"f(1,\n2)", "f(1, 2);\n"},
+		{"f(\n1, 2)", "f(\n\t1,\n\t2\n);\n"},
+		{
+			"let h = {\n\"a\": [\n1], \"b\": 2};",
+			"let h = {\n\t\"a\": [\n\t\t1\n\t],\n\t\"b\": 2\n};\n",
+		},
+
+		// Blank lines
+		{"let a = 1;\n\n\n\nlet b = 2;", "let a = 1;\n\nlet b = 2;\n"},
+		{"\n\nlet a = 1;\n\n", "let a = 1;\n"},
+		{"if (x) {\n\n1\n\n}", "if (x) {\n\t1;\n}\n"},
+	}
+
+	for _, tt := range tests {
+		actual, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if string(actual) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// only", "// only\n"},
+		{
+			"// head\n\nlet a = 1; // a\n// b\nlet b = 2;\n// tail",
+			"// head\n\nlet a = 1; // a\n// b\nlet b = 2;\n// tail\n",
+		},
+		{
+			"let f = fn() { // open\n  // first\n  1\n  // last\n};",
+			"let f = fn() { // open\n\t// first\n\t1;\n\t// last\n};\n",
+		},
+		{
+			"if (x) {\n// nothing yet\n}",
+			"if (x) {\n\t// nothing yet\n}\n",
+		},
+		{
+			"let a = [\n  1, // one\n  // two\n  2\n  // end\n];",
+			"let a = [\n\t1, // one\n\t// two\n\t2\n\t// end\n];\n",
+		},
+		{
+			// A comment inside an expression printed on one line.
+			"f(1, // one\n  2);\nlet x = 1;",
+			"f(1, 2); // one\nlet x = 1;\n",
+		},
+		{
+			"f(1,\n// one\n2);",
+			"f(1, 2);\n// one\n",
+		},
+		{
+			// A one-line block with a comment is no longer on one line.
+			"if (x) { 1 } // c\nif (y) { 1 // d\n}",
+			"if (x) { 1 } // c\nif (y) {\n\t1; // d\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		actual, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if string(actual) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+// sample exercises every node type with comments in various places.
+const sample = `
+// Computes things.
+import "lib/math";
+
+let   add=fn(a,b){a+b};   // adds
+let x = (1 + 2) * 3 - (4 - 5) + -(6 + 7);
+
+let fact = fn(n) {
+  // Recursion
+  if (n > 1) { return n * fact(n - 1); } else { 1 }
+
+
+  let h = {"a": 1, "b": [1,2,
+     3]};
+  let list = [
+    1, // one
+    h["b"][0]
+  ];
+  try { throw "x" } catch (e) { puts(e.message) } finally { 0 }
+  // end of body
+};
+fact(3).y
+// footer
+`
+
+func TestSourceIsIdempotent(t *testing.T) {
+	first, err := Source([]byte(sample))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := Source(first)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("not idempotent.\nfirst:\n%s\nsecond:\n%s", first, second)
+	}
+}
+
+func TestSourceKeepsShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#!/usr/bin/env monkey\nlet x=1;\n", "#!/usr/bin/env monkey\nlet x = 1;\n"},
+		{"#!/usr/bin/env monkey\n\n// Comment\nputs( 1 )", "#!/usr/bin/env monkey\n// Comment\nputs(1);\n"},
+		{"#!/usr/bin/env monkey", "#!/usr/bin/env monkey\n"},
+	}
+
+	for _, tt := range tests {
+		first, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(first) != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, first)
+		}
+		second, err := Source(first)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(second) != string(first) {
+			t.Errorf("not idempotent for %q.\nfirst= %q\nsecond=%q", tt.input, first, second)
+		}
+	}
+}
+
+func TestSourceKeepsMeaning(t *testing.T) {
+	formatted, err := Source([]byte(sample))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if parsed(t, string(formatted)) != parsed(t, sample) {
+		t.Errorf("formatting changed the program.\nbefore=%s\nafter= %s", parsed(t, sample), parsed(t, string(formatted)))
+	}
+
+	// Every comment is kept.
+	for _, c := range []string{"// Computes things.", "// adds", "// Recursion", "// one", "// end of body", "// footer"} {
+		if strings.Count(string(formatted), c) != 1 {
+			t.Errorf("comment %q is lost", c)
+		}
+	}
+}
+
+// parsed returns the fully parenthesized form of a program.
+func parsed(t *testing.T, src string) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	return program.String()
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source([]byte("let = 1;"))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("err is not *ParseError. got=%T (%v)", err, err)
+	}
+	if len(perr.Errors) == 0 {
+		t.Errorf("no parse errors")
+	}
+}
+
+func TestNode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "1 + 2 * 3;\n"},
+		{"let f = fn(x) { x };", "let f = fn(x) {\n\tx;\n};\n"},
+		{"if (a) {} else { b }", "if (a) {} else {\n\tb;\n}\n"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parser errors: %q", p.Errors())
+		}
+
+		actual := Node(program)
+		if actual != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+
+	p := parser.New(lexer.New("(a + b) * c"))
+	program := p.ParseProgram()
+	if actual := Node(program.Statements[0]); actual != "(a + b) * c;" {
+		t.Errorf("wrong statement output. got=%q", actual)
+	}
+}
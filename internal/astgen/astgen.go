@@ -0,0 +1,333 @@
+// Package astgen generates random well-typed Monkey programs for property
+// tests and fuzzing.
+//
+// The programs terminate and never fail with a type error: every
+// expression is generated for a type, and uses only the variables bound
+// to values of that type. Functions take and return integers, and are
+// never recursive. Imports are not generated since they need files.
+package astgen
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	tk "github.com/ryym/monkey/token"
+)
+
+// Type is the type of a generated expression.
+type Type int
+
+const (
+	Int Type = iota
+	Bool
+	String
+	Array // Of integers
+	Hash  // From strings to integers
+	Func  // From an integer to an integer
+	numTypes
+)
+
+// Limits of the size of generated programs.
+const (
+	maxDepth      = 4 // Of nested expressions
+	maxStatements = 6 // In a program
+	maxElements   = 3 // Of arrays, hashes and blocks
+)
+
+// binding is a variable in scope.
+type binding struct {
+	name string
+	typ  Type
+}
+
+// Generator builds random programs. The same seed gives the same programs.
+type Generator struct {
+	rand  *rand.Rand
+	depth int
+	vars  []binding // In scope, outermost first
+	names int       // Used for unique variable names
+}
+
+func New(seed int64) *Generator {
+	return &Generator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Program returns a program of let statements and expressions.
+// The last statement is an expression giving the result of the program.
+func (g *Generator) Program() *ast.Program {
+	g.vars = nil
+	n := 1 + g.rand.Intn(maxStatements)
+	program := &ast.Program{Statements: []ast.Statement{}}
+	for i := 0; i < n-1; i++ {
+		program.Statements = append(program.Statements, g.statement())
+	}
+	program.Statements = append(program.Statements, g.expressionStatement(g.anyType()))
+	return program
+}
+
+func (g *Generator) anyType() Type {
+	return Type(g.rand.Intn(int(numTypes)))
+}
+
+func (g *Generator) statement() ast.Statement {
+	if g.rand.Intn(3) == 0 {
+		return g.expressionStatement(g.anyType())
+	}
+	return g.let(g.anyType())
+}
+
+func (g *Generator) let(typ Type) *ast.LetStatement {
+	name := g.newName("v")
+	value := g.Expression(typ)
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		fn.Name = name // As the parser does
+	}
+	// Bound after the value so that it cannot refer to itself.
+	g.vars = append(g.vars, binding{name, typ})
+	return &ast.LetStatement{Token: token(tk.LET, "let"), Name: ident(name), Value: value}
+}
+
+func (g *Generator) expressionStatement(typ Type) *ast.ExpressionStatement {
+	return &ast.ExpressionStatement{Expression: g.Expression(typ)}
+}
+
+// newName returns a name like `vb`. Identifiers are made of letters only.
+func (g *Generator) newName(prefix string) string {
+	g.names++
+	name := []byte(prefix)
+	for n := g.names; n > 0; n /= 26 {
+		name = append(name, byte('a'+n%26))
+	}
+	return string(name)
+}
+
+// Expression returns an expression of the given type using the
+// variables in scope.
+func (g *Generator) Expression(typ Type) ast.Expression {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	if g.depth >= maxDepth || g.rand.Intn(4) == 0 {
+		if v, ok := g.variable(typ); ok && g.rand.Intn(2) == 0 {
+			return v
+		}
+		return g.literal(typ)
+	}
+
+	switch g.rand.Intn(4) {
+	case 0:
+		return g.literal(typ)
+	case 1:
+		return g.ifExpression(typ)
+	}
+
+	switch typ {
+	case Int:
+		return g.intExpression()
+	case Bool:
+		return g.boolExpression()
+	case String:
+		if g.rand.Intn(2) == 0 {
+			return g.tryExpression(String)
+		}
+		return infix(g.Expression(String), "+", g.Expression(String))
+	}
+	if v, ok := g.variable(typ); ok {
+		return v
+	}
+	return g.literal(typ)
+}
+
+func (g *Generator) variable(typ Type) (ast.Expression, bool) {
+	candidates := []string{}
+	for _, v := range g.vars {
+		if v.typ == typ {
+			candidates = append(candidates, v.name)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	return ident(candidates[g.rand.Intn(len(candidates))]), true
+}
+
+func (g *Generator) literal(typ Type) ast.Expression {
+	switch typ {
+	case Int:
+		return integer(int64(g.rand.Intn(1000)))
+	case Bool:
+		if g.rand.Intn(2) == 0 {
+			return &ast.Boolean{Token: token(tk.TRUE, "true"), Value: true}
+		}
+		return &ast.Boolean{Token: token(tk.FALSE, "false"), Value: false}
+	case String:
+		return g.stringLiteral()
+	case Array:
+		elements := []ast.Expression{}
+		for i := g.rand.Intn(maxElements + 1); i > 0; i-- {
+			elements = append(elements, g.Expression(Int))
+		}
+		return &ast.ArrayLiteral{Token: token(tk.LBRACKET, "["), Elements: elements}
+	case Hash:
+		pairs := []*ast.HashPair{}
+		for i := g.rand.Intn(maxElements + 1); i > 0; i-- {
+			pairs = append(pairs, &ast.HashPair{Key: g.stringLiteral(), Value: g.Expression(Int)})
+		}
+		return &ast.HashLiteral{Token: token(tk.LBRACE, "{"), Pairs: pairs}
+	case Func:
+		return g.function()
+	}
+	panic("astgen: unknown type " + strconv.Itoa(int(typ)))
+}
+
+// stringChars are the characters of generated strings, including
+// those written with escape sequences.
+const stringChars = "abc xyz\"\\\n\t"
+
+func (g *Generator) stringLiteral() *ast.StringLiteral {
+	var value strings.Builder
+	for i := g.rand.Intn(5); i > 0; i-- {
+		value.WriteByte(stringChars[g.rand.Intn(len(stringChars))])
+	}
+	escaped := strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\t", `\t`).Replace(value.String())
+	return &ast.StringLiteral{Token: token(tk.STRING, escaped), Value: value.String()}
+}
+
+func (g *Generator) intExpression() ast.Expression {
+	switch g.rand.Intn(6) {
+	case 0:
+		return &ast.PrefixExpression{Token: token(tk.MINUS, "-"), Operator: "-", Right: g.Expression(Int)}
+	case 1:
+		// Divided by a literal which is not zero.
+		return infix(g.Expression(Int), "/", integer(int64(1+g.rand.Intn(9))))
+	case 2:
+		fn := g.Expression(Func)
+		return &ast.CallExpression{Token: token(tk.LPAREN, "("), Function: fn, Arguments: []ast.Expression{g.Expression(Int)}}
+	case 3:
+		// Index a literal within its bounds.
+		if g.rand.Intn(2) == 0 {
+			array := &ast.ArrayLiteral{Token: token(tk.LBRACKET, "["), Elements: []ast.Expression{}}
+			for i := 1 + g.rand.Intn(maxElements); i > 0; i-- {
+				array.Elements = append(array.Elements, g.Expression(Int))
+			}
+			index := integer(int64(g.rand.Intn(len(array.Elements))))
+			return &ast.IndexExpression{Token: token(tk.LBRACKET, "["), Left: array, Index: index}
+		}
+		key := g.stringLiteral()
+		hash := &ast.HashLiteral{Token: token(tk.LBRACE, "{"), Pairs: []*ast.HashPair{
+			{Key: key, Value: g.Expression(Int)},
+		}}
+		return &ast.IndexExpression{Token: token(tk.LBRACKET, "["), Left: hash, Index: key}
+	case 4:
+		return g.tryExpression(Int)
+	default:
+		ops := []string{"+", "-", "*"}
+		return infix(g.Expression(Int), ops[g.rand.Intn(len(ops))], g.Expression(Int))
+	}
+}
+
+func (g *Generator) boolExpression() ast.Expression {
+	switch g.rand.Intn(3) {
+	case 0:
+		return &ast.PrefixExpression{Token: token(tk.BANG, "!"), Operator: "!", Right: g.Expression(Bool)}
+	case 1:
+		ops := []string{"==", "!="}
+		return infix(g.Expression(Bool), ops[g.rand.Intn(len(ops))], g.Expression(Bool))
+	default:
+		ops := []string{"<", ">", "==", "!="}
+		return infix(g.Expression(Int), ops[g.rand.Intn(len(ops))], g.Expression(Int))
+	}
+}
+
+func (g *Generator) ifExpression(typ Type) ast.Expression {
+	return &ast.IfExpression{
+		Token:       token(tk.IF, "if"),
+		Condition:   g.Expression(Bool),
+		Consequence: g.block(typ),
+		Alternative: g.block(typ),
+	}
+}
+
+// block returns a block of let statements ending with an expression.
+func (g *Generator) block(typ Type) *ast.BlockStatement {
+	scope := len(g.vars)
+	defer func() { g.vars = g.vars[:scope] }()
+
+	block := &ast.BlockStatement{Token: token(tk.LBRACE, "{"), Statements: []ast.Statement{}}
+	for i := g.rand.Intn(maxElements); i > 0; i-- {
+		block.Statements = append(block.Statements, g.let(g.anyType()))
+	}
+	block.Statements = append(block.Statements, g.expressionStatement(typ))
+	return block
+}
+
+// function returns a function from an integer to an integer, which may
+// return early.
+func (g *Generator) function() *ast.FunctionLiteral {
+	scope := len(g.vars)
+	defer func() { g.vars = g.vars[:scope] }()
+
+	param := g.newName("p")
+	g.vars = append(g.vars, binding{param, Int})
+	body := g.block(Int)
+	if g.rand.Intn(3) == 0 {
+		early := &ast.IfExpression{
+			Token:     token(tk.IF, "if"),
+			Condition: g.Expression(Bool),
+			Consequence: &ast.BlockStatement{Token: token(tk.LBRACE, "{"), Statements: []ast.Statement{
+				&ast.ReturnStatement{Token: token(tk.RETURN, "return"), ReturnValue: g.Expression(Int)},
+			}},
+		}
+		body.Statements = append([]ast.Statement{&ast.ExpressionStatement{Expression: early}}, body.Statements...)
+	}
+	return &ast.FunctionLiteral{
+		Token:      token(tk.FUNCTION, "fn"),
+		Parameters: []*ast.Identifier{ident(param)},
+		Body:       body,
+	}
+}
+
+// tryExpression returns a try expression whose block may throw a string.
+// The catch block gives the message of the error for strings.
+func (g *Generator) tryExpression(typ Type) ast.Expression {
+	block := g.block(typ)
+	if g.rand.Intn(2) == 0 {
+		block.Statements = append([]ast.Statement{
+			&ast.ThrowStatement{Token: token(tk.THROW, "throw"), Value: g.Expression(String)},
+		}, block.Statements...)
+	}
+
+	try := &ast.TryExpression{Token: token(tk.TRY, "try"), Block: block}
+	param := g.newName("e")
+	try.Param = ident(param)
+	if typ == String {
+		message := &ast.MemberExpression{Token: token(tk.DOT, "."), Object: ident(param), Property: ident("message")}
+		try.Catch = &ast.BlockStatement{Token: token(tk.LBRACE, "{"), Statements: []ast.Statement{
+			&ast.ExpressionStatement{Expression: message},
+		}}
+	} else {
+		try.Catch = g.block(typ)
+	}
+	if g.rand.Intn(2) == 0 {
+		try.Finally = g.block(g.anyType())
+	}
+	return try
+}
+
+func token(typ tk.TokenType, literal string) tk.Token {
+	return tk.Token{Type: typ, Literal: literal}
+}
+
+func ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token(tk.IDENT, name), Value: name}
+}
+
+func integer(n int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: token(tk.INT, strconv.FormatInt(n, 10)), Value: n}
+}
+
+func infix(left ast.Expression, op string, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{Token: token(tk.TokenType(op), op), Left: left, Operator: op, Right: right}
+}
@@ -0,0 +1,44 @@
+package astgen
+
+import (
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+)
+
+func TestProgramsRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		program := New(seed).Program()
+		src := program.String()
+
+		p := parser.New(lexer.New(src))
+		parsed := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("seed %d: parser errors: %q\n%s", seed, p.Errors(), src)
+		}
+		if !ast.Equal(parsed, program) {
+			t.Fatalf("seed %d: parsed tree differs.\nsource=%s\nparsed=%s", seed, src, parsed)
+		}
+	}
+}
+
+func TestProgramsAreWellTyped(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		program := New(seed).Program()
+		result := evaluator.Eval(program, object.NewEnvironment())
+		if err, ok := result.(*object.Error); ok {
+			t.Fatalf("seed %d: %s\n%s", seed, err, program)
+		}
+	}
+}
+
+func TestSameSeedGivesSameProgram(t *testing.T) {
+	a, b := New(42).Program(), New(42).Program()
+	if a.String() != b.String() {
+		t.Errorf("different programs.\n%s\n%s", a, b)
+	}
+}
@@ -0,0 +1,31 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+
+	expected := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if actual := Unified("a", "b", a, b); actual != expected {
+		t.Errorf("wrong diff.\nwant=%q\ngot= %q", expected, actual)
+	}
+	if actual := Unified("a", "b", a, a); actual != "" {
+		t.Errorf("diff of equal texts. got=%q", actual)
+	}
+}
@@ -0,0 +1,53 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range []interface{}{map[string]int{"id": 1}, "é"} {
+		if err := Write(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "Content-Length: 8\r\n\r\n{\"id\":1}Content-Length: 4\r\n\r\n\"é\""; buf.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, buf.String())
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, want := range []string{`{"id":1}`, `"é"`} {
+		body, err := Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != want {
+			t.Errorf("wrong body. want=%q, got=%q", want, body)
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("wrong error at the end. got=%v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Length: x\r\n\r\n", `bad Content-Length: "x"`},
+		{"Content-Type: json\r\n\r\n{}", `bad Content-Length: ""`},
+		{"Content-Length: 10\r\n\r\n{}", "unexpected EOF"},
+		{"Content-Length: 2\r\n", "bad header: EOF"},
+	}
+	for _, tt := range tests {
+		_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package scripttest writes the scripts that tests run to files.
+package scripttest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// WriteFiles writes files to a temporary directory that is removed when
+// the test ends. Names may have slashes for subdirectories. It returns
+// the directory and the paths of the files, sorted by name so that the
+// order does not depend on the map.
+func WriteFiles(t testing.TB, files map[string]string) (dir string, paths []string) {
+	t.Helper()
+	dir = t.TempDir()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return dir, paths
+}
+
+// WriteFile writes a file to a temporary directory as WriteFiles does,
+// and returns its path.
+func WriteFile(t testing.TB, name, src string) string {
+	t.Helper()
+	_, paths := WriteFiles(t, map[string]string{name: src})
+	return paths[0]
+}
@@ -0,0 +1,31 @@
+package scripttest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir, paths := WriteFiles(t, map[string]string{
+		"b.mk":     "2",
+		"a.mk":     "1",
+		"lib/c.mk": "3",
+	})
+	want := []string{"a.mk", "b.mk", filepath.Join("lib", "c.mk")}
+	if len(paths) != len(want) {
+		t.Fatalf("wrong number of paths. want=%d, got=%d", len(want), len(paths))
+	}
+	for i, path := range paths {
+		if path != filepath.Join(dir, want[i]) {
+			t.Errorf("wrong path %d. want=%q, got=%q", i, filepath.Join(dir, want[i]), path)
+		}
+	}
+	src, err := ioutil.ReadFile(paths[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(src) != "3" {
+		t.Errorf("wrong content. want=%q, got=%q", "3", src)
+	}
+}
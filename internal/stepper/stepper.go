@@ -0,0 +1,110 @@
+// Package stepper follows the calls of a program being debugged, and
+// decides where it stops as it is stepped through. The hooks of the
+// debugger and of the debug adapter share it.
+package stepper
+
+import (
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/object"
+)
+
+// Mode tells where the program stops next.
+type Mode int
+
+const (
+	Step     Mode = iota // At the next statement
+	Next                 // At the next statement outside of calls
+	Out                  // At the next statement after the function returns
+	Continue             // At breakpoints only
+)
+
+// Frame is a call being executed, and the environment of where it is.
+type Frame struct {
+	object.StackFrame
+	Env *object.Environment
+}
+
+type Stepper struct {
+	// The calls being executed, innermost last. The position of each
+	// caller is at its call.
+	Stack []Frame
+
+	mode  Mode
+	depth int      // The depth of the stack when the step started
+	last  location // The last statement reached
+}
+
+// location is where a statement is reached. A line breakpoint only stops
+// the program when it arrives on the line, not at each of its statements.
+type location struct {
+	file  string
+	line  int
+	depth int
+}
+
+// New returns a stepper for a program that starts running in the given
+// file and mode.
+func New(main string, m Mode) *Stepper {
+	return &Stepper{
+		Stack: []Frame{{StackFrame: object.StackFrame{Function: "<main>", File: main}}},
+		mode:  m,
+	}
+}
+
+// Top returns the innermost call.
+func (s *Stepper) Top() *Frame {
+	return &s.Stack[len(s.Stack)-1]
+}
+
+// Before moves the innermost call to a node about to be evaluated. If
+// the node is a statement, it reports whether the step ends there, and
+// whether the program arrived on its line, where a line breakpoint
+// stops it.
+func (s *Stepper) Before(node ast.Node, env *object.Environment) (stop, arrived bool) {
+	top := s.Top()
+	top.Function, top.File, top.Pos, top.Env = env.Function, env.File, node.Pos(), env
+
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		return false, false
+	}
+	if _, ok := stmt.(*ast.BlockStatement); ok {
+		return false, false
+	}
+
+	here := location{file: env.File, line: node.Pos().Line, depth: len(s.Stack)}
+	arrived = here != s.last
+	s.last = here
+
+	switch s.mode {
+	case Step:
+		stop = true
+	case Next:
+		stop = len(s.Stack) <= s.depth
+	case Out:
+		stop = len(s.Stack) < s.depth
+	}
+	return stop, arrived
+}
+
+// Call enters the function of a call.
+func (s *Stepper) Call(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	s.Top().Pos = call.Pos()
+	s.Stack = append(s.Stack, Frame{
+		StackFrame: object.StackFrame{Function: env.Function, File: env.File, Pos: fn.Body.Pos()},
+		Env:        env,
+	})
+}
+
+// Return leaves the innermost function.
+func (s *Stepper) Return() {
+	if len(s.Stack) > 1 {
+		s.Stack = s.Stack[:len(s.Stack)-1]
+	}
+}
+
+// Resume starts a step from where the program is.
+func (s *Stepper) Resume(m Mode) {
+	s.mode = m
+	s.depth = len(s.Stack)
+}
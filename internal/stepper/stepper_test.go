@@ -0,0 +1,70 @@
+package stepper
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/object"
+)
+
+// recorder is a hook that notes where the program stops, and resumes it
+// in the next of its modes.
+type recorder struct {
+	steps *Stepper
+	modes []Mode
+	stops []string
+}
+
+func (r *recorder) Before(node ast.Node, env *object.Environment) {
+	if stop, _ := r.steps.Before(node, env); stop {
+		r.stops = append(r.stops, fmt.Sprintf("%d/%d", node.Pos().Line, len(r.steps.Stack)))
+		m := Continue
+		if len(r.modes) > 0 {
+			m, r.modes = r.modes[0], r.modes[1:]
+		}
+		r.steps.Resume(m)
+	}
+}
+
+func (r *recorder) Call(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	r.steps.Call(call, fn, env)
+}
+
+func (r *recorder) Return(call *ast.CallExpression, fn *object.Function, result object.Object) {
+	r.steps.Return()
+}
+
+func TestStepping(t *testing.T) {
+	src := `let f = fn(x) {
+  let y = x + 1; y
+};
+let a = f(1);
+let b = f(2); let c = 3;
+`
+	tests := []struct {
+		modes    []Mode
+		expected string // The lines of the stops and the depths of the stack
+	}{
+		{[]Mode{Step, Step, Step, Step, Step, Step, Step}, "1/1 4/1 2/2 2/2 5/1 2/2 2/2 5/1"},
+		{[]Mode{Next, Next, Next}, "1/1 4/1 5/1 5/1"},
+		{[]Mode{Step, Step, Out, Step}, "1/1 4/1 2/2 5/1 2/2"},
+		{[]Mode{Continue}, "1/1"},
+	}
+	for _, tt := range tests {
+		r := &recorder{steps: New("", Step), modes: tt.modes}
+		in := interp.New()
+		in.SetHook(r)
+		if _, err := in.Eval(src); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(r.stops, " "); got != tt.expected {
+			t.Errorf("%v: wrong stops. want=%q, got=%q", tt.modes, tt.expected, got)
+		}
+		if len(r.steps.Stack) != 1 {
+			t.Errorf("%v: calls left on the stack: %d", tt.modes, len(r.steps.Stack))
+		}
+	}
+}
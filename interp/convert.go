@@ -0,0 +1,482 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/object"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+)
+
+// ToObject converts a Go value to a Monkey object.
+//
+// Integers, booleans, strings, slices, arrays and maps are converted to
+// their Monkey counterparts, structs to read-only records, and functions
+// to builtins whose non-nil error result is raised as a Monkey error.
+// Nil pointers, slices, maps and interfaces become null.
+func ToObject(v interface{}) (object.Object, error) {
+	return toObject(reflect.ValueOf(v))
+}
+
+// FromObject stores a Monkey object into the Go value pointed to by ptr,
+// converting it the opposite way of ToObject.
+func FromObject(obj object.Object, ptr interface{}) error {
+	pv := reflect.ValueOf(ptr)
+	if pv.Kind() != reflect.Ptr || pv.IsNil() {
+		return fmt.Errorf("FromObject needs a non-nil pointer, got %T", ptr)
+	}
+
+	v, err := fromObject(obj, pv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	pv.Elem().Set(v)
+	return nil
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	c := &converter{visiting: make(map[visit]bool)}
+	return c.toObject(v)
+}
+
+// converter keeps the pointers, maps and slices that the value being
+// converted is inside of. Reaching one of them again means the value is
+// cyclic, and converting it would never end.
+type converter struct {
+	visiting map[visit]bool
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int // Slices sharing an array differ in length
+}
+
+func (c *converter) toObject(v reflect.Value) (object.Object, error) {
+	if !v.IsValid() {
+		return evaluator.NULL, nil
+	}
+
+	if v.Type().Implements(objectType) && !isNil(v) {
+		return v.Interface().(object.Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if c.visiting[key] {
+			return nil, fmt.Errorf("cannot convert cyclic value of type %s", v.Type())
+		}
+		c.visiting[key] = true
+		defer delete(c.visiting, key)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", u)
+		}
+		return &object.Integer{Value: int64(u)}, nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := c.toObject(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return c.mapToHash(v)
+
+	case reflect.Struct:
+		return c.structToRecord(v)
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return c.toObject(v.Elem())
+
+	case reflect.Func:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return funcToBuiltin(v)
+	}
+
+	return nil, fmt.Errorf("cannot convert Go value of type %s", v.Type())
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Go maps are unordered, so the keys are sorted to make the result stable.
+func (c *converter) mapToHash(v reflect.Value) (object.Object, error) {
+	hash := object.NewHash()
+
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	for _, k := range keys {
+		key, err := c.toObject(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", k, err)
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("key %v: unusable as hash key: %s", k, key.Type())
+		}
+
+		value, err := c.toObject(v.MapIndex(k))
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", k, err)
+		}
+
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return hash, nil
+}
+
+// Only exported fields are visible from scripts.
+func (c *converter) structToRecord(v reflect.Value) (object.Object, error) {
+	t := v.Type()
+	record := &object.Record{Name: t.Name()}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		value, err := c.toObject(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		record.Fields = append(record.Fields, object.RecordField{Name: field.Name, Value: value})
+	}
+
+	return record, nil
+}
+
+// A function can return at most one value, optionally followed by an error.
+func funcToBuiltin(fn reflect.Value) (object.Object, error) {
+	t := fn.Type()
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	numValues := t.NumOut()
+	if returnsError {
+		numValues -= 1
+	}
+	if numValues > 1 {
+		return nil, fmt.Errorf("cannot convert function %s: too many results", t)
+	}
+
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return callFunc(fn, returnsError, args)
+		},
+	}, nil
+}
+
+func callFunc(fn reflect.Value, returnsError bool, args []object.Object) (result object.Object) {
+	t := fn.Type()
+
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < numIn-1 {
+			return newError(object.TYPE_ERROR, "wrong number of arguments: want at least %d, got=%d", numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return newError(object.TYPE_ERROR, "wrong number of arguments: want=%d, got=%d", numIn, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if t.IsVariadic() && i >= numIn-1 {
+			paramType = t.In(numIn - 1).Elem()
+		} else {
+			paramType = t.In(i)
+		}
+
+		v, err := fromObject(arg, paramType)
+		if err != nil {
+			return newError(object.TYPE_ERROR, "argument %d: %s", i+1, err)
+		}
+		in[i] = v
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError(object.HOST_ERROR, "panic: %v", r)
+		}
+	}()
+
+	out := fn.Call(in)
+
+	if returnsError {
+		errValue := out[len(out)-1]
+		if !errValue.IsNil() {
+			return newError(object.HOST_ERROR, "%s", errValue.Interface().(error))
+		}
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return evaluator.NULL
+	}
+
+	obj, err := toObject(out[0])
+	if err != nil {
+		return newError(object.TYPE_ERROR, "result: %s", err)
+	}
+	return obj
+}
+
+func fromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		v := reflect.New(t).Elem()
+		if goValue := toGo(obj); goValue != nil {
+			v.Set(reflect.ValueOf(goValue))
+		}
+		return v, nil
+	}
+
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj), nil
+	}
+
+	if obj == evaluator.NULL {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(i.Value) {
+				return v, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return v, nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return v, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return v, nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+
+	case reflect.Slice:
+		if a, ok := obj.(*object.Array); ok {
+			v := reflect.MakeSlice(t, len(a.Elements), len(a.Elements))
+			for i, el := range a.Elements {
+				ev, err := fromObject(el, t.Elem())
+				if err != nil {
+					return v, fmt.Errorf("index %d: %w", i, err)
+				}
+				v.Index(i).Set(ev)
+			}
+			return v, nil
+		}
+
+	case reflect.Array:
+		if a, ok := obj.(*object.Array); ok {
+			v := reflect.New(t).Elem()
+			if len(a.Elements) != t.Len() {
+				return v, fmt.Errorf("cannot convert ARRAY of length %d to %s", len(a.Elements), t)
+			}
+			for i, el := range a.Elements {
+				ev, err := fromObject(el, t.Elem())
+				if err != nil {
+					return v, fmt.Errorf("index %d: %w", i, err)
+				}
+				v.Index(i).Set(ev)
+			}
+			return v, nil
+		}
+
+	case reflect.Map:
+		if h, ok := obj.(*object.Hash); ok {
+			v := reflect.MakeMapWithSize(t, len(h.Pairs))
+			for _, pair := range h.Pairs {
+				kv, err := fromObject(pair.Key, t.Key())
+				if err != nil {
+					return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				vv, err := fromObject(pair.Value, t.Elem())
+				if err != nil {
+					return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				v.SetMapIndex(kv, vv)
+			}
+			return v, nil
+		}
+
+	case reflect.Struct:
+		return toStruct(obj, t)
+
+	case reflect.Ptr:
+		ev, err := fromObject(obj, t.Elem())
+		if err != nil {
+			return ev, err
+		}
+		v := reflect.New(t.Elem())
+		v.Elem().Set(ev)
+		return v, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+// Both records and hashes with string keys can fill a struct.
+func toStruct(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	var fields []object.RecordField
+
+	switch obj := obj.(type) {
+	case *object.Record:
+		fields = obj.Fields
+	case *object.Hash:
+		for _, pair := range obj.OrderedPairs() {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("cannot convert HASH with %s key to %s", pair.Key.Type(), t)
+			}
+			fields = append(fields, object.RecordField{Name: key.Value, Value: pair.Value})
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+	}
+
+	v := reflect.New(t).Elem()
+	for _, f := range fields {
+		field, ok := t.FieldByName(f.Name)
+		if !ok || field.PkgPath != "" {
+			return v, fmt.Errorf("%s has no field %s", t, f.Name)
+		}
+		fv, err := fromObject(f.Value, field.Type)
+		if err != nil {
+			return v, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		v.FieldByIndex(field.Index).Set(fv)
+	}
+	return v, nil
+}
+
+// toGo converts an object to the most natural Go value, used when
+// the destination is an empty interface.
+func toGo(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			values[i] = toGo(el)
+		}
+		return values
+	case *object.Hash:
+		return hashToGo(obj)
+	case *object.Record:
+		values := make(map[string]interface{}, len(obj.Fields))
+		for _, f := range obj.Fields {
+			values[f.Name] = toGo(f.Value)
+		}
+		return values
+	default:
+		return obj
+	}
+}
+
+// Hashes with only string keys are converted to map[string]interface{}.
+func hashToGo(hash *object.Hash) interface{} {
+	strKeys := make(map[string]interface{}, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		key, ok := pair.Key.(*object.String)
+		if !ok {
+			break
+		}
+		strKeys[key.Value] = toGo(pair.Value)
+	}
+	if len(strKeys) == len(hash.Pairs) {
+		return strKeys
+	}
+
+	values := make(map[interface{}]interface{}, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		values[toGo(pair.Key)] = toGo(pair.Value)
+	}
+	return values
+}
+
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
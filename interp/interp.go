@@ -0,0 +1,114 @@
+// Package interp embeds the Monkey interpreter into Go programs.
+package interp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/optimizer"
+	"github.com/ryym/monkey/parser"
+	"github.com/ryym/monkey/resolver"
+)
+
+// Interpreter evaluates programs in a global environment that
+// persists across evaluations.
+type Interpreter struct {
+	env    *object.Environment
+	loader *evaluator.Loader
+}
+
+func New() *Interpreter {
+	in := &Interpreter{env: object.NewEnvironment(), loader: evaluator.NewLoader(nil)}
+	in.env.Importer = in.loader
+	return in
+}
+
+// SetSearchPath sets the directories searched for imported modules
+// that are not found relative to the importing file.
+func (in *Interpreter) SetSearchPath(dirs ...string) {
+	in.loader.Path = dirs
+}
+
+// SetGlobal binds a Go value to a global name, converting it with ToObject.
+// Imported modules see the name too.
+func (in *Interpreter) SetGlobal(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	in.env.Set(name, obj)
+	in.loader.Globals[name] = obj
+	return nil
+}
+
+// SetHook sets a hook that observes the evaluation of programs and the
+// modules they import. Programs are not optimized while a hook is set,
+// so that it sees every statement as written.
+func (in *Interpreter) SetHook(hook object.Hook) {
+	in.env.Hook = hook
+	in.loader.Hook = hook
+}
+
+// Global returns the value bound to a global name.
+func (in *Interpreter) Global(name string) (object.Object, bool) {
+	return in.env.Get(name)
+}
+
+// Eval parses, resolves, optimizes and evaluates the input. Parse errors
+// are returned as *ParseError, undefined or duplicate bindings as
+// *ResolveError, and runtime errors as *object.Error. The globals defined
+// so far and the builtins are known to the resolver.
+func (in *Interpreter) Eval(input string) (object.Object, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	if diags := evaluator.Resolve(program, in.env); len(diags) > 0 {
+		return nil, &ResolveError{Diagnostics: diags}
+	}
+	if in.env.Hook == nil {
+		optimizer.Optimize(program)
+	}
+
+	result := evaluator.Eval(program, in.env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// EvalFile evaluates a source file. Modules it imports are resolved
+// relative to the file.
+func (in *Interpreter) EvalFile(path string) (object.Object, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	in.env.File = path
+	return in.Eval(string(src))
+}
+
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Errors, "; ")
+}
+
+type ResolveError struct {
+	Diagnostics []resolver.Diagnostic
+}
+
+func (e *ResolveError) Error() string {
+	msgs := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		msgs[i] = d.String()
+	}
+	return "resolve error: " + strings.Join(msgs, "; ")
+}
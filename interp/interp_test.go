@@ -0,0 +1,369 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/internal/scripttest"
+	"github.com/ryym/monkey/object"
+)
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	in := New()
+
+	if _, err := in.Eval("let x = 5;"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := in.Eval("x * 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "10" {
+		t.Errorf("wrong result. want=10, got=%s", result.Inspect())
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval("let = 5")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("err is not *ParseError. got=%T (%v)", err, err)
+	}
+
+	_, err = in.Eval("1 + true")
+	var runtimeErr *object.Error
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("err is not *object.Error. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Message)
+	}
+}
+
+func TestEvalResolveErrors(t *testing.T) {
+	in := New()
+	if err := in.SetGlobal("limit", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := in.Eval("let f = fn(a, a) { a + limit + nope }")
+	var resolveErr *ResolveError
+	if !errors.As(err, &resolveErr) {
+		t.Fatalf("err is not *ResolveError. got=%T (%v)", err, err)
+	}
+	want := "resolve error: 1:15: duplicate binding of a, first bound at 1:12; 1:32: undefined: nope"
+	if err.Error() != want {
+		t.Errorf("wrong error.\nwant=%q\ngot= %q", want, err)
+	}
+
+	// Globals bound by earlier evaluations are known.
+	if _, err := in.Eval("let nope = 1"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := in.Eval("let f = fn(a) { a + limit + nope }; f(2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inspect() != "6" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+type user struct {
+	Name  string
+	Age   int
+	Tags  []string
+	email string
+}
+
+type userService struct {
+	users map[string]*user
+}
+
+func (s *userService) LookupUser(name string) (*user, error) {
+	u, ok := s.users[name]
+	if !ok {
+		return nil, errors.New("no such user: " + name)
+	}
+	return u, nil
+}
+
+func TestEvalFileImports(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"app/main.mk":   `import "./helper"; import "shared"; helper.x + shared.y`,
+		"app/helper.mk": `let x = 1;`,
+		"lib/shared.mk": `let y = 2;`,
+	})
+
+	in := New()
+	in.SetSearchPath(filepath.Join(dir, "lib"))
+
+	result, err := in.EvalFile(filepath.Join(dir, "app", "main.mk"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "3" {
+		t.Errorf("wrong result. want=3, got=%s", result.Inspect())
+	}
+
+	// Later evaluations resolve imports from the same file.
+	result, err = in.Eval(`import "helper"; helper.x`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "1" {
+		t.Errorf("wrong result. want=1, got=%s", result.Inspect())
+	}
+}
+
+// lines is a hook that records the lines of the statements it sees.
+type lines struct {
+	seen []string
+}
+
+func (l *lines) Before(node ast.Node, env *object.Environment) {
+	if _, ok := node.(ast.Statement); ok {
+		l.seen = append(l.seen, fmt.Sprintf("%s:%d", filepath.Base(env.File), node.Pos().Line))
+	}
+}
+
+func (l *lines) Call(*ast.CallExpression, *object.Function, *object.Environment) {}
+func (l *lines) Return(*ast.CallExpression, *object.Function, object.Object)     {}
+
+func TestImportedModulesSeeGlobals(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"main.mk":   `import "greet"; import "shadow"; greet.hello() + shadow.name`,
+		"greet.mk":  `let hello = fn() { greeting + ", " + name };`,
+		"shadow.mk": `let name = "module";`,
+	})
+
+	in := New()
+	in.SetGlobal("greeting", "hello")
+	in.SetGlobal("name", "host")
+	result, err := in.EvalFile(filepath.Join(dir, "main.mk"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "hello, hostmodule" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	// Globals are not exported by the modules that see them.
+	if _, err := in.Eval(`import "greet"; greet.greeting`); err == nil {
+		t.Errorf("a global is exported from a module")
+	}
+}
+
+func TestSetHook(t *testing.T) {
+	dir, _ := scripttest.WriteFiles(t, map[string]string{
+		"main.mk": "import \"mod\";\nif (true) {\n  2\n}",
+		"mod.mk":  "if (false) {\n  1\n}",
+	})
+	path := filepath.Join(dir, "main.mk")
+
+	// The if expressions are not pruned by the optimizer.
+	hook := &lines{}
+	in := New()
+	in.SetHook(hook)
+	if _, err := in.EvalFile(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "main.mk:1 mod.mk:1 main.mk:2 main.mk:2 main.mk:3"
+	if got := strings.Join(hook.seen, " "); got != want {
+		t.Errorf("wrong statements. want=%q, got=%q", want, got)
+	}
+}
+
+func TestSetGlobalFunction(t *testing.T) {
+	svc := &userService{users: map[string]*user{
+		"alice": {Name: "alice", Age: 30, Tags: []string{"admin"}, email: "a@example.com"},
+	}}
+
+	in := New()
+	if err := in.SetGlobal("lookupUser", svc.LookupUser); err != nil {
+		t.Fatalf("SetGlobal failed: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`lookupUser("alice").Name`, "alice"},
+		{`lookupUser("alice").Age + 1`, "31"},
+		{`lookupUser("alice").Tags[0]`, "admin"},
+		{`lookupUser("alice")`, `user{Name: alice, Age: 30, Tags: [admin]}`},
+		{`try { lookupUser("bob") } catch (e) { e.kind + ": " + e.message }`, "HostError: no such user: bob"},
+		{`try { lookupUser(1) } catch (e) { e.message }`, "argument 1: cannot convert INTEGER to string"},
+		{`try { lookupUser() } catch (e) { e.message }`, "wrong number of arguments: want=1, got=0"},
+		{`try { lookupUser("alice").email } catch (e) { e.message }`, "unknown member: RECORD.email"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.Eval(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	in := New()
+
+	globals := map[string]interface{}{
+		"sum": func(nums ...int) int {
+			total := 0
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+		"count": func(m map[string]bool) int {
+			return len(m)
+		},
+		"greet": func(u user) string {
+			return "hello " + u.Name
+		},
+		"describe": func(v interface{}) string {
+			switch v.(type) {
+			case int64:
+				return "int"
+			case []interface{}:
+				return "slice"
+			case map[string]interface{}:
+				return "map"
+			case nil:
+				return "nil"
+			}
+			return "other"
+		},
+		"small": func(n int8) int8 {
+			return n
+		},
+		"boom": func() {
+			panic("oops")
+		},
+	}
+	for name, value := range globals {
+		if err := in.SetGlobal(name, value); err != nil {
+			t.Fatalf("SetGlobal(%s) failed: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sum()`, "0"},
+		{`sum(1, 2, 3)`, "6"},
+		{`count({"a": true, "b": false})`, "2"},
+		{`greet({"Name": "carol"})`, "hello carol"},
+		{`describe(1)`, "int"},
+		{`describe([1])`, "slice"},
+		{`describe({"a": 1})`, "map"},
+		{`describe(if (false) { 1 })`, "nil"},
+		{`small(127)`, "127"},
+		{`try { small(128) } catch (e) { e.message }`, "argument 1: 128 overflows int8"},
+		{`try { sum(1, true) } catch (e) { e.message }`, "argument 2: cannot convert BOOLEAN to int"},
+		{`try { greet({"Nickname": "c"}) } catch (e) { e.message }`, "argument 1: interp.user has no field Nickname"},
+		{`try { boom() } catch (e) { e.kind + ": " + e.message }`, "HostError: panic: oops"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.Eval(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+func TestSetGlobalConversionErrors(t *testing.T) {
+	cyclic := &node{Name: "a"}
+	cyclic.Next = &node{Name: "b", Next: cyclic}
+	cyclicSlice := []interface{}{1, nil}
+	cyclicSlice[1] = cyclicSlice
+	cyclicMap := map[string]interface{}{}
+	cyclicMap["self"] = cyclicMap
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{1.5, "x: cannot convert Go value of type float64"},
+		{[]interface{}{1, 2.5}, "x: index 1: cannot convert Go value of type float64"},
+		{uint64(1 << 63), "x: 9223372036854775808 overflows INTEGER"},
+		{func() (int, int) { return 1, 2 }, "x: cannot convert function func() (int, int): too many results"},
+		{map[string]chan int{"c": nil}, "x: key c: cannot convert Go value of type chan int"},
+		{cyclic, "x: field Next: field Next: cannot convert cyclic value of type *interp.node"},
+		{cyclicSlice, "x: index 1: cannot convert cyclic value of type []interface {}"},
+		{cyclicMap, "x: key self: cannot convert cyclic value of type map[string]interface {}"},
+	}
+
+	for _, tt := range tests {
+		err := New().SetGlobal("x", tt.value)
+		if err == nil {
+			t.Errorf("expected an error for %T", tt.value)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	in := New()
+	result, err := in.Eval(`{"Name": "dave", "Age": 40, "Tags": ["a", "b"]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var u user
+	if err := FromObject(result, &u); err != nil {
+		t.Fatalf("FromObject failed: %s", err)
+	}
+	if u.Name != "dave" || u.Age != 40 || len(u.Tags) != 2 || u.Tags[1] != "b" {
+		t.Errorf("wrong struct. got=%+v", u)
+	}
+
+	var n int
+	err = FromObject(result, &n)
+	if err == nil || err.Error() != "cannot convert HASH to int" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestSetGlobalShared(t *testing.T) {
+	// A value reached twice without a cycle converts as usual.
+	shared := &node{Name: "shared"}
+	in := New()
+	if err := in.SetGlobal("x", []*node{shared, shared}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := in.Eval(`x[0].Name + x[1].Name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inspect() != "sharedshared" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
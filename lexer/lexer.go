@@ -1,20 +1,42 @@
 package lexer
 
-import tk "github.com/ryym/monkey/token"
+import (
+	"strings"
+
+	tk "github.com/ryym/monkey/token"
+)
 
 type Lexer struct {
 	input        string
 	position     int // current position
 	readPosition int // curreint reading position (next char)
 	ch           byte
+	line         int // line of the current char
+	column       int // column of the current char
+
+	comments []tk.Comment
+	lastLine int // line of the last token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
+// skipShebang skips a `#!` line at the start of the input so that
+// scripts can be run directly, like `#!/usr/bin/env monkey`.
+// The newline is kept to leave the line numbers as they are.
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0 // EOF
@@ -25,7 +47,12 @@ func (l *Lexer) peekChar() byte {
 
 // To keep things simple, only support ASCIIs.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
 	l.ch = l.peekChar()
+	l.column += 1
 	l.position = l.readPosition
 	l.readPosition += 1
 }
@@ -47,22 +74,72 @@ func (l *Lexer) readNumber() string {
 	return l.input[from:l.position]
 }
 
+// The literal keeps escape sequences as written.
+// The parser is responsible for interpreting them.
+func (l *Lexer) readString() string {
+	from := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+			continue
+		}
+		if l.ch == '"' || l.ch == 0 {
+			break
+		}
+	}
+	return l.input[from:l.position]
+}
+
 func (l *Lexer) readTwoChars() string {
 	ch := l.ch
 	l.readChar()
 	return string(ch) + string(l.ch)
 }
 
+// skipWhitespace skips whitespace and comments.
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	c := tk.Comment{
+		Pos:      tk.Position{Line: l.line, Column: l.column},
+		Trailing: l.lastLine == l.line,
+	}
+	from := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	c.Text = strings.TrimRight(l.input[from:l.position], " \t\r")
+	l.comments = append(l.comments, c)
 }
 
-func (l *Lexer) NextToken() tk.Token {
-	tok := tk.Token{}
+// Comments returns the comments read so far, in source order.
+func (l *Lexer) Comments() []tk.Comment {
+	return l.comments
+}
 
+func (l *Lexer) NextToken() tk.Token {
 	l.skipWhitespace()
+	pos := tk.Position{Line: l.line, Column: l.column}
+	tok := l.readToken()
+	tok.Pos = pos
+	l.lastLine = l.line
+	return tok
+}
+
+func (l *Lexer) readToken() tk.Token {
+	tok := tk.Token{}
 
 	switch l.ch {
 	case '=':
@@ -101,11 +178,27 @@ func (l *Lexer) NextToken() tk.Token {
 		tok = newToken(tk.COMMA, l.ch)
 	case ';':
 		tok = newToken(tk.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(tk.COLON, l.ch)
+	case '.':
+		tok = newToken(tk.DOT, l.ch)
+	case '"':
+		tok.Type = tk.STRING
+		tok.Literal = l.readString()
 	case '{':
 		tok = newToken(tk.LBRACE, l.ch)
 	case '}':
 		tok = newToken(tk.RBRACE, l.ch)
+	case '[':
+		tok = newToken(tk.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(tk.RBRACKET, l.ch)
 	case 0:
+		if l.position < len(l.input) {
+			// A NUL byte in the input, not the end of it.
+			tok = newToken(tk.ILLEGAL, l.ch)
+			break
+		}
 		tok.Type = tk.EOF
 		tok.Literal = ""
 	default:
@@ -26,6 +26,10 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+"foobar"
+"foo bar"
+"say \"hi\"\n"
+try { throw e; } catch (e) { e.message } finally { 1 }
 `
 
 	tests := []struct {
@@ -112,6 +116,28 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, `say \"hi\"\n`},
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.THROW, "throw"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.CATCH, "catch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "e"},
+		{token.DOT, "."},
+		{token.IDENT, "message"},
+		{token.RBRACE, "}"},
+		{token.FINALLY, "finally"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
 
 		{token.EOF, ""},
 	}
@@ -130,3 +156,125 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := `let x = 5;
+	x + 10`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Line: 1, Column: 1}},
+		{"x", token.Position{Line: 1, Column: 5}},
+		{"=", token.Position{Line: 1, Column: 7}},
+		{"5", token.Position{Line: 1, Column: 9}},
+		{";", token.Position{Line: 1, Column: 10}},
+		{"x", token.Position{Line: 2, Column: 2}},
+		{"+", token.Position{Line: 2, Column: 4}},
+		{"10", token.Position{Line: 2, Column: 6}},
+		{"", token.Position{Line: 2, Column: 8}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1;"
+
+	l := New(input)
+	tok := l.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+	if want := (token.Position{Line: 2, Column: 1}); tok.Pos != want {
+		t.Fatalf("position wrong. expected=%s, got=%s", want, tok.Pos)
+	}
+
+	// Only the first line can be a shebang.
+	l = New("1\n#!")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // trailing  
+// last`
+
+	expectedTokens := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []token.Comment{
+		{Pos: token.Position{Line: 1, Column: 1}, Text: "// leading"},
+		{Pos: token.Position{Line: 2, Column: 17}, Text: "// trailing", Trailing: true},
+		{Pos: token.Position{Line: 3, Column: 1}, Text: "// last"},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	for _, src := range []string{
+		"",
+		"let add = fn(x, y) { x + y; };",
+		`"a\"b" // comment`,
+		"#!/usr/bin/env monkey\nimport \"lib\";",
+		"{\"k\": [1, 2]}[\"k\"] == != ! . @",
+		`"unterminated`,
+	} {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		l := New(src)
+		prev := token.Position{}
+		// Every token but EOF consumes at least one byte.
+		for i := 0; ; i++ {
+			if i > len(src) {
+				t.Fatalf("no EOF after %d tokens", i)
+			}
+			tok := l.NextToken()
+			if tok.Type == token.EOF {
+				break
+			}
+			if !prev.Before(tok.Pos) {
+				t.Fatalf("token %q at %s is not after %s", tok.Literal, tok.Pos, prev)
+			}
+			prev = tok.Pos
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("token after EOF: %q", tok.Literal)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ryym/monkey/lsp"
+)
+
+// serveLSP runs a language server over the standard streams until the
+// client exits.
+func (c *cli) serveLSP(args []string) int {
+	if len(args) > 0 {
+		io.WriteString(c.stderr, "usage: monkey lsp\n")
+		return exitUsage
+	}
+	server := lsp.NewServer(c.stdin, c.stdout)
+	server.Globals = []string{"args"}
+	if err := server.Run(); err != nil {
+		fmt.Fprintf(c.stderr, "monkey lsp: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
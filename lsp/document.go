@@ -0,0 +1,456 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/format"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+	"github.com/ryym/monkey/resolver"
+	tk "github.com/ryym/monkey/token"
+	"github.com/ryym/monkey/vet"
+)
+
+// document is an open text document and what is known about its text.
+type document struct {
+	uri         string
+	text        string
+	lines       lines
+	diagnostics []Diagnostic
+
+	// current is the analysis of the text, or nil if it does not parse.
+	current *analysis
+	// lastGood is the analysis of the last text that parsed. Completion
+	// uses it while the text is being edited.
+	lastGood *analysis
+}
+
+// analysis is a parsed and resolved program.
+type analysis struct {
+	program *ast.Program
+	info    *resolver.Info
+	lines   lines
+
+	spans     map[*ast.Identifier]Range            // Where each identifier is written
+	defs      map[*resolver.Symbol]*ast.Identifier // The first definition of each symbol
+	decls     map[*ast.Identifier]ast.Statement    // The let or import statement of a bound name
+	functions []extent                             // From fn to the closing brace of the body
+}
+
+type extent struct {
+	start, end tk.Position
+}
+
+func (e extent) contains(pos tk.Position) bool {
+	return !pos.Before(e.start) && !e.end.Before(pos)
+}
+
+// update analyzes a new text and computes its diagnostics.
+func (d *document) update(text string, globals []string) {
+	d.text = text
+	d.lines = splitLines(text)
+	d.current = nil
+
+	// The lengths of the tokens give the ranges of the diagnostics, and
+	// the closing braces give the ends of functions.
+	lengths := make(map[tk.Position]int)
+	closing := make(map[tk.Position]tk.Position)
+	opening := []tk.Position{}
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != tk.EOF; tok = l.NextToken() {
+		lengths[tok.Pos] = len(tok.Literal)
+		switch tok.Type {
+		case tk.STRING:
+			lengths[tok.Pos] += 2
+		case tk.LBRACE:
+			opening = append(opening, tok.Pos)
+		case tk.RBRACE:
+			if n := len(opening); n > 0 {
+				closing[opening[n-1]] = tok.Pos
+				opening = opening[:n-1]
+			}
+		}
+	}
+
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) > 0 {
+		// The parser may find the same error more than once as it recovers.
+		d.diagnostics = []Diagnostic{}
+		seen := make(map[parser.Error]bool)
+		for _, err := range errs {
+			if seen[err] {
+				continue
+			}
+			seen[err] = true
+			d.diagnostics = append(d.diagnostics, Diagnostic{
+				Range:    d.lines.span(err.Pos, lengths[err.Pos]),
+				Severity: SeverityError,
+				Source:   "monkey",
+				Message:  err.Message,
+			})
+		}
+		return
+	}
+
+	d.diagnostics = []Diagnostic{}
+	config := &vet.Config{Globals: globals}
+	for _, v := range config.Check(program) {
+		diag := Diagnostic{
+			Range:    d.lines.span(v.Pos, lengths[v.Pos]),
+			Severity: SeverityWarning,
+			Code:     v.Rule,
+			Source:   "monkey",
+			Message:  v.Message,
+		}
+		switch v.Rule {
+		case vet.ResolveRule:
+			diag.Severity = SeverityError
+		case vet.Unused.Name, vet.Unreachable.Name:
+			diag.Tags = []int{TagUnnecessary}
+		}
+		d.diagnostics = append(d.diagnostics, diag)
+	}
+
+	a := &analysis{
+		program: program,
+		info:    resolver.NewInfo(),
+		lines:   d.lines,
+		spans:   make(map[*ast.Identifier]Range),
+		defs:    make(map[*resolver.Symbol]*ast.Identifier),
+		decls:   make(map[*ast.Identifier]ast.Statement),
+	}
+	resolver.ResolveInfo(program, resolver.NewGlobalTable(globals, evaluator.BuiltinNames()), a.info)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.ImportStatement:
+			// The name of a module is written as its path.
+			pos := node.Path.Pos()
+			a.spans[node.Name] = a.lines.span(pos, lengths[pos])
+			a.decls[node.Name] = node
+			return false
+		case *ast.LetStatement:
+			a.decls[node.Name] = node
+		case *ast.FunctionLiteral:
+			a.functions = append(a.functions, extent{node.Pos(), closing[node.Body.Token.Pos]})
+		case *ast.Identifier:
+			a.spans[node] = a.lines.span(node.Pos(), len(node.Value))
+		}
+		return true
+	})
+	for id, sym := range a.info.Defs {
+		if def, ok := a.defs[sym]; !ok || id.Pos().Before(def.Pos()) {
+			a.defs[sym] = id
+		}
+	}
+	d.current = a
+	d.lastGood = a
+}
+
+// identifierAt finds the resolved identifier at a position, which may
+// also be right after its last character.
+func (a *analysis) identifierAt(pos tk.Position) (*ast.Identifier, *resolver.Symbol) {
+	at := a.lines.toPosition(pos)
+	var found *ast.Identifier
+	for id, r := range a.spans {
+		if r.Start.Line != at.Line || at.Character < r.Start.Character || at.Character > r.End.Character {
+			continue
+		}
+		// An identifier that starts at the position wins over one ending there.
+		if found == nil || at.Character < r.End.Character {
+			found = id
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	if sym, ok := a.info.Defs[found]; ok {
+		return found, sym
+	}
+	if sym, ok := a.info.Uses[found]; ok {
+		return found, sym
+	}
+	return nil, nil
+}
+
+func (d *document) hover(pos tk.Position) *Hover {
+	a := d.current
+	if a == nil {
+		return nil
+	}
+	id, sym := a.identifierAt(pos)
+	if sym == nil {
+		return nil
+	}
+
+	// A definition shows its own value, as a global may be bound again.
+	def := id
+	if _, ok := a.info.Defs[id]; !ok {
+		def = a.defs[sym]
+	}
+	var text string
+	switch sym.Kind {
+	case resolver.LetKind:
+		text = "let " + sym.Name
+		if let, ok := a.decls[def].(*ast.LetStatement); ok {
+			switch kind := a.kindOf(let.Value); {
+			case strings.HasPrefix(kind, "fn"):
+				text += " = " + kind
+			case kind != "":
+				text += ": " + kind
+			}
+		}
+	case resolver.ImportKind:
+		text = "import " + sym.Name
+		if imp, ok := a.decls[def].(*ast.ImportStatement); ok {
+			text = fmt.Sprintf("import %q", imp.Path.Value)
+		}
+	default:
+		text = fmt.Sprintf("%s %s", sym.Kind, sym.Name)
+	}
+	if sym.Shadows != nil && sym.Shadows.Kind != resolver.BuiltinKind && sym.Shadows.Kind != resolver.GlobalKind {
+		text += fmt.Sprintf("\n// shadows the %s bound at %s", sym.Shadows.Kind, sym.Shadows.Pos)
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + text + "\n```"},
+		Range:    a.spans[id],
+	}
+}
+
+// valueKind describes the value of an expression if it is a literal:
+// a function by its parameters, and other values by their types.
+func valueKind(exp ast.Expression) string {
+	switch exp := exp.(type) {
+	case *ast.FunctionLiteral:
+		params := make([]string, len(exp.Parameters))
+		for i, p := range exp.Parameters {
+			params[i] = p.Value
+		}
+		return "fn(" + strings.Join(params, ", ") + ")"
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.Boolean:
+		return object.BOOLEAN_OBJ
+	case *ast.ArrayLiteral:
+		return object.ARRAY_OBJ
+	case *ast.HashLiteral:
+		return object.HASH_OBJ
+	}
+	return ""
+}
+
+// kindOf describes the value of an expression as valueKind does, and
+// follows an identifier to the value of the let statement binding it.
+func (a *analysis) kindOf(exp ast.Expression) string {
+	seen := make(map[*resolver.Symbol]bool)
+	for {
+		id, ok := exp.(*ast.Identifier)
+		if !ok {
+			return valueKind(exp)
+		}
+		sym, ok := a.info.Uses[id]
+		if !ok || sym.Kind != resolver.LetKind || seen[sym] {
+			return ""
+		}
+		seen[sym] = true
+		let, ok := a.decls[a.defs[sym]].(*ast.LetStatement)
+		if !ok {
+			return ""
+		}
+		exp = let.Value
+	}
+}
+
+func (d *document) definition(pos tk.Position) *Location {
+	a := d.current
+	if a == nil {
+		return nil
+	}
+	_, sym := a.identifierAt(pos)
+	def, ok := a.defs[sym]
+	if !ok {
+		return nil // Builtins and globals of the host are not defined in the source.
+	}
+	return &Location{URI: d.uri, Range: a.spans[def]}
+}
+
+func (d *document) references(pos tk.Position, includeDeclaration bool) []Location {
+	locs := []Location{}
+	a := d.current
+	if a == nil {
+		return locs
+	}
+	_, sym := a.identifierAt(pos)
+	if sym == nil {
+		return locs
+	}
+
+	ids := []*ast.Identifier{}
+	for id, s := range a.info.Uses {
+		if s == sym {
+			ids = append(ids, id)
+		}
+	}
+	if includeDeclaration {
+		for id, s := range a.info.Defs {
+			if s == sym {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Pos().Before(ids[j].Pos())
+	})
+	for _, id := range ids {
+		locs = append(locs, Location{URI: d.uri, Range: a.spans[id]})
+	}
+	return locs
+}
+
+// symbols lists the let and import statements of the program, with the
+// statements of the bodies of functions as their children.
+func (d *document) symbols() []DocumentSymbol {
+	if d.current == nil {
+		return []DocumentSymbol{}
+	}
+	return d.current.statementSymbols(d.current.program.Statements)
+}
+
+func (a *analysis) statementSymbols(stmts []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			sel := a.spans[stmt.Name]
+			sym := DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Detail:         a.kindOf(stmt.Value),
+				Kind:           SymbolVariable,
+				Range:          Range{Start: a.lines.toPosition(stmt.Pos()), End: sel.End},
+				SelectionRange: sel,
+			}
+			if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+				sym.Kind = SymbolFunction
+				for _, f := range a.functions {
+					if f.start == fn.Pos() {
+						sym.Range.End = a.lines.span(f.end, 1).End
+					}
+				}
+				if children := a.statementSymbols(fn.Body.Statements); len(children) > 0 {
+					sym.Children = children
+				}
+			}
+			symbols = append(symbols, sym)
+		case *ast.ImportStatement:
+			sel := a.spans[stmt.Name]
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Detail:         fmt.Sprintf("%q", stmt.Path.Value),
+				Kind:           SymbolModule,
+				Range:          Range{Start: a.lines.toPosition(stmt.Pos()), End: sel.End},
+				SelectionRange: sel,
+			})
+		}
+	}
+	return symbols
+}
+
+// completion suggests the keywords and the names in scope at a position.
+// Locals are in scope in their function after they are bound, and the
+// names bound at the top level anywhere.
+func (d *document) completion(pos tk.Position, globals []string) []CompletionItem {
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+	add := func(item CompletionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+
+	for _, word := range tk.Keywords() {
+		add(CompletionItem{Label: word, Kind: CompletionKeyword})
+	}
+	if a := d.lastGood; a != nil {
+		// Inner bindings come first so that they win over the ones they shadow.
+		ids := []*ast.Identifier{}
+		for id := range a.info.Defs {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[j].Pos().Before(ids[i].Pos())
+		})
+		for _, id := range ids {
+			sym := a.info.Defs[id]
+			if sym.Scope == ast.LocalScope && !a.inScope(sym, pos) {
+				continue
+			}
+			add(a.completionItem(sym))
+		}
+	}
+	for _, name := range globals {
+		add(CompletionItem{Label: name, Kind: CompletionVariable, Detail: string(resolver.GlobalKind)})
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		add(CompletionItem{Label: name, Kind: CompletionFunction, Detail: string(resolver.BuiltinKind)})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+// inScope reports whether a local is bound at a position, that is after
+// its binding and in the innermost function enclosing the binding.
+func (a *analysis) inScope(sym *resolver.Symbol, pos tk.Position) bool {
+	if pos.Before(sym.Pos) {
+		return false
+	}
+	var owner *extent
+	for i, f := range a.functions {
+		if f.contains(sym.Pos) && (owner == nil || owner.start.Before(f.start)) {
+			owner = &a.functions[i]
+		}
+	}
+	return owner != nil && owner.contains(pos)
+}
+
+func (a *analysis) completionItem(sym *resolver.Symbol) CompletionItem {
+	item := CompletionItem{Label: sym.Name, Kind: CompletionVariable, Detail: string(sym.Kind)}
+	switch sym.Kind {
+	case resolver.ImportKind:
+		item.Kind = CompletionModule
+	case resolver.LetKind:
+		if let, ok := a.decls[a.defs[sym]].(*ast.LetStatement); ok {
+			kind := a.kindOf(let.Value)
+			if kind != "" {
+				item.Detail = kind
+			}
+			if strings.HasPrefix(kind, "fn") {
+				item.Kind = CompletionFunction
+			}
+		}
+	}
+	return item
+}
+
+// format returns an edit that replaces the text with its formatted
+// version, or no edits if it is formatted already.
+func (d *document) format() ([]TextEdit, error) {
+	formatted, err := format.Source([]byte(d.text))
+	if err != nil {
+		return nil, &Error{Code: CodeRequestFailed, Message: err.Error()}
+	}
+	if string(formatted) == d.text {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{Range: d.lines.whole(), NewText: string(formatted)}}, nil
+}
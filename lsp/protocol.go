@@ -0,0 +1,245 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tk "github.com/ryym/monkey/token"
+)
+
+// The messages of JSON-RPC 2.0. A request has an ID and a method,
+// a notification has only a method, and a response has only an ID.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *Error           `json:"error"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Error is the error of a failed request.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// Error codes.
+const (
+	CodeParseError           = -32700
+	CodeInvalidRequest       = -32600
+	CodeMethodNotFound       = -32601
+	CodeInvalidParams        = -32602
+	CodeServerNotInitialized = -32002
+	CodeRequestFailed        = -32803
+)
+
+// Position is a zero-based line and character in a document. LSP counts
+// characters in UTF-16 code units, while the lexer counts columns in
+// bytes, so the lines of the document convert between the two.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// lines are the lines of a text, which positions are converted against.
+type lines []string
+
+func splitLines(text string) lines {
+	return strings.Split(text, "\n")
+}
+
+func (ls lines) toPosition(pos tk.Position) Position {
+	line, col := pos.Line-1, pos.Column-1
+	if line < 0 || line >= len(ls) {
+		return Position{Line: line, Character: col}
+	}
+	text := ls[line]
+	if col > len(text) {
+		// Past the end, as EOF is, every byte is a character.
+		return Position{Line: line, Character: utf16Len(text) + col - len(text)}
+	}
+	return Position{Line: line, Character: utf16Len(text[:col])}
+}
+
+func (ls lines) fromPosition(pos Position) tk.Position {
+	if pos.Line < 0 || pos.Line >= len(ls) {
+		return tk.Position{Line: pos.Line + 1, Column: pos.Character + 1}
+	}
+	text := ls[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return tk.Position{Line: pos.Line + 1, Column: i + 1}
+		}
+		units += utf16Len(string(r))
+	}
+	return tk.Position{Line: pos.Line + 1, Column: len(text) + pos.Character - units + 1}
+}
+
+// span returns the range of n bytes from pos on the same line.
+func (ls lines) span(pos tk.Position, n int) Range {
+	end := pos
+	end.Column += n
+	return Range{Start: ls.toPosition(pos), End: ls.toPosition(end)}
+}
+
+// whole returns the range of the whole text.
+func (ls lines) whole() Range {
+	last := len(ls) - 1
+	return Range{End: Position{Line: last, Character: utf16Len(ls[last])}}
+}
+
+// utf16Len returns the number of UTF-16 code units of a string, where
+// the runes beyond the Basic Multilingual Plane take two.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// The server asks for full text sync, so each change holds the new text.
+type DidChangeTextDocumentParams struct {
+	TextDocument   TextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+type DocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// Severities and tags of diagnostics.
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+
+	TagUnnecessary = 1
+)
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+	Tags     []int  `json:"tags,omitempty"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    Range         `json:"range"`
+}
+
+// Kinds of document symbols.
+const (
+	SymbolModule   = 2
+	SymbolFunction = 12
+	SymbolVariable = 13
+)
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+// Kinds of completion items.
+const (
+	CompletionFunction = 3
+	CompletionVariable = 6
+	CompletionModule   = 9
+	CompletionKeyword  = 14
+)
+
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
@@ -0,0 +1,305 @@
+// Package lsp implements a Language Server Protocol server for Monkey.
+//
+// The server talks JSON-RPC over a pair of streams, usually the standard
+// input and output of `monkey lsp`. It publishes the diagnostics of the
+// parser and of the vet rules as documents change, and answers hover,
+// definition, references, document symbol, completion and formatting
+// requests.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ryym/monkey/internal/framing"
+)
+
+// ErrNoShutdown is returned by Run if the client exits or closes the
+// connection without asking the server to shut down first.
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+// Server serves one client.
+type Server struct {
+	// Globals are the names that scripts can use without binding them,
+	// like the args of `monkey run`.
+	Globals []string
+
+	in  *bufio.Reader
+	out io.Writer
+
+	initialized bool
+	shutdown    bool
+	docs        map[string]*document
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// handler handles a request or a notification. The result of a
+// notification is ignored.
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+// Assigned in init since the handlers refer to the server methods.
+func init() {
+	handlers = map[string]handler{
+		"initialize":  (*Server).initialize,
+		"initialized": func(*Server, json.RawMessage) (interface{}, error) { return nil, nil },
+		"shutdown":    (*Server).shutdownServer,
+
+		"textDocument/didOpen":        (*Server).didOpen,
+		"textDocument/didChange":      (*Server).didChange,
+		"textDocument/didClose":       (*Server).didClose,
+		"textDocument/hover":          (*Server).hover,
+		"textDocument/definition":     (*Server).definition,
+		"textDocument/references":     (*Server).references,
+		"textDocument/documentSymbol": (*Server).documentSymbol,
+		"textDocument/completion":     (*Server).completion,
+		"textDocument/formatting":     (*Server).formatting,
+	}
+}
+
+// Run serves messages until the client sends exit. It returns nil if
+// the client asked to shut down first.
+func (s *Server) Run() error {
+	for {
+		body, err := framing.Read(s.in)
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return ErrNoShutdown
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.replyError(nil, &Error{Code: CodeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return ErrNoShutdown
+		}
+		if err := s.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches a message and replies to it if it is a request.
+// It only fails if the reply cannot be written.
+func (s *Server) handle(msg *message) error {
+	isRequest := msg.ID != nil
+	h, ok := handlers[msg.Method]
+	switch {
+	case !ok && isRequest:
+		return s.replyError(msg.ID, &Error{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method})
+	case !ok:
+		return nil // Notifications that the server does not know are dropped.
+	case !s.initialized && msg.Method != "initialize":
+		if isRequest {
+			return s.replyError(msg.ID, &Error{Code: CodeServerNotInitialized, Message: "server not initialized"})
+		}
+		return nil
+	case s.shutdown && isRequest:
+		return s.replyError(msg.ID, &Error{Code: CodeInvalidRequest, Message: "server is shut down"})
+	}
+
+	result, err := h(s, msg.Params)
+	if !isRequest {
+		return nil
+	}
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = &Error{Code: CodeRequestFailed, Message: err.Error()}
+		}
+		return s.replyError(msg.ID, rpcErr)
+	}
+	return framing.Write(s.out, &response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, err *Error) error {
+	return framing.Write(s.out, &errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return framing.Write(s.out, &notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// decode reads the params of a message, failing with an InvalidParams error.
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	if s.initialized {
+		return nil, &Error{Code: CodeInvalidRequest, Message: "server already initialized"}
+	}
+	s.initialized = true
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":           1, // Full
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"referencesProvider":         true,
+			"documentSymbolProvider":     true,
+			"completionProvider":         map[string]interface{}{},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "monkey"},
+	}, nil
+}
+
+func (s *Server) shutdownServer(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc := &document{uri: p.TextDocument.URI}
+	s.docs[doc.uri] = doc
+	return nil, s.update(doc, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok || len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	return nil, s.update(doc, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// update analyzes the new text of a document and publishes its diagnostics.
+func (s *Server) update(doc *document, text string) error {
+	doc.update(text, s.Globals)
+	return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Diagnostics: doc.diagnostics,
+	})
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown document: %s", uri)}
+	}
+	return doc, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	if h := doc.hover(doc.lines.fromPosition(p.Position)); h != nil {
+		return h, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	if loc := doc.definition(doc.lines.fromPosition(p.Position)); loc != nil {
+		return loc, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.references(doc.lines.fromPosition(p.Position), p.Context.IncludeDeclaration), nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.symbols(), nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.completion(doc.lines.fromPosition(p.Position), s.Globals), nil
+}
+
+func (s *Server) formatting(params json.RawMessage) (interface{}, error) {
+	var p DocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.format()
+}
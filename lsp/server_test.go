@@ -0,0 +1,348 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/internal/framing"
+)
+
+const uri = "file:///test.mk"
+
+// normalize compacts a JSON message and sorts its keys.
+func normalize(t *testing.T, msg string) string {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(msg), &v); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, msg)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// session sends the messages to a new server, and returns the error of
+// Run and the messages the server wrote.
+func session(t *testing.T, messages ...string) (error, []string) {
+	t.Helper()
+	in := &bytes.Buffer{}
+	for _, msg := range messages {
+		fmt.Fprintf(in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	out := &bytes.Buffer{}
+	s := NewServer(in, out)
+	s.Globals = []string{"args"}
+	err := s.Run()
+
+	got := []string{}
+	r := bufio.NewReader(out)
+	for {
+		body, readErr := framing.Read(r)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			t.Fatalf("bad output: %s", readErr)
+		}
+		got = append(got, normalize(t, string(body)))
+	}
+	return err, got
+}
+
+func checkMessages(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	for i := range expected {
+		expected[i] = normalize(t, expected[i])
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong messages.\nwant:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+const (
+	initialize  = `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"capabilities":{}}}`
+	initialized = `{"jsonrpc":"2.0","method":"initialized","params":{}}`
+	shutdown    = `{"jsonrpc":"2.0","id":99,"method":"shutdown"}`
+	exit        = `{"jsonrpc":"2.0","method":"exit"}`
+)
+
+func didOpen(text string) string {
+	data, _ := json.Marshal(text)
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"languageId":"monkey","version":1,"text":%s}}}`, uri, data)
+}
+
+func at(id int, method string, line, char int, extra string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"textDocument/%s","params":{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}%s}}`, id, method, uri, line, char, extra)
+}
+
+// requests opens a document and sends the requests about it. It returns
+// the responses to the requests.
+func requests(t *testing.T, text string, reqs ...string) []string {
+	t.Helper()
+	messages := append([]string{initialize, initialized, didOpen(text)}, reqs...)
+	messages = append(messages, shutdown, exit)
+	err, got := session(t, messages...)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	// Drop the initialize result, the diagnostics and the shutdown result.
+	return got[2 : len(got)-1]
+}
+
+func TestLifecycle(t *testing.T) {
+	err, got := session(t,
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{}}`,
+		initialize,
+		initialized,
+		`{"jsonrpc":"2.0","id":"a","method":"workspace/symbol","params":{}}`,
+		`{"jsonrpc":"2.0","method":"$/setTrace","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///none.mk"},"position":{"line":0,"character":0}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":[]}`,
+		`{not json`,
+		shutdown,
+		`{"jsonrpc":"2.0","id":4,"method":"textDocument/hover","params":{}}`,
+		exit,
+	)
+	if err != nil {
+		t.Errorf("Run failed: %s", err)
+	}
+	checkMessages(t, got,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32002,"message":"server not initialized"}}`,
+		`{"jsonrpc":"2.0","id":0,"result":{
+			"capabilities":{
+				"textDocumentSync":1,
+				"hoverProvider":true,
+				"definitionProvider":true,
+				"referencesProvider":true,
+				"documentSymbolProvider":true,
+				"completionProvider":{},
+				"documentFormattingProvider":true
+			},
+			"serverInfo":{"name":"monkey"}
+		}}`,
+		`{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"method not found: workspace/symbol"}}`,
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"unknown document: file:///none.mk"}}`,
+		`{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"json: cannot unmarshal array into Go value of type lsp.TextDocumentPositionParams"}}`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"invalid character 'n' looking for beginning of object key string"}}`,
+		`{"jsonrpc":"2.0","id":99,"result":null}`,
+		`{"jsonrpc":"2.0","id":4,"error":{"code":-32600,"message":"server is shut down"}}`,
+	)
+
+	if err, _ := session(t, initialize, exit); err != ErrNoShutdown {
+		t.Errorf("exit without shutdown: want=%v, got=%v", ErrNoShutdown, err)
+	}
+	if err, _ := session(t, initialize); err != ErrNoShutdown {
+		t.Errorf("end of input without shutdown: want=%v, got=%v", ErrNoShutdown, err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	change := func(text string) string {
+		data, _ := json.Marshal(text)
+		return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":%q,"version":2},"contentChanges":[{"text":%s}]}}`, uri, data)
+	}
+	_, got := session(t,
+		initialize,
+		didOpen("let x = ;\nputs(\"a\" ("),
+		change("let f = fn(a) {\n  return 1;\n  nope\n};\nf(args)"),
+		change("puts(1)"),
+		`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"file:///test.mk"}}}`,
+		shutdown,
+		exit,
+	)
+	checkMessages(t, got[1:len(got)-1],
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///test.mk","diagnostics":[
+			{"range":{"start":{"line":0,"character":8},"end":{"line":0,"character":9}},"severity":1,"source":"monkey","message":"no prefix parse function for ; found"},
+			{"range":{"start":{"line":1,"character":10},"end":{"line":1,"character":10}},"severity":1,"source":"monkey","message":"no prefix parse function for EOF found"},
+			{"range":{"start":{"line":1,"character":11},"end":{"line":1,"character":11}},"severity":1,"source":"monkey","message":"expected next token to be ), got EOF instead"}
+		]}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///test.mk","diagnostics":[
+			{"range":{"start":{"line":0,"character":11},"end":{"line":0,"character":12}},"severity":2,"code":"unused","source":"monkey","message":"parameter a is never used","tags":[1]},
+			{"range":{"start":{"line":2,"character":2},"end":{"line":2,"character":6}},"severity":1,"code":"resolve","source":"monkey","message":"undefined: nope"},
+			{"range":{"start":{"line":2,"character":2},"end":{"line":2,"character":6}},"severity":2,"code":"unreachable","source":"monkey","message":"unreachable code","tags":[1]}
+		]}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///test.mk","diagnostics":[]}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///test.mk","diagnostics":[]}}`,
+	)
+}
+
+const source = `import "lib/util";
+let n = 10;
+let add = fn(a, b) {
+  let sum = a + b;
+  let inner = fn(a) { a + sum };
+  inner(n)
+};
+add(n, util)
+`
+
+func TestHover(t *testing.T) {
+	hover := func(value string, sl, sc, ec int) string {
+		data, _ := json.Marshal("```monkey\n" + value + "\n```")
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":{"contents":{"kind":"markdown","value":%s},"range":{"start":{"line":%d,"character":%d},"end":{"line":%d,"character":%d}}}}`, data, sl, sc, sl, ec)
+	}
+	tests := []struct {
+		line, char int
+		expected   string
+	}{
+		{1, 4, hover("let n: INTEGER", 1, 4, 5)},
+		{7, 0, hover("let add = fn(a, b)", 7, 0, 3)},
+		{7, 3, hover("let add = fn(a, b)", 7, 0, 3)},
+		{3, 16, hover("parameter b", 3, 16, 17)},
+		{4, 22, hover("parameter a\n// shadows the parameter bound at 3:14", 4, 22, 23)},
+		{7, 8, hover(`import "lib/util"`, 7, 7, 11)},
+		{0, 9, hover(`import "lib/util"`, 0, 7, 17)},
+		{1, 0, `{"jsonrpc":"2.0","id":1,"result":null}`},
+	}
+	for _, tt := range tests {
+		got := requests(t, source, at(1, "hover", tt.line, tt.char, ""))
+		checkMessages(t, got, tt.expected)
+	}
+
+	got := requests(t, "puts(args)", at(1, "hover", 0, 1, ""), at(2, "hover", 0, 6, ""))
+	checkMessages(t, got,
+		`{"jsonrpc":"2.0","id":1,"result":{"contents":{"kind":"markdown","value":"`+"```monkey\\nbuiltin puts\\n```"+`"},"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":4}}}}`,
+		`{"jsonrpc":"2.0","id":2,"result":{"contents":{"kind":"markdown","value":"`+"```monkey\\nglobal args\\n```"+`"},"range":{"start":{"line":0,"character":5},"end":{"line":0,"character":9}}}}`,
+	)
+
+	// Characters are UTF-16 code units, of which the string has three.
+	got = requests(t, `let s = "é😀"; let y = s;`, at(1, "hover", 0, 19, ""), at(2, "hover", 0, 23, ""))
+	checkMessages(t, got,
+		hover("let y: STRING", 0, 19, 20),
+		strings.Replace(hover("let s: STRING", 0, 23, 24), `"id":1`, `"id":2`, 1),
+	)
+}
+
+func TestDefinition(t *testing.T) {
+	got := requests(t, source,
+		at(1, "definition", 7, 4, ""),  // n
+		at(2, "definition", 4, 27, ""), // sum in inner
+		at(3, "definition", 4, 22, ""), // a of inner
+		at(4, "definition", 7, 9, ""),  // util
+		at(5, "definition", 6, 0, ""),  // nothing
+		at(6, "definition", 0, 19, ""),
+	)
+	checkMessages(t, got,
+		`{"jsonrpc":"2.0","id":1,"result":{"uri":"file:///test.mk","range":{"start":{"line":1,"character":4},"end":{"line":1,"character":5}}}}`,
+		`{"jsonrpc":"2.0","id":2,"result":{"uri":"file:///test.mk","range":{"start":{"line":3,"character":6},"end":{"line":3,"character":9}}}}`,
+		`{"jsonrpc":"2.0","id":3,"result":{"uri":"file:///test.mk","range":{"start":{"line":4,"character":17},"end":{"line":4,"character":18}}}}`,
+		`{"jsonrpc":"2.0","id":4,"result":{"uri":"file:///test.mk","range":{"start":{"line":0,"character":7},"end":{"line":0,"character":17}}}}`,
+		`{"jsonrpc":"2.0","id":5,"result":null}`,
+		`{"jsonrpc":"2.0","id":6,"result":null}`,
+	)
+
+	got = requests(t, "puts(1)", at(1, "definition", 0, 0, ""))
+	checkMessages(t, got, `{"jsonrpc":"2.0","id":1,"result":null}`)
+}
+
+func TestReferences(t *testing.T) {
+	loc := func(line, start, end int) string {
+		return fmt.Sprintf(`{"uri":"file:///test.mk","range":{"start":{"line":%d,"character":%d},"end":{"line":%d,"character":%d}}}`, line, start, line, end)
+	}
+	got := requests(t, source,
+		at(1, "references", 1, 4, `,"context":{"includeDeclaration":true}`),
+		at(2, "references", 1, 4, `,"context":{"includeDeclaration":false}`),
+		at(3, "references", 3, 6, `,"context":{"includeDeclaration":true}`),
+		at(4, "references", 3, 16, `,"context":{"includeDeclaration":true}`),
+		at(5, "references", 6, 0, `,"context":{"includeDeclaration":true}`),
+	)
+	checkMessages(t, got,
+		`{"jsonrpc":"2.0","id":1,"result":[`+loc(1, 4, 5)+`,`+loc(5, 8, 9)+`,`+loc(7, 4, 5)+`]}`,
+		`{"jsonrpc":"2.0","id":2,"result":[`+loc(5, 8, 9)+`,`+loc(7, 4, 5)+`]}`,
+		`{"jsonrpc":"2.0","id":3,"result":[`+loc(3, 6, 9)+`,`+loc(4, 26, 29)+`]}`,
+		`{"jsonrpc":"2.0","id":4,"result":[`+loc(2, 16, 17)+`,`+loc(3, 16, 17)+`]}`,
+		`{"jsonrpc":"2.0","id":5,"result":[]}`,
+	)
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	got := requests(t, source, `{"jsonrpc":"2.0","id":1,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///test.mk"}}}`)
+	checkMessages(t, got, `{"jsonrpc":"2.0","id":1,"result":[
+		{"name":"util","detail":"\"lib/util\"","kind":2,
+			"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":17}},
+			"selectionRange":{"start":{"line":0,"character":7},"end":{"line":0,"character":17}}},
+		{"name":"n","detail":"INTEGER","kind":13,
+			"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":5}},
+			"selectionRange":{"start":{"line":1,"character":4},"end":{"line":1,"character":5}}},
+		{"name":"add","detail":"fn(a, b)","kind":12,
+			"range":{"start":{"line":2,"character":0},"end":{"line":6,"character":1}},
+			"selectionRange":{"start":{"line":2,"character":4},"end":{"line":2,"character":7}},
+			"children":[
+				{"name":"sum","kind":13,
+					"range":{"start":{"line":3,"character":2},"end":{"line":3,"character":9}},
+					"selectionRange":{"start":{"line":3,"character":6},"end":{"line":3,"character":9}}},
+				{"name":"inner","detail":"fn(a)","kind":12,
+					"range":{"start":{"line":4,"character":2},"end":{"line":4,"character":31}},
+					"selectionRange":{"start":{"line":4,"character":6},"end":{"line":4,"character":11}}}
+			]}
+	]}`)
+}
+
+func TestCompletion(t *testing.T) {
+	labels := func(response string) string {
+		var msg struct {
+			Result []CompletionItem
+		}
+		if err := json.Unmarshal([]byte(response), &msg); err != nil {
+			t.Fatalf("invalid response: %s", response)
+		}
+		names := []string{}
+		for _, item := range msg.Result {
+			if item.Kind != CompletionKeyword {
+				names = append(names, fmt.Sprintf("%s:%d:%s", item.Label, item.Kind, item.Detail))
+			}
+		}
+		return strings.Join(names, " ")
+	}
+
+	globals := "add:3:fn(a, b) args:6:global json_parse:3:builtin json_stringify:3:builtin n:6:INTEGER puts:3:builtin util:9:import"
+	tests := []struct {
+		line, char int
+		expected   string
+	}{
+		{8, 0, globals},
+		// Before sum is bound in add.
+		{3, 2, "a:6:parameter add:3:fn(a, b) args:6:global b:6:parameter json_parse:3:builtin json_stringify:3:builtin n:6:INTEGER puts:3:builtin util:9:import"},
+		// In inner, whose a hides the one of add.
+		{4, 22, "a:6:parameter add:3:fn(a, b) args:6:global b:6:parameter inner:3:fn(a) json_parse:3:builtin json_stringify:3:builtin n:6:INTEGER puts:3:builtin sum:6:let util:9:import"},
+	}
+	for _, tt := range tests {
+		got := requests(t, source, at(1, "completion", tt.line, tt.char, ""))
+		if labels(got[0]) != tt.expected {
+			t.Errorf("%d:%d: wrong items.\nwant=%s\ngot= %s", tt.line, tt.char, tt.expected, labels(got[0]))
+		}
+	}
+
+	// While the text does not parse, the names of the last good text are used.
+	data, _ := json.Marshal("let x = 1;\nx +")
+	got := requests(t, "let x = 1;",
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":%q,"version":2},"contentChanges":[{"text":%s}]}}`, uri, data),
+		at(1, "completion", 1, 3, ""),
+	)
+	if want := "args:6:global json_parse:3:builtin json_stringify:3:builtin puts:3:builtin x:6:INTEGER"; labels(got[1]) != want {
+		t.Errorf("wrong items after an edit.\nwant=%s\ngot= %s", want, labels(got[1]))
+	}
+	if !strings.Contains(got[1], `{"kind":14,"label":"let"}`) {
+		t.Errorf("keyword let not suggested: %s", got[1])
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	req := `{"jsonrpc":"2.0","id":1,"method":"textDocument/formatting","params":{"textDocument":{"uri":"file:///test.mk"},"options":{"tabSize":4,"insertSpaces":false}}}`
+
+	got := requests(t, "let x=1;\nputs( x )", req)
+	checkMessages(t, got, `{"jsonrpc":"2.0","id":1,"result":[{"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":9}},"newText":"let x = 1;\nputs(x);\n"}]}`)
+
+	got = requests(t, "let x = 1;\n", req)
+	checkMessages(t, got, `{"jsonrpc":"2.0","id":1,"result":[]}`)
+
+	got = requests(t, "#!/usr/bin/env monkey\nlet x=1;", req)
+	checkMessages(t, got, `{"jsonrpc":"2.0","id":1,"result":[{"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":8}},"newText":"#!/usr/bin/env monkey\nlet x = 1;\n"}]}`)
+
+	got = requests(t, "let x = ;", req)
+	checkMessages(t, got, `{"jsonrpc":"2.0","id":1,"error":{"code":-32803,"message":"parse error: no prefix parse function for ; found"}}`)
+}
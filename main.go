@@ -1,19 +1,294 @@
+// Command monkey runs Monkey scripts and the interactive REPL.
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
 
+	"github.com/ryym/monkey/coverage"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/profiler"
 	"github.com/ryym/monkey/repl"
 )
 
+const usage = `usage:
+  monkey run [-cpuprofile file] [-top n] <file> [args...]
+                               run a script, optionally profiling it
+  monkey run [-cover] [-coverprofile file] [-coverhtml file] <file> [args...]
+                               run a script, measuring its coverage
+  monkey debug <file> [args...]
+                               run a script under the debugger
+  monkey -e <src> [args...]    evaluate the source and print the result
+  monkey repl                  start the interactive REPL
+  monkey fmt [-w|-l|-d] [path...]
+                               format scripts, or the standard input
+  monkey parse [-json|-dot|-sexp] [file]
+                               print the syntax tree of a script
+  monkey vet [-json] [-rule...] [path...]
+                               report suspicious code in scripts
+  monkey test [-run regexp] [-format text|tap|junit] [path...]
+                               run the tests of scripts
+  monkey lsp                   serve the Language Server Protocol over stdio
+  monkey dap [-port n]         serve the Debug Adapter Protocol over stdio or TCP
+  monkey                       run the program piped to stdin, or start the REPL
+
+Imported modules are searched relative to the importing file, then in
+the directories listed in MONKEY_PATH.
+
+Tests are the top-level functions named test_* in files named *_test.mk.
+They check what they expect with assert(value), assert_eq(got, want) and
+assert_error(fn), each taking an optional message.
+`
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // The program could not be parsed or failed at runtime
+	exitUsage = 2
+)
+
 func main() {
-	user, err := user.Current()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli holds the standard streams so that commands can be tested.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// subcommands maps the first argument to the command it runs.
+var subcommands = map[string]func(c *cli, args []string) int{
+	"run":   (*cli).runFile,
+	"-e":    (*cli).runSource,
+	"repl":  (*cli).repl,
+	"fmt":   (*cli).formatFiles,
+	"parse": (*cli).parseFile,
+	"vet":   (*cli).vetFiles,
+	"lsp":   (*cli).serveLSP,
+	"debug": (*cli).debugFile,
+	"dap":   (*cli).serveDAP,
+	"test":  (*cli).testFiles,
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 {
+		if isTerminal(stdin) {
+			return c.repl(nil)
+		}
+		return c.runStdin()
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		io.WriteString(stdout, usage)
+		return exitOK
+	}
+
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command: %s\n", args[0])
+		io.WriteString(stderr, usage)
+		return exitUsage
+	}
+	return cmd(c, args[1:])
+}
+
+// runFile runs a script. With -cpuprofile or -top, it is profiled as it
+// runs, and with the coverage flags its coverage is measured. Either is
+// written once the script ends, even if it failed.
+func (c *cli) runFile(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		io.WriteString(c.stderr, "usage: monkey run [-cpuprofile file] [-top n] [-cover] [-coverprofile file] [-coverhtml file] <file> [args...]\n")
+		flags.PrintDefaults()
+	}
+	cpuprofile := flags.String("cpuprofile", "", "write a profile for `go tool pprof` to the file")
+	top := flags.Int("top", 0, "print the n functions and lines taking the most time to stderr")
+	cover := flags.Bool("cover", false, "print the coverage of each file to stderr")
+	coverprofile := flags.String("coverprofile", "", "write the coverage to the file in the LCOV format")
+	coverhtml := flags.String("coverhtml", "", "write the coverage to the file as an HTML page")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+	profiling := *cpuprofile != "" || *top > 0
+	covering := *cover || *coverprofile != "" || *coverhtml != ""
+	if len(args) == 0 || profiling && covering {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var prof *profiler.Profiler
+	var cov *coverage.Coverage
+	var hook object.Hook
+	switch {
+	case profiling:
+		prof = profiler.New()
+		hook = prof
+	case covering:
+		cov = coverage.New()
+		hook = cov
+	}
+	_, code := c.exec(args[0], args[1:], func(in *interp.Interpreter) (object.Object, error) {
+		if hook != nil {
+			in.SetHook(hook)
+		}
+		return in.EvalFile(args[0])
+	})
+
+	var err error
+	switch {
+	case prof != nil:
+		prof.Stop()
+		if *top > 0 {
+			prof.WriteReport(c.stderr, *top)
+		}
+		if *cpuprofile != "" {
+			err = writeFile(*cpuprofile, prof.WriteProto)
+		}
+	case cov != nil:
+		err = c.writeCoverage(cov, *cover, *coverprofile, *coverhtml)
+	}
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	return code
+}
+
+func (c *cli) writeCoverage(cov *coverage.Coverage, summary bool, lcov, html string) error {
+	report, err := cov.Report()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if summary {
+		if err := report.WriteText(c.stderr); err != nil {
+			return err
+		}
+	}
+	if lcov != "" {
+		if err := writeFile(lcov, report.WriteLCOV); err != nil {
+			return err
+		}
+	}
+	if html != "" {
+		return writeFile(html, report.WriteHTML)
+	}
+	return nil
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *cli) runSource(args []string) int {
+	if len(args) == 0 {
+		io.WriteString(c.stderr, "usage: monkey -e <src> [args...]\n")
+		return exitUsage
+	}
+	result, code := c.exec("-e", args[1:], func(in *interp.Interpreter) (object.Object, error) {
+		return in.Eval(args[0])
+	})
+	if result != nil && result != evaluator.NULL {
+		fmt.Fprintln(c.stdout, result.Inspect())
+	}
+	return code
+}
+
+func (c *cli) runStdin() int {
+	src, err := ioutil.ReadAll(c.stdin)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	_, code := c.exec("<stdin>", nil, func(in *interp.Interpreter) (object.Object, error) {
+		return in.Eval(string(src))
+	})
+	return code
+}
+
+func (c *cli) repl(args []string) int {
+	if len(args) > 0 {
+		io.WriteString(c.stderr, "usage: monkey repl\n")
+		return exitUsage
+	}
+	if u, err := user.Current(); err == nil {
+		fmt.Fprintf(c.stdout, "Hello %s! This is the Monkey programming language!\n", u.Username)
+	}
+	fmt.Fprintln(c.stdout, "Feel free to type in commands")
+	repl.Start(c.stdin, c.stdout)
+	return exitOK
+}
+
+// exec evaluates a program with its arguments bound to `args`.
+// Errors are reported to stderr with the name of the program.
+func (c *cli) exec(
+	name string,
+	args []string,
+	eval func(in *interp.Interpreter) (object.Object, error),
+) (object.Object, int) {
+	evaluator.Stdout = c.stdout
+
+	in := interp.New()
+	in.SetSearchPath(filepath.SplitList(os.Getenv("MONKEY_PATH"))...)
+	if args == nil {
+		args = []string{}
+	}
+	if err := in.SetGlobal("args", args); err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %s\n", err)
+		return nil, exitError
+	}
+
+	result, err := eval(in)
+	switch err := err.(type) {
+	case nil:
+		return result, exitOK
+	case *interp.ParseError:
+		fmt.Fprintf(c.stderr, "%s: parse error\n", name)
+		for _, msg := range err.Errors {
+			fmt.Fprintf(c.stderr, "\t%s\n", msg)
+		}
+	case *interp.ResolveError:
+		fmt.Fprintf(c.stderr, "%s: resolve error\n", name)
+		for _, d := range err.Diagnostics {
+			fmt.Fprintf(c.stderr, "\t%s\n", d)
+		}
+	case *object.Error:
+		fmt.Fprintf(c.stderr, "%s: %s\n", name, err)
+		for _, frame := range err.Stack {
+			fmt.Fprintf(c.stderr, "\t%s\n", frame)
+		}
+	default:
+		fmt.Fprintf(c.stderr, "%s: %s\n", name, err)
+	}
+	return nil, exitError
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Println("Feel free to type in commands")
-	repl.Start(os.Stdin, os.Stdout)
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/internal/scripttest"
+)
+
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestRunFile(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", `#!/usr/bin/env monkey
+let greet = fn(name) { puts("hello", name) };
+greet(args[0]);
+puts(args);
+`)
+
+	stdout, stderr, code := runCLI(t, "", "run", path, "world", "-e")
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if want := "hello world\n[world, -e]\n"; stdout != want {
+		t.Errorf("wrong output. want=%q, got=%q", want, stdout)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			"let x = ;",
+			"FILE: parse error\n\tno prefix parse function for ; found\n",
+		},
+		{
+			"let f = fn(x) {\n  x + y;\n};\nz",
+			"FILE: resolve error\n\t2:7: undefined: y\n\t4:1: undefined: z\n",
+		},
+		{
+			"#!/usr/bin/env monkey\nlet f = fn() { 1 + true };\nf();",
+			"FILE: TypeError: type mismatch: INTEGER + BOOLEAN\n" +
+				"\tat f (FILE:2:18)\n" +
+				"\tat <main> (FILE:3:2)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		path := scripttest.WriteFile(t, "script.mk", tt.src)
+		stdout, stderr, code := runCLI(t, "", "run", path)
+		if code != exitError {
+			t.Errorf("%q: wrong exit code. got=%d", tt.src, code)
+		}
+		if stdout != "" {
+			t.Errorf("%q: unexpected output: %q", tt.src, stdout)
+		}
+		if want := strings.ReplaceAll(tt.expected, "FILE", path); stderr != want {
+			t.Errorf("%q: wrong error.\nwant=%q\ngot= %q", tt.src, want, stderr)
+		}
+	}
+}
+
+func TestRunImportError(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "import \"nope\";\n")
+
+	_, stderr, code := runCLI(t, "", "run", path)
+	if code != exitError {
+		t.Errorf("wrong exit code. got=%d", code)
+	}
+	want := path + ": ImportError: cannot find module \"nope\" (import chain: " + path + ")\n" +
+		"\tat <main> (" + path + ":1:1)\n"
+	if stderr != want {
+		t.Errorf("wrong error.\nwant=%q\ngot= %q", want, stderr)
+	}
+}
+
+func TestRunImportArgs(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "import \"show\";\nputs(show.first());\n")
+	if err := ioutil.WriteFile(filepath.Join(filepath.Dir(path), "show.mk"), []byte("let first = fn() { args[0] };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runCLI(t, "", "run", path, "hi")
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if stdout != "hi\n" {
+		t.Errorf("wrong output. got=%q", stdout)
+	}
+}
+
+func TestRunSource(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-e", "1 + 2"}, "3\n"},
+		{[]string{"-e", `"a" + args[0]`, "b"}, "ab\n"},
+		{[]string{"-e", `puts("x")`}, "x\n"},
+		{[]string{"-e", "let a = 1;"}, ""},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runCLI(t, "", tt.args...)
+		if code != exitOK {
+			t.Errorf("%v: wrong exit code. got=%d, stderr=%q", tt.args, code, stderr)
+		}
+		if stdout != tt.expected {
+			t.Errorf("%v: wrong output. want=%q, got=%q", tt.args, tt.expected, stdout)
+		}
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	stdout, stderr, code := runCLI(t, "let x = 2;\nputs(x * 3);")
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if stdout != "6\n" {
+		t.Errorf("wrong output. got=%q", stdout)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"help"}, exitOK},
+		{[]string{"nope"}, exitUsage},
+		{[]string{"run"}, exitUsage},
+		{[]string{"-e"}, exitUsage},
+		{[]string{"repl", "x"}, exitUsage},
+		{[]string{"run", "does-not-exist.mk"}, exitError},
+	}
+
+	for _, tt := range tests {
+		_, _, code := runCLI(t, "", tt.args...)
+		if code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d", tt.args, tt.code, code)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	unformatted := "let x=1;\nputs( x )\n"
+	formatted := "let x = 1;\nputs(x);\n"
+
+	stdout, stderr, code := runCLI(t, unformatted, "fmt")
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if stdout != formatted {
+		t.Errorf("wrong output. want=%q, got=%q", formatted, stdout)
+	}
+
+	path := scripttest.WriteFile(t, "script.mk", unformatted)
+	clean := filepath.Join(filepath.Dir(path), "clean.mk")
+	if err := ioutil.WriteFile(clean, []byte(formatted), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(filepath.Dir(path), "notes.txt")
+	if err := ioutil.WriteFile(other, []byte("not monkey"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code = runCLI(t, "", "fmt", "-l", filepath.Dir(path))
+	if code != exitOK || stdout != path+"\n" {
+		t.Errorf("wrong -l output. code=%d, got=%q", code, stdout)
+	}
+
+	stdout, _, _ = runCLI(t, "", "fmt", "-d", path)
+	diff := "--- " + path + ".orig\n+++ " + path + "\n" +
+		"@@ -1,2 +1,2 @@\n-let x=1;\n-puts( x )\n+let x = 1;\n+puts(x);\n"
+	if stdout != diff {
+		t.Errorf("wrong -d output.\nwant=%q\ngot= %q", diff, stdout)
+	}
+
+	stdout, _, code = runCLI(t, "", "fmt", "-w", path)
+	if code != exitOK || stdout != "" {
+		t.Errorf("wrong -w result. code=%d, output=%q", code, stdout)
+	}
+	if src, _ := ioutil.ReadFile(path); string(src) != formatted {
+		t.Errorf("file not rewritten. got=%q", src)
+	}
+
+	_, stderr, code = runCLI(t, "let = 1;", "fmt")
+	if code != exitError || !strings.HasPrefix(stderr, "<standard input>: parse error\n") {
+		t.Errorf("wrong parse error. code=%d, stderr=%q", code, stderr)
+	}
+}
+
+func TestParse(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "let x = 1 + 2 * 3;\n")
+
+	stdout, stderr, code := runCLI(t, "", "parse", path)
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if want := "let x = (1 + (2 * 3));\n"; stdout != want {
+		t.Errorf("wrong output. want=%q, got=%q", want, stdout)
+	}
+
+	stdout, stderr, code = runCLI(t, "", "parse", "--json", path)
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	node, err := ast.UnmarshalJSON([]byte(stdout))
+	if err != nil {
+		t.Fatalf("invalid output: %s\n%s", err, stdout)
+	}
+	if node.String() != "let x = (1 + (2 * 3));" {
+		t.Errorf("wrong tree. got=%q", node.String())
+	}
+	if !strings.HasPrefix(stdout, "{\n  \"kind\": \"Program\",\n") {
+		t.Errorf("output is not indented. got=%q", stdout)
+	}
+
+	stdout, _, code = runCLI(t, "", "parse", "-sexp", path)
+	if want := "(program (let x (+ 1 (* 2 3))))\n"; code != exitOK || stdout != want {
+		t.Errorf("wrong -sexp output. code=%d, want=%q, got=%q", code, want, stdout)
+	}
+
+	stdout, _, code = runCLI(t, "", "parse", "-dot", path)
+	if code != exitOK || !strings.HasPrefix(stdout, "digraph AST {\n") || !strings.HasSuffix(stdout, "}\n") {
+		t.Errorf("wrong -dot output. code=%d, got=%q", code, stdout)
+	}
+
+	_, _, code = runCLI(t, "", "parse", "-dot", "-json", path)
+	if code != exitUsage {
+		t.Errorf("wrong exit code for two formats. got=%d", code)
+	}
+
+	_, stderr, code = runCLI(t, "let = 1;", "parse", "-json")
+	if code != exitError {
+		t.Errorf("wrong exit code. got=%d", code)
+	}
+	if !strings.HasPrefix(stderr, "<standard input>: parse error\n\t") {
+		t.Errorf("wrong error. got=%q", stderr)
+	}
+}
+
+func TestVet(t *testing.T) {
+	src := "let f = fn(a, b) {\n" +
+		"  return a == a;\n" +
+		"  b\n" +
+		"};\n" +
+		"f(args, nope)\n"
+	path := scripttest.WriteFile(t, "script.mk", src)
+
+	stdout, stderr, code := runCLI(t, "", "vet", path)
+	if code != exitError {
+		t.Errorf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	want := "FILE:2:12: comparison of a with itself is always true (selfcompare)\n" +
+		"FILE:3:3: unreachable code (unreachable)\n" +
+		"FILE:5:9: undefined: nope (resolve)\n"
+	if want = strings.ReplaceAll(want, "FILE", path); stdout != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, stdout)
+	}
+
+	// Only the rules set to true run, or all but those set to false.
+	stdout, _, _ = runCLI(t, "", "vet", "-unreachable", path)
+	if strings.Count(stdout, "\n") != 2 || !strings.Contains(stdout, "(unreachable)") {
+		t.Errorf("wrong output with -unreachable. got=%q", stdout)
+	}
+	stdout, _, _ = runCLI(t, "", "vet", "-unreachable=false", "-selfcompare=false", path)
+	if strings.Count(stdout, "\n") != 1 {
+		t.Errorf("wrong output with rules disabled. got=%q", stdout)
+	}
+
+	stdout, _, code = runCLI(t, "let f = fn(x) { 1 }; f(1)", "vet", "-json")
+	if code != exitError {
+		t.Errorf("wrong exit code. got=%d", code)
+	}
+	var results []vetResult
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("invalid output: %s\n%s", err, stdout)
+	}
+	wantResult := vetResult{"<standard input>", 1, 12, "unused", "parameter x is never used"}
+	if len(results) != 1 || results[0] != wantResult {
+		t.Errorf("wrong results. got=%+v", results)
+	}
+
+	stdout, _, code = runCLI(t, "let f = fn(x) { 1 }; f(1)", "vet", "-json", "-unused.params=false")
+	if code != exitOK || stdout != "[]\n" {
+		t.Errorf("wrong output with -unused.params=false. code=%d, got=%q", code, stdout)
+	}
+
+	_, stderr, code = runCLI(t, "let = 1;", "vet")
+	if code != exitError || !strings.HasPrefix(stderr, "<standard input>: parse error\n") {
+		t.Errorf("wrong parse error. code=%d, stderr=%q", code, stderr)
+	}
+}
+
+func TestLSP(t *testing.T) {
+	stdin := ""
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.mk","text":"puts(args)"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		stdin += fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	stdout, stderr, code := runCLI(t, stdin, "lsp")
+	if code != exitOK {
+		t.Errorf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	// The script uses the arguments of monkey run, which are not undefined.
+	if want := `"diagnostics":[]`; !strings.Contains(stdout, want) {
+		t.Errorf("output does not contain %s. got=%q", want, stdout)
+	}
+
+	_, stderr, code = runCLI(t, "", "lsp")
+	if code != exitError || stderr != "monkey lsp: exit without shutdown\n" {
+		t.Errorf("wrong result without shutdown. code=%d, stderr=%q", code, stderr)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "let x = args[0];\nputs(x);\n")
+
+	stdout, stderr, code := runCLI(t, "next\nprint x\ncontinue\n", "debug", path, "hi")
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	want := "at <main> (FILE:1:1)\n   1\tlet x = args[0];\n" +
+		"(debug) at <main> (FILE:2:1)\n   2\tputs(x);\n" +
+		"(debug) hi\n(debug) hi\n"
+	if got := strings.ReplaceAll(stdout, path, "FILE"); got != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, got)
+	}
+
+	_, _, code = runCLI(t, "quit\n", "debug", path)
+	if code != exitError {
+		t.Errorf("wrong exit code after quit. got=%d", code)
+	}
+
+	_, stderr, code = runCLI(t, "", "debug")
+	if code != exitUsage || stderr != "usage: monkey debug <file> [args...]\n" {
+		t.Errorf("wrong result without a file. code=%d, stderr=%q", code, stderr)
+	}
+}
+
+func TestDAP(t *testing.T) {
+	stdin := ""
+	for _, msg := range []string{
+		`{"seq":1,"type":"request","command":"initialize","arguments":{}}`,
+		`{"seq":2,"type":"request","command":"disconnect"}`,
+	} {
+		stdin += fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	stdout, stderr, code := runCLI(t, stdin, "dap")
+	if code != exitOK {
+		t.Errorf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if want := `"request_seq":2,"success":true,"command":"disconnect"`; !strings.Contains(stdout, want) {
+		t.Errorf("output does not contain %s. got=%q", want, stdout)
+	}
+
+	_, _, code = runCLI(t, "", "dap", "file.mk")
+	if code != exitUsage {
+		t.Errorf("wrong exit code with an argument. got=%d", code)
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "let f = fn(x) { x + 1 };\nputs(f(41), args[0]);\n")
+	out := filepath.Join(filepath.Dir(path), "out.pb")
+
+	// Every row is shown, since which ranks first depends on the timing.
+	stdout, stderr, code := runCLI(t, "", "run", "-cpuprofile", out, "-top", "10", path, "hi")
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if stdout != "42 hi\n" {
+		t.Errorf("wrong output. got=%q", stdout)
+	}
+	for _, want := range []string{"Functions\n", "Lines\n", "  <main> ("} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("report does not contain %q. got=%q", want, stderr)
+		}
+	}
+	if info, err := os.Stat(out); err != nil || info.Size() == 0 {
+		t.Errorf("profile not written: %v", err)
+	}
+
+	_, stderr, code = runCLI(t, "", "run", "-top", "1")
+	if code != exitUsage || !strings.HasPrefix(stderr, "usage: monkey run [-cpuprofile file] [-top n] [-cover] [-coverprofile file] [-coverhtml file] <file> [args...]\n") {
+		t.Errorf("wrong result without a file. code=%d, stderr=%q", code, stderr)
+	}
+}
+
+func TestRunCoverage(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "let f = fn(x) { if (x) { 1 } else { 2 } };\nputs(f(true));\n")
+	dir := filepath.Dir(path)
+	lcov, html := filepath.Join(dir, "out.lcov"), filepath.Join(dir, "out.html")
+
+	stdout, stderr, code := runCLI(t, "", "run", "-cover", "-coverprofile", lcov, "-coverhtml", html, path)
+	if code != exitOK {
+		t.Fatalf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	if stdout != "1\n" {
+		t.Errorf("wrong output. got=%q", stdout)
+	}
+	want := path + ": 80.0% of 5 statements, 50.0% of 2 branches\ntotal: 80.0% of 5 statements, 50.0% of 2 branches\n"
+	if stderr != want {
+		t.Errorf("wrong summary.\nwant=%q\ngot= %q", want, stderr)
+	}
+	for _, file := range []string{lcov, html} {
+		if info, err := os.Stat(file); err != nil || info.Size() == 0 {
+			t.Errorf("%s not written: %v", file, err)
+		}
+	}
+
+	_, _, code = runCLI(t, "", "run", "-cover", "-top", "1", path)
+	if code != exitUsage {
+		t.Errorf("wrong exit code when profiling with coverage. got=%d", code)
+	}
+}
+
+func TestTest(t *testing.T) {
+	path := scripttest.WriteFile(t, "script.mk", "")
+	dir := filepath.Dir(path)
+	src := "import \"script\";\nlet test_ok = fn() { assert(true) };\nlet test_bad = fn() { assert_eq(1 + 1, 3) };\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "script_test.mk"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Durations vary, so they are left out.
+	times := regexp.MustCompile(`[0-9.]+ms`)
+
+	stdout, stderr, code := runCLI(t, "", "test", dir)
+	if code != exitError {
+		t.Errorf("wrong exit code. got=%d, stderr=%q", code, stderr)
+	}
+	want := "PASS DIR/script_test.mk: test_ok (ms)\n" +
+		"FAIL DIR/script_test.mk: test_bad (ms)\n" +
+		"\tAssertionError: values are not equal\n" +
+		"\t--- want\n\t+++ got\n\t@@ -1 +1 @@\n\t-3\n\t+2\n" +
+		"\tat test_bad (DIR/script_test.mk:3:32)\n" +
+		"FAIL: 1 of 2 tests failed (ms)\n"
+	want = strings.ReplaceAll(want, "DIR", dir)
+	if got := times.ReplaceAllString(stdout, "ms"); got != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, got)
+	}
+
+	stdout, _, code = runCLI(t, "", "test", "-run", "ok", "-format", "tap", dir)
+	if code != exitOK {
+		t.Errorf("wrong exit code with -run. got=%d", code)
+	}
+	if want := "TAP version 13\n1..1\nok 1 - " + dir + "/script_test.mk: test_ok # time=ms\n"; times.ReplaceAllString(stdout, "ms") != want {
+		t.Errorf("wrong TAP.\nwant=%q\ngot= %q", want, stdout)
+	}
+
+	stdout, _, _ = runCLI(t, "", "test", "-format", "junit", dir)
+	if !strings.Contains(stdout, `<testsuites tests="2" failures="1" errors="0"`) {
+		t.Errorf("wrong JUnit XML. got=%q", stdout)
+	}
+
+	// The assertions are known to vet in test files.
+	if stdout, _, code := runCLI(t, "", "vet", dir); code != exitOK {
+		t.Errorf("vet reported on the tests. got=%q", stdout)
+	}
+
+	for _, args := range [][]string{{"-format", "xml"}, {"-run", "("}} {
+		if _, _, code := runCLI(t, "", append([]string{"test"}, args...)...); code != exitUsage {
+			t.Errorf("wrong exit code for %q. got=%d", args, code)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package object
+
+import (
+	"sort"
+
+	"github.com/ryym/monkey/ast"
+)
+
+func NewEnvironment() *Environment {
+	return &Environment{outer: nil, Function: "<main>"}
+}
+
+// NewEnclosedEnvironment creates an environment that falls back to
+// the outer one for names it does not define itself.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.File = outer.File
+	env.Importer = outer.Importer
+	env.Hook = outer.Hook
+	return env
+}
+
+// NewFunctionEnvironment creates the environment of a call to a resolved
+// function. Its locals are kept in slots, one for each of the names.
+func NewFunctionEnvironment(outer *Environment, locals []string) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.locals = locals
+	env.slots = make([]Object, len(locals))
+	return env
+}
+
+type Environment struct {
+	// The values bound by name, made on the first binding since the
+	// environments of resolved functions rarely need it.
+	store map[string]Object
+	outer *Environment
+
+	// The values of the locals of a resolved function, by slot.
+	// A slot is nil until its name is bound.
+	slots  []Object
+	locals []string
+
+	// Function is the name of the function whose call created
+	// this environment, used to build stack traces.
+	Function string
+
+	// File is the source file of the code running in this environment.
+	// Relative imports are resolved from its directory.
+	File string
+
+	// Importer loads the modules imported in this environment.
+	Importer Importer
+
+	// Hook observes the evaluation of code in this environment.
+	Hook Hook
+}
+
+// Hook observes a program as it runs, as debuggers do. The evaluator
+// calls Before for each statement and expression, and Call and Return
+// around each call of a function, with the environment of the call.
+type Hook interface {
+	Before(node ast.Node, env *Environment)
+	Call(call *ast.CallExpression, fn *Function, env *Environment)
+	Return(call *ast.CallExpression, fn *Function, result Object)
+}
+
+// Importer loads the module at a path imported from a file, and
+// returns either a *Module or an *Error.
+type Importer interface {
+	Import(path, from string) Object
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok {
+		obj, ok = e.local(name)
+	}
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) local(name string) (Object, bool) {
+	for i, local := range e.locals {
+		if local == name && e.slots[i] != nil {
+			return e.slots[i], true
+		}
+	}
+	return nil, false
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
+	e.store[name] = val
+	return val
+}
+
+// Slot returns the value in a slot of the environment depth levels out,
+// or nil if the slot is not bound yet.
+func (e *Environment) Slot(depth, slot int) Object {
+	env := e
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.outer
+	}
+	if env == nil || slot >= len(env.slots) {
+		return nil
+	}
+	return env.slots[slot]
+}
+
+func (e *Environment) SetSlot(slot int, val Object) Object {
+	e.slots[slot] = val
+	return val
+}
+
+// Names returns the names visible from this environment in alphabetical order.
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+		for i, name := range env.locals {
+			if env.slots[i] != nil {
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Outer returns the environment enclosing this one, or nil for a global
+// environment.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// OwnNames returns the names bound in this environment itself, not in
+// the ones enclosing it, in alphabetical order.
+func (e *Environment) OwnNames() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	for i, name := range e.locals {
+		if e.slots[i] != nil {
+			if _, ok := e.store[name]; !ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,6 +1,14 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	tk "github.com/ryym/monkey/token"
+)
 
 type ObjectType string
 
@@ -10,6 +18,28 @@ const (
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	RECORD_OBJ       = "RECORD"
+	MODULE_OBJ       = "MODULE"
+)
+
+// Kinds of errors.
+const (
+	// Raised by throwing a value that is not an error.
+	THROWN_ERROR    = "Error"
+	TYPE_ERROR      = "TypeError"
+	REFERENCE_ERROR = "ReferenceError"
+	VALUE_ERROR     = "ValueError"
+	IMPORT_ERROR    = "ImportError"
+	// Returned by a host (Go) function.
+	HOST_ERROR = "HostError"
+	// Raised by the assertions of tests.
+	ASSERTION_ERROR = "AssertionError"
 )
 
 type Object interface {
@@ -17,6 +47,12 @@ type Object interface {
 	Inspect() string
 }
 
+// Members is implemented by objects whose members can be accessed
+// with the dot operator.
+type Members interface {
+	Member(name string) (Object, bool)
+}
+
 type Integer struct {
 	Value int64
 }
@@ -64,7 +100,26 @@ func (r *ReturnValue) Inspect() string {
 }
 
 type Error struct {
+	Kind    string
 	Message string
+
+	// Stack is the Monkey-level call stack at the point the error was
+	// raised, innermost frame first.
+	Stack []StackFrame
+}
+
+// StackFrame is a function being executed when an error was raised.
+type StackFrame struct {
+	Function string      // Function name, "<anonymous>", "<main>" or "<module name>"
+	File     string      // Source file, if the code was loaded from one
+	Pos      tk.Position // Where the execution was in the function
+}
+
+func (f StackFrame) String() string {
+	if f.File != "" {
+		return fmt.Sprintf("at %s (%s:%s)", f.Function, f.File, f.Pos)
+	}
+	return fmt.Sprintf("at %s (%s)", f.Function, f.Pos)
 }
 
 func (e *Error) Type() ObjectType {
@@ -74,3 +129,265 @@ func (e *Error) Type() ObjectType {
 func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
+
+// Error implements the error interface so that embedders can return
+// Monkey errors as Go errors.
+func (e *Error) Error() string {
+	return e.Kind + ": " + e.Message
+}
+
+// ErrorValue is an error caught by a catch block. Unlike Error, it is
+// an ordinary value that does not abort the evaluation.
+type ErrorValue struct {
+	Error *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType {
+	return ERROR_VALUE_OBJ
+}
+
+func (ev *ErrorValue) Inspect() string {
+	return ev.Error.Kind + ": " + ev.Error.Message
+}
+
+func (ev *ErrorValue) Member(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: ev.Error.Message}, true
+	case "kind":
+		return &String{Value: ev.Error.Kind}, true
+	case "stack":
+		frames := make([]string, len(ev.Error.Stack))
+		for i, f := range ev.Error.Stack {
+			frames[i] = f.String()
+		}
+		return &String{Value: strings.Join(frames, "\n")}, true
+	default:
+		return nil, false
+	}
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+
+func (s *String) Inspect() string {
+	return s.Value
+}
+
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Name       string
+	Locals     []string // Set if the function was resolved
+}
+
+func (f *Function) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType {
+	return BUILTIN_OBJ
+}
+
+func (b *Builtin) Inspect() string {
+	return "builtin function"
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (ao *Array) Type() ObjectType {
+	return ARRAY_OBJ
+}
+
+func (ao *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range ao.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects usable as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash remembers the order in which keys were added.
+// Use Set to add pairs so that the order is kept.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // Keys of Pairs in insertion order
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set adds or replaces a pair. A replaced pair keeps its original position.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+// OrderedPairs returns the pairs in insertion order.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.OrderedPairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Record is a read-only set of named fields, such as a Go struct
+// exposed to scripts. The fields are accessed with the dot operator.
+type Record struct {
+	Name   string
+	Fields []RecordField // In declaration order
+}
+
+type RecordField struct {
+	Name  string
+	Value Object
+}
+
+func (r *Record) Type() ObjectType {
+	return RECORD_OBJ
+}
+
+func (r *Record) Inspect() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range r.Fields {
+		fields = append(fields, f.Name+": "+f.Value.Inspect())
+	}
+
+	out.WriteString(r.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (r *Record) Member(name string) (Object, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Module is an imported source file. Only its exported bindings are
+// accessible with the dot operator.
+type Module struct {
+	Name    string
+	Path    string
+	Env     *Environment
+	Exports []string // Names of the exported bindings, in definition order
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("<module %s>", m.Name)
+}
+
+func (m *Module) Member(name string) (Object, bool) {
+	for _, export := range m.Exports {
+		if export == name {
+			return m.Env.Get(name)
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,230 @@
+// Package optimizer simplifies programs before they run without changing
+// what they do.
+//
+// Operators on integer and boolean literals are folded into literals,
+// unless they would raise an error such as a division by zero, and sums
+// and products ending with literals are regrouped so that the literals
+// fold too: `x * 60 * 60` becomes `x * 3600`. An if expression with a
+// literal condition is reduced to the branch it takes, and statements
+// after a return or a throw are removed.
+//
+// The optimizer keeps the addresses set by the resolver valid, so it can
+// run either before or after it.
+package optimizer
+
+import (
+	"strconv"
+
+	"github.com/ryym/monkey/ast"
+	tk "github.com/ryym/monkey/token"
+)
+
+// Optimize rewrites a program in place and returns it.
+func Optimize(program *ast.Program) *ast.Program {
+	return ast.Modify(program, optimize).(*ast.Program)
+}
+
+// optimize simplifies a node whose children are already simplified.
+func optimize(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = simplifyStatements(node.Statements)
+	case *ast.BlockStatement:
+		node.Statements = simplifyStatements(node.Statements)
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.IfExpression:
+		return pruneIf(node)
+	}
+	return node
+}
+
+func foldPrefix(node *ast.PrefixExpression) ast.Expression {
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		switch node.Operator {
+		case "-":
+			return integer(-right.Value, node.Pos())
+		case "!":
+			return boolean(false, node.Pos())
+		}
+	case *ast.Boolean:
+		if node.Operator == "!" {
+			return boolean(!right.Value, node.Pos())
+		}
+	case *ast.StringLiteral:
+		if node.Operator == "!" {
+			return boolean(false, node.Pos())
+		}
+	}
+	return node
+}
+
+func foldInfix(node *ast.InfixExpression) ast.Expression {
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		if right, ok := node.Right.(*ast.IntegerLiteral); ok {
+			if folded := foldIntegers(node.Operator, left.Value, right.Value, node.Pos()); folded != nil {
+				return folded
+			}
+		}
+	case *ast.Boolean:
+		if right, ok := node.Right.(*ast.Boolean); ok {
+			switch node.Operator {
+			case "==":
+				return boolean(left.Value == right.Value, node.Pos())
+			case "!=":
+				return boolean(left.Value != right.Value, node.Pos())
+			}
+		}
+	case *ast.InfixExpression:
+		// (x + 1) + 2 gives x + 3. Either both are integer sums, or both
+		// fail with the same type mismatch at the inner operator.
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok || (node.Operator != "+" && node.Operator != "*") || left.Operator != node.Operator {
+			break
+		}
+		if inner, ok := left.Right.(*ast.IntegerLiteral); ok {
+			left.Right = foldIntegers(node.Operator, inner.Value, right.Value, inner.Pos())
+			return left
+		}
+	}
+	return node
+}
+
+// foldIntegers returns the literal result of an operator on integers,
+// or nil if the operator cannot be folded.
+func foldIntegers(op string, l, r int64, pos tk.Position) ast.Expression {
+	switch op {
+	case "+":
+		return integer(l+r, pos)
+	case "-":
+		return integer(l-r, pos)
+	case "*":
+		return integer(l*r, pos)
+	case "/":
+		if r == 0 {
+			return nil // Left to raise the error when evaluated
+		}
+		return integer(l/r, pos)
+	case "<":
+		return boolean(l < r, pos)
+	case ">":
+		return boolean(l > r, pos)
+	case "==":
+		return boolean(l == r, pos)
+	case "!=":
+		return boolean(l != r, pos)
+	}
+	return nil
+}
+
+// pruneIf reduces an if expression with a literal condition to
+// `if (true) { ... }` with the block it takes, or to the expression of
+// that block if it has nothing else. Statement lists then splice the
+// block into their own statements.
+func pruneIf(node *ast.IfExpression) ast.Expression {
+	truthy, ok := constantTruth(node.Condition)
+	if !ok {
+		return node
+	}
+
+	block := node.Consequence
+	if !truthy {
+		block = node.Alternative
+		if block == nil {
+			block = &ast.BlockStatement{Token: node.Consequence.Token, Statements: []ast.Statement{}}
+		}
+	}
+	if len(block.Statements) == 1 {
+		if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			return stmt.Expression
+		}
+	}
+
+	node.Condition = boolean(true, node.Condition.Pos())
+	node.Consequence = block
+	node.Alternative = nil
+	return node
+}
+
+// constantTruth tells whether a literal condition is truthy. Only null
+// and false are falsy.
+func constantTruth(exp ast.Expression) (bool, bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// simplifyStatements splices the blocks of pruned if statements into the
+// list and drops the statements after a return or a throw.
+//
+// A block is spliced only if that keeps the value of the list, which is
+// the value of its last statement: either the if is not the last
+// statement, or the block ends with an expression.
+func simplifyStatements(stmts []ast.Statement) []ast.Statement {
+	result := make([]ast.Statement, 0, len(stmts))
+	for i, stmt := range stmts {
+		if block := prunedBlock(stmt); block != nil && (i < len(stmts)-1 || endsWithExpression(block)) {
+			result = append(result, block.Statements...)
+		} else {
+			result = append(result, stmt)
+		}
+
+		if len(result) > 0 && leaves(result[len(result)-1]) {
+			break
+		}
+	}
+	return result
+}
+
+// prunedBlock returns the block of an if statement reduced by pruneIf.
+func prunedBlock(stmt ast.Statement) *ast.BlockStatement {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	ifExp, ok := es.Expression.(*ast.IfExpression)
+	if !ok || ifExp.Alternative != nil {
+		return nil
+	}
+	if cond, ok := ifExp.Condition.(*ast.Boolean); !ok || !cond.Value {
+		return nil
+	}
+	return ifExp.Consequence
+}
+
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+// leaves reports whether a statement always leaves its block.
+func leaves(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	}
+	return false
+}
+
+func integer(value int64, pos tk.Position) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: tk.Token{Type: tk.INT, Literal: literal, Pos: pos}, Value: value}
+}
+
+func boolean(value bool, pos tk.Position) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: tk.Token{Type: tk.TRUE, Literal: "true", Pos: pos}, Value: true}
+	}
+	return &ast.Boolean{Token: tk.Token{Type: tk.FALSE, Literal: "false", Pos: pos}, Value: false}
+}
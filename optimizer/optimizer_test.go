@@ -0,0 +1,148 @@
+package optimizer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/internal/astgen"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/optimizer"
+	"github.com/ryym/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%q: parse errors: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"-(2 - 5)", "3"},
+		{"1 < 2 == true", "true"},
+		{"!(1 == 1) != false", "false"},
+		{"!5; !\"\"", "false;false"},
+		{"x * 60 * 60", "(x * 3600)"},
+		{"x + 1 + 2 + 3", "(x + 6)"},
+		{"x - 1 - 2", "((x - 1) - 2)"},
+		{"1 + 2 + x", "(3 + x)"},
+		{"fn(s) { s * (60 * 60) }", "fn(s) {(s * 3600)}"},
+
+		// Operations that raise errors are left as they are.
+		{"10 / (5 - 5)", "(10 / 0)"},
+		{"1 + true", "(1 + true)"},
+		{"-true; \"a\" < \"b\"", "(-true);(\"a\" < \"b\")"},
+
+		// Ifs with literal conditions
+		{"if (1 > 2) { a } else { b }", "b"},
+		{"if (true) { a }", "a"},
+		{"if (\"s\") { a } else { b }", "a"},
+		{"if (false) { a }", "if (true) {}"},
+		{"if (x) { 1 + 1 } else { 2 }", "if (x) {2} else {2}"},
+		{"let y = if (true) { let z = 1; z } else { 0 }; y", "let y = if (true) {let z = 1;z};y"},
+		{"if (true) { let z = 1; puts(z) }; z", "let z = 1;puts(z);z"},
+		{"if (false) { a }; b", "b"},
+		{"if (true) { let z = 1 }", "if (true) {let z = 1;}"},
+		{"fn() { if (true) { return 1 }; 2 }", "fn() {return 1;}"},
+
+		// Unreachable statements
+		{"fn() { let a = 1; return a; puts(a); a }", "fn() {let a = 1;return a;}"},
+		{"fn() { throw \"x\"; 1 }", "fn() {throw \"x\";}"},
+		{"return 1; 2", "return 1;"},
+		{"fn() { if (x) { return 1; 2 } else { 3 } }", "fn() {if (x) {return 1;} else {3}}"},
+	}
+
+	for _, tt := range tests {
+		program := optimizer.Optimize(parse(t, tt.input))
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong result.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestOptimizeKeepsPositions(t *testing.T) {
+	program := optimizer.Optimize(parse(t, "let a = 1;\n  1 + 2"))
+	pos := program.Statements[1].(*ast.ExpressionStatement).Expression.Pos()
+	if pos.Line != 2 || pos.Column != 5 {
+		t.Errorf("wrong position. got=%s", pos)
+	}
+}
+
+// run evaluates a program and describes its result and output. Functions
+// are described by their type only since they print their optimized body.
+func run(program *ast.Program) string {
+	var out bytes.Buffer
+	orig := evaluator.Stdout
+	evaluator.Stdout = &out
+	defer func() { evaluator.Stdout = orig }()
+
+	result := evaluator.Eval(program, object.NewEnvironment())
+	switch result.(type) {
+	case nil:
+		return "<nil>\n" + out.String()
+	case *object.Function:
+		return "FUNCTION\n" + out.String()
+	}
+	return string(result.Type()) + " " + result.Inspect() + "\n" + out.String()
+}
+
+func TestOptimizeKeepsResults(t *testing.T) {
+	inputs := []string{
+		`let day = fn(n) { n * (60 * 60 * 24) }; day(2)`,
+		`let f = fn(x) { if (1 < 2) { puts("a"); x + 1 } else { puts("b"); x } }; f(1)`,
+		`let f = fn(x) { if (false) { return 0 }; return x * 2; puts("never") }; f(4)`,
+		`let f = fn() { if (true) { let v = 5 }; v }; f()`,
+		`if (true) { let v = 1 }`,
+		`let v = 1; if (true) { }`,
+		`let v = 1; if (false) { 2 }`,
+		`if (true) { puts(1); 2 }; 3`,
+		`10 / (1 - 1)`,
+		`let x = "s"; x + 1 + 2`,
+		`let x = true; x * 2 * 3`,
+		`let f = fn() { throw "boom"; 1 }; try { f() } catch (e) { e.message }`,
+		`let h = {1 + 1: !true}; h[2]`,
+		`if (!true) { 1 } else { if (0) { 2 } }`,
+	}
+
+	for _, input := range inputs {
+		want := run(parse(t, input))
+		got := run(optimizer.Optimize(parse(t, input)))
+		if got != want {
+			t.Errorf("%q: optimized program gave a different result.\nwant=%q\ngot= %q", input, want, got)
+		}
+	}
+}
+
+func TestOptimizeKeepsResultsOfGeneratedPrograms(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		want := run(astgen.New(seed).Program())
+		program := astgen.New(seed).Program()
+		if got := run(optimizer.Optimize(program)); got != want {
+			t.Fatalf("seed %d: optimized program gave a different result.\nwant=%q\ngot= %q\n%s",
+				seed, want, got, program)
+		}
+	}
+}
+
+func TestOptimizeResolvedPrograms(t *testing.T) {
+	input := `let f = fn(a) { let b = a * (2 * 3); if (true) { let c = b + 1 }; c }; f(2)`
+	program := parse(t, input)
+	if diags := evaluator.Resolve(program, nil); len(diags) > 0 {
+		t.Fatalf("resolve errors: %v", diags)
+	}
+	if got, want := run(optimizer.Optimize(program)), run(parse(t, input)); got != want {
+		t.Errorf("wrong result.\nwant=%q\ngot= %q", want, got)
+	}
+}
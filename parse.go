@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+)
+
+// parseFile prints the syntax tree of a file, or of the standard input.
+// By default the tree is printed as the fully parenthesized source.
+// Only one of the output formats may be chosen.
+func (c *cli) parseFile(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		io.WriteString(c.stderr, "usage: monkey parse [-json|-dot|-sexp] [file]\n")
+		flags.PrintDefaults()
+	}
+	asJSON := flags.Bool("json", false, "print the tree in the JSON schema of the AST")
+	asDOT := flags.Bool("dot", false, "print the tree as a Graphviz graph")
+	asSexp := flags.Bool("sexp", false, "print the tree as an S-expression")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	formats := 0
+	for _, f := range []bool{*asJSON, *asDOT, *asSexp} {
+		if f {
+			formats++
+		}
+	}
+	if flags.NArg() > 1 || formats > 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	name, src, err := c.readSource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey parse: %s\n", err)
+		return exitError
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		fmt.Fprintf(c.stderr, "%s: parse error\n", name)
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(c.stderr, "\t%s\n", msg)
+		}
+		return exitError
+	}
+
+	switch {
+	case *asDOT:
+		io.WriteString(c.stdout, ast.DOT(program))
+		return exitOK
+	case *asSexp:
+		io.WriteString(c.stdout, ast.Sexp(program))
+		return exitOK
+	case !*asJSON:
+		fmt.Fprintln(c.stdout, program.String())
+		return exitOK
+	}
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey parse: %s\n", err)
+		return exitError
+	}
+	var out bytes.Buffer
+	json.Indent(&out, data, "", "  ")
+	out.WriteString("\n")
+	c.stdout.Write(out.Bytes())
+	return exitOK
+}
+
+// readSource reads the file at path, or the standard input if path is empty.
+func (c *cli) readSource(path string) (string, []byte, error) {
+	if path == "" {
+		src, err := ioutil.ReadAll(c.stdin)
+		return "<standard input>", src, err
+	}
+	src, err := ioutil.ReadFile(path)
+	return path, src, err
+}
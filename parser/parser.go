@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/ryym/monkey/ast"
 	lx "github.com/ryym/monkey/lexer"
@@ -18,6 +19,7 @@ const (
 	PRODUCT
 	PREFIX
 	CALL
+	INDEX
 )
 
 var precedences = map[tk.TokenType]int{
@@ -30,6 +32,17 @@ var precedences = map[tk.TokenType]int{
 	tk.SLASH:    PRODUCT,
 	tk.ASTERISK: PRODUCT,
 	tk.LPAREN:   CALL,
+	tk.DOT:      CALL,
+	tk.LBRACKET: INDEX,
+}
+
+// Precedence returns the precedence of a token as an infix operator,
+// or LOWEST if it is not one.
+func Precedence(t tk.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
 }
 
 type prefixParseFn func() ast.Expression
@@ -40,6 +53,7 @@ type Parser struct {
 	curToken  tk.Token
 	peekToken tk.Token
 	errors    []string
+	errorPos  []tk.Position // Where each error was found
 
 	prefixParseFns map[tk.TokenType]prefixParseFn
 	infixParseFns  map[tk.TokenType]infixParseFn
@@ -58,6 +72,10 @@ func New(l *lx.Lexer) *Parser {
 	p.registerPrefix(tk.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(tk.IF, p.parseIfExpression)
 	p.registerPrefix(tk.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(tk.STRING, p.parseStringLiteral)
+	p.registerPrefix(tk.TRY, p.parseTryExpression)
+	p.registerPrefix(tk.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(tk.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[tk.TokenType]infixParseFn)
 	for _, token := range []tk.TokenType{
@@ -73,6 +91,8 @@ func New(l *lx.Lexer) *Parser {
 		p.registerInfix(token, p.parseInfixExpression)
 	}
 	p.registerInfix(tk.LPAREN, p.parseCallExpression)
+	p.registerInfix(tk.DOT, p.parseMemberExpression)
+	p.registerInfix(tk.LBRACKET, p.parseIndexExpression)
 
 	// Set curToken and peekToken
 	p.nextToken()
@@ -91,6 +111,31 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Error is a parse error with the position of the token where it was found.
+type Error struct {
+	Pos     tk.Position
+	Message string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// ErrorList returns the errors along with their positions, for tools
+// that point at them.
+func (p *Parser) ErrorList() []Error {
+	errs := make([]Error, len(p.errors))
+	for i, msg := range p.errors {
+		errs[i] = Error{Pos: p.errorPos[i], Message: msg}
+	}
+	return errs
+}
+
+func (p *Parser) addError(pos tk.Position, msg string) {
+	p.errors = append(p.errors, msg)
+	p.errorPos = append(p.errorPos, pos)
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
@@ -119,7 +164,7 @@ func (p *Parser) peekError(t tk.TokenType) {
 		t,
 		p.peekToken.Type,
 	)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, msg)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -156,6 +201,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case tk.RETURN:
 		return p.parseReturnStatement()
+	case tk.THROW:
+		return p.parseThrowStatement()
+	case tk.IMPORT:
+		return p.parseImportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -180,6 +229,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// Remember the binding name so that stack traces can refer to the function.
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(tk.SEMICOLON) {
 		p.nextToken()
 	}
@@ -200,6 +254,69 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(tk.STRING) {
+		return nil
+	}
+	path, ok := p.parseStringLiteral().(*ast.StringLiteral)
+	if !ok {
+		return nil
+	}
+	stmt.Path = path
+
+	name := moduleName(stmt.Path.Value)
+	if !isIdentifier(name) {
+		msg := fmt.Sprintf("cannot import %q: module name %q is not an identifier", stmt.Path.Value, name)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: tk.Token{Type: tk.IDENT, Literal: name, Pos: p.curToken.Pos}, Value: name}
+
+	if p.peekTokenIs(tk.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// moduleName returns the base name of a module path without its extension.
+func moduleName(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.Index(path, "."); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || tk.LookupIdent(name) != tk.IDENT {
+		return false
+	}
+	for _, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -239,7 +356,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 func (p *Parser) noPrefixParseFnError(t tk.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, msg)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -265,13 +382,56 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos, msg)
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	value, err := unescape(p.curToken.Literal)
+	if err != nil {
+		p.addError(p.curToken.Pos, err.Error())
+		return nil
+	}
+	return &ast.StringLiteral{Token: p.curToken, Value: value}
+}
+
+var escapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+}
+
+func unescape(literal string) (string, error) {
+	if !strings.Contains(literal, "\\") {
+		return literal, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(literal); i++ {
+		ch := literal[i]
+		if ch != '\\' {
+			out.WriteByte(ch)
+			continue
+		}
+
+		i++
+		if i == len(literal) {
+			return "", fmt.Errorf("unterminated escape sequence in %q", literal)
+		}
+		escaped, ok := escapes[literal[i]]
+		if !ok {
+			return "", fmt.Errorf("unknown escape sequence \\%c in %q", literal[i], literal)
+		}
+		out.WriteByte(escaped)
+	}
+	return out.String(), nil
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{
 		Token: p.curToken,
@@ -395,30 +555,137 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	call := &ast.CallExpression{Token: p.curToken, Function: function}
-	call.Arguments = p.parseCallArguments()
+	call.Arguments = p.parseExpressionList(tk.RPAREN)
 	return call
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+func (p *Parser) parseExpressionList(end tk.TokenType) []ast.Expression {
+	list := []ast.Expression{}
 
-	if p.peekTokenIs(tk.RPAREN) {
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return list
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(tk.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(tk.RPAREN) {
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(tk.RBRACKET)
+	return array
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tk.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []*ast.HashPair{}
+
+	for !p.peekTokenIs(tk.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(tk.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(tk.RBRACE) && !p.expectPeek(tk.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(tk.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(tk.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(tk.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(tk.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(tk.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(tk.IDENT) {
+			return nil
+		}
+		expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(tk.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(tk.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(tk.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(tk.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		msg := fmt.Sprintf("expected catch or finally after try block, got %s instead", p.peekToken.Type)
+		p.addError(p.peekToken.Pos, msg)
 		return nil
 	}
 
-	return args
+	return expression
 }
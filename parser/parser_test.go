@@ -2,9 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/internal/astgen"
 	"github.com/ryym/monkey/lexer"
 )
 
@@ -421,7 +423,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4);((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -475,6 +477,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a.b.c + d",
+			"(((a.b).c) + d)",
+		},
+		{
+			"-e.kind",
+			"(-(e.kind))",
+		},
+		{
+			"f(x).message",
+			"(f(x).message)",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -707,3 +729,369 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, call.Arguments[1], 2, "*", 3)
 	testInfixExpression(t, call.Arguments[2], 4, "+", 5)
 }
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	checkStatementLen(t, program, 1)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q", function.Name)
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	checkStatementLen(t, program, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\"b"`, `a"b`},
+		{`"a\\b"`, `a\b`},
+		{`"tab\tnewline\n"`, "tab\tnewline\n"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal := stmt.Expression.(*ast.StringLiteral)
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %q. got=%q", tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() should keep escapes. got=%q", literal.String())
+		}
+	}
+}
+
+func TestInvalidStringEscape(t *testing.T) {
+	p := New(lexer.New(`"a\qb"`))
+	p.ParseProgram()
+
+	expected := `unknown escape sequence \q in "a\\qb"`
+	if len(p.Errors()) != 1 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors. want=%q, got=%q", expected, p.Errors())
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	input := `throw x;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	checkStatementLen(t, program, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+
+	testIdentifier(t, stmt.Value, "x")
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input      string
+		hasCatch   bool
+		hasFinally bool
+	}{
+		{`try { x } catch (e) { y }`, true, false},
+		{`try { x } finally { z }`, false, true},
+		{`try { x } catch (e) { y } finally { z }`, true, true},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		checkStatementLen(t, program, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if len(exp.Block.Statements) != 1 {
+			t.Errorf("try block is not 1 statements. got=%d", len(exp.Block.Statements))
+		}
+
+		if (exp.Catch != nil) != tt.hasCatch {
+			t.Errorf("catch block presence wrong. want=%t, got=%+v", tt.hasCatch, exp.Catch)
+		}
+		if tt.hasCatch && !testIdentifier(t, exp.Param, "e") {
+			return
+		}
+
+		if (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("finally block presence wrong. want=%t, got=%+v", tt.hasFinally, exp.Finally)
+		}
+	}
+}
+
+func TestTryExpressionWithoutHandler(t *testing.T) {
+	p := New(lexer.New(`try { x }`))
+	p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. got=%v", p.Errors())
+	}
+
+	expected := "expected catch or finally after try block, got EOF instead"
+	if p.Errors()[0] != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, p.Errors()[0])
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+		if literal.Value != expected[i].key {
+			t.Errorf("key is not in source order. want=%q, got=%q", expected[i].key, literal.Value)
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedPath string
+		expectedName string
+	}{
+		{`import "mod";`, "mod", "mod"},
+		{`import "path/to/mod"`, "path/to/mod", "mod"},
+		{`import "../lib/str_utils.mk";`, "../lib/str_utils.mk", "str_utils"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		checkStatementLen(t, program, 1)
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Path.Value != tt.expectedPath {
+			t.Errorf("stmt.Path.Value not %q. got=%q", tt.expectedPath, stmt.Path.Value)
+		}
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name.Value not %q. got=%q", tt.expectedName, stmt.Name.Value)
+		}
+	}
+}
+
+func TestImportStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import mod;`, "expected next token to be STRING, got IDENT instead"},
+		{`import "lib/my-mod";`, `cannot import "lib/my-mod": module name "my-mod" is not an identifier`},
+		{`import "lib/if";`, `cannot import "lib/if": module name "if" is not an identifier`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%s: wrong errors. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let = 1;", []string{
+			"1:5: expected next token to be IDENT, got = instead",
+			"1:5: no prefix parse function for = found",
+		}},
+		{"let x = 1;\nx + )", []string{"2:5: no prefix parse function for ) found"}},
+		{`import "a-b"`, []string{`1:8: cannot import "a-b": module name "a-b" is not an identifier`}},
+		{`"\q"`, []string{`1:1: unknown escape sequence \q in "\\q"`}},
+		{"try { x }\n", []string{"2:1: expected catch or finally after try block, got EOF instead"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		got := []string{}
+		for _, err := range p.ErrorList() {
+			got = append(got, err.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong errors.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// FuzzParseProgram checks that the parser does not panic, and that
+// the String of a parsed program parses back to the same tree.
+func FuzzParseProgram(f *testing.F) {
+	for _, src := range []string{
+		"let x = 5; return -x;",
+		"3 + 4; -5 * 5",
+		`import "lib/mod"; mod.f(1, "two\n", true)`,
+		"let add = fn(a, b) { return a + b; }; add(1, 2 * 3)",
+		"if (a < b) { a } else { b }; if (x) { y }",
+		`let h = {"k": [1, !false], 2: {}}; h["k"][0]`,
+		`try { throw "x" } catch (e) { e.message } finally { 0 }`,
+		"fn(x) { x }(1)",
+	} {
+		f.Add(src)
+	}
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(astgen.New(seed).Program().String())
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		p := New(lexer.New(src))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			return
+		}
+
+		printed := program.String()
+		p = New(lexer.New(printed))
+		reparsed := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("printed program does not parse: %q\nsource=%q\nprinted=%q", p.Errors(), src, printed)
+		}
+		if !ast.Equal(reparsed, program) {
+			t.Fatalf("printed program parses to another tree.\nsource=%q\nprinted=%q\nreparsed=%q", src, printed, reparsed.String())
+		}
+	})
+}
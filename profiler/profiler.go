@@ -0,0 +1,283 @@
+// Package profiler measures where Monkey programs spend their time.
+//
+// A Profiler is a hook of the evaluator. It charges the time between
+// statements to the line of the statement and to the functions being
+// called, and counts the statements run on each line and the calls of
+// each function.
+//
+//	prof := profiler.New()
+//	in.SetHook(prof)
+//	_, err := in.EvalFile("main.mk")
+//	prof.Stop()
+//	prof.WriteReport(os.Stderr, 10)
+//
+// WriteProto writes the profile in the format of `go tool pprof`.
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/object"
+)
+
+type Profiler struct {
+	now func() time.Time // Replaced by tests
+
+	start   time.Time // When the first statement started
+	last    time.Time // When the time was last charged
+	total   time.Duration
+	stopped bool
+
+	// The calls being executed, innermost last.
+	stack []frame
+
+	funcs   map[function]*stats
+	lines   map[line]*stats
+	samples map[string]*sample // By the key of their stack
+	order   []string           // Keys of samples in the order they were seen
+}
+
+// function identifies a function by its name and file. The functions
+// of a file sharing a name, like anonymous ones, are merged.
+type function struct {
+	name string
+	file string
+}
+
+type line struct {
+	file string
+	line int
+}
+
+// frame is a call being executed.
+type frame struct {
+	fn    function
+	start int // The line where the function starts
+	line  int // The line being executed
+}
+
+// stats are the measures of a function or a line. Self time is spent in
+// the function or on the line itself, and total time includes the calls
+// made from there.
+type stats struct {
+	self, total time.Duration
+	count       int64 // Calls of a function, or statements run on a line
+	start       int   // The line where a function starts
+}
+
+// sample is the measures of one stack of calls.
+type sample struct {
+	stack      []frame // Innermost first
+	time       time.Duration
+	statements int64
+	calls      int64
+}
+
+func New() *Profiler {
+	return &Profiler{
+		now:     time.Now,
+		funcs:   make(map[function]*stats),
+		lines:   make(map[line]*stats),
+		samples: make(map[string]*sample),
+	}
+}
+
+func (p *Profiler) Before(node ast.Node, env *object.Environment) {
+	if p.stopped {
+		return
+	}
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		return
+	}
+	if _, ok := stmt.(*ast.BlockStatement); ok {
+		return
+	}
+	p.tick()
+
+	fn := function{name: env.Function, file: env.File}
+	if len(p.stack) == 0 {
+		p.stack = []frame{{fn: fn, start: 1}}
+		p.funcStats(p.stack[0]).count++
+	}
+	top := &p.stack[len(p.stack)-1]
+	if top.fn != fn {
+		// The top level of an imported module runs in the frame that
+		// imports it. It runs once, since modules are loaded once.
+		top.fn, top.start = fn, 1
+		if s := p.funcStats(*top); s.count == 0 {
+			s.count = 1
+		}
+	}
+	top.line = node.Pos().Line
+
+	p.lineStats(line{file: fn.file, line: top.line}).count++
+	p.sample().statements++
+}
+
+func (p *Profiler) Call(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	if p.stopped || len(p.stack) == 0 {
+		return
+	}
+	p.tick()
+	start := fn.Body.Pos().Line
+	f := frame{fn: function{name: env.Function, file: env.File}, start: start, line: start}
+	p.stack = append(p.stack, f)
+
+	p.funcStats(f).count++
+	p.sample().calls++
+}
+
+func (p *Profiler) Return(call *ast.CallExpression, fn *object.Function, result object.Object) {
+	if p.stopped || len(p.stack) <= 1 {
+		return
+	}
+	p.tick()
+	p.stack = p.stack[:len(p.stack)-1]
+}
+
+// Stop ends the profile, charging the time since the last statement.
+// Nothing is measured after it.
+func (p *Profiler) Stop() {
+	if !p.stopped {
+		p.tick()
+		p.stopped = true
+	}
+}
+
+// tick charges the time since it was last called to the current stack.
+func (p *Profiler) tick() {
+	now := p.now()
+	if p.start.IsZero() {
+		p.start, p.last = now, now
+		return
+	}
+	elapsed := now.Sub(p.last)
+	p.last = now
+	if len(p.stack) == 0 {
+		return
+	}
+	p.total += elapsed
+	p.sample().time += elapsed
+
+	top := p.stack[len(p.stack)-1]
+	p.funcStats(top).self += elapsed
+	p.lineStats(line{file: top.fn.file, line: top.line}).self += elapsed
+
+	// Recursive calls are charged once.
+	seenFuncs := make(map[function]bool)
+	seenLines := make(map[line]bool)
+	for _, f := range p.stack {
+		if !seenFuncs[f.fn] {
+			seenFuncs[f.fn] = true
+			p.funcStats(f).total += elapsed
+		}
+		l := line{file: f.fn.file, line: f.line}
+		if !seenLines[l] {
+			seenLines[l] = true
+			p.lineStats(l).total += elapsed
+		}
+	}
+}
+
+func (p *Profiler) funcStats(f frame) *stats {
+	s, ok := p.funcs[f.fn]
+	if !ok {
+		s = &stats{start: f.start}
+		p.funcs[f.fn] = s
+	}
+	return s
+}
+
+func (p *Profiler) lineStats(l line) *stats {
+	s, ok := p.lines[l]
+	if !ok {
+		s = &stats{}
+		p.lines[l] = s
+	}
+	return s
+}
+
+// sample returns the sample of the current stack.
+func (p *Profiler) sample() *sample {
+	var key strings.Builder
+	for _, f := range p.stack {
+		fmt.Fprintf(&key, "%s\x00%s\x00%d\x00%d\x00", f.fn.name, f.fn.file, f.start, f.line)
+	}
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &sample{stack: make([]frame, len(p.stack))}
+		for i, f := range p.stack {
+			s.stack[len(p.stack)-1-i] = f
+		}
+		p.samples[key.String()] = s
+		p.order = append(p.order, key.String())
+	}
+	return s
+}
+
+// WriteReport writes the n functions and the n lines where the most
+// time was spent by themselves.
+func (p *Profiler) WriteReport(w io.Writer, n int) error {
+	var b strings.Builder
+	var statements, calls int64
+	for _, s := range p.samples {
+		statements += s.statements
+		calls += s.calls
+	}
+	fmt.Fprintf(&b, "Total: %s, %d statements, %d calls\n", ms(p.total), statements, calls)
+
+	type row struct {
+		name string
+		*stats
+	}
+	write := func(title, count string, rows []row) {
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].self != rows[j].self {
+				return rows[i].self > rows[j].self
+			}
+			if rows[i].total != rows[j].total {
+				return rows[i].total > rows[j].total
+			}
+			return rows[i].name < rows[j].name
+		})
+		if len(rows) > n {
+			rows = rows[:n]
+		}
+		fmt.Fprintf(&b, "\n%s\n%10s %7s %10s %7s %8s\n", title, "self", "self%", "total", "total%", count)
+		for _, r := range rows {
+			fmt.Fprintf(&b, "%10s %7s %10s %7s %8d  %s\n",
+				ms(r.self), p.percent(r.self), ms(r.total), p.percent(r.total), r.count, r.name)
+		}
+	}
+
+	funcs := []row{}
+	for fn, s := range p.funcs {
+		funcs = append(funcs, row{fmt.Sprintf("%s (%s:%d)", fn.name, fn.file, s.start), s})
+	}
+	write("Functions", "calls", funcs)
+	lines := []row{}
+	for l, s := range p.lines {
+		lines = append(lines, row{fmt.Sprintf("%s:%d", l.file, l.line), s})
+	}
+	write("Lines", "count", lines)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+func (p *Profiler) percent(d time.Duration) string {
+	if p.total == 0 {
+		return "0.00%"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(d)/float64(p.total))
+}
@@ -0,0 +1,195 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/monkey/internal/scripttest"
+	"github.com/ryym/monkey/interp"
+)
+
+// profile runs a script under a profiler whose clock advances by a
+// millisecond each time it is read.
+func profile(t *testing.T, src string) *Profiler {
+	t.Helper()
+	dir, _ := scripttest.WriteFiles(t, map[string]string{"main.mk": src})
+	// Run it from its directory so that the report names it main.mk.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	p := New()
+	clock := time.Unix(0, 0)
+	p.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	in := interp.New()
+	in.SetHook(p)
+	if _, err := in.EvalFile("main.mk"); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	return p
+}
+
+const double = `let double = fn(x) {
+  x * 2
+};
+let a = double(1);
+let b = double(a);
+`
+
+func TestReport(t *testing.T) {
+	p := profile(t, double)
+	var out bytes.Buffer
+	if err := p.WriteReport(&out, 3); err != nil {
+		t.Fatal(err)
+	}
+	// The time from a call to the first statement of the function is
+	// charged to the line where the function starts.
+	expected := `Total: 9.00ms, 5 statements, 2 calls
+
+Functions
+      self   self%      total  total%    calls
+    5.00ms  55.56%     9.00ms 100.00%        1  <main> (main.mk:1)
+    4.00ms  44.44%     4.00ms  44.44%        2  double (main.mk:1)
+
+Lines
+      self   self%      total  total%    count
+    3.00ms  33.33%     3.00ms  33.33%        1  main.mk:1
+    2.00ms  22.22%     4.00ms  44.44%        1  main.mk:4
+    2.00ms  22.22%     4.00ms  44.44%        1  main.mk:5
+`
+	if got := out.String(); got != expected {
+		t.Errorf("wrong report.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRecursion(t *testing.T) {
+	p := profile(t, `let count = fn(n) { if (n > 0) { count(n - 1) } };
+count(3);
+`)
+	// Recursive calls are charged to the total time of the function once.
+	s := p.funcs[function{name: "count", file: "main.mk"}]
+	if s.count != 4 || s.total > p.total || s.self > s.total {
+		t.Errorf("wrong stats of count: %+v, total time %s", *s, p.total)
+	}
+}
+
+// varint decodes a varint at the start of data, and removes it.
+func varint(t *testing.T, data *[]byte) uint64 {
+	t.Helper()
+	var x uint64
+	for shift := 0; ; shift += 7 {
+		if len(*data) == 0 {
+			t.Fatal("truncated varint")
+		}
+		b := (*data)[0]
+		*data = (*data)[1:]
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return x
+		}
+	}
+}
+
+func packed(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	xs := []uint64{}
+	for len(data) > 0 {
+		xs = append(xs, varint(t, &data))
+	}
+	return xs
+}
+
+// fields decodes the fields of a protocol buffer message, by number.
+// Varints are decoded to their value and the others to their bytes.
+func fields(t *testing.T, data []byte) map[int][]interface{} {
+	t.Helper()
+	result := map[int][]interface{}{}
+	for len(data) > 0 {
+		key := varint(t, &data)
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			result[field] = append(result[field], varint(t, &data))
+		case 2:
+			n := varint(t, &data)
+			result[field] = append(result[field], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return result
+}
+
+func TestProto(t *testing.T) {
+	p := profile(t, double)
+	var out bytes.Buffer
+	if err := p.WriteProto(&out); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := fields(t, data)
+	table := []string{}
+	for _, s := range msg[6] {
+		table = append(table, string(s.([]byte)))
+	}
+	if table[0] != "" {
+		t.Errorf("string table does not start with an empty string: %q", table)
+	}
+	str := func(v interface{}) string { return table[v.(uint64)] }
+
+	types := []string{}
+	for _, vt := range msg[1] {
+		f := fields(t, vt.([]byte))
+		types = append(types, str(f[1][0])+"/"+str(f[2][0]))
+	}
+	if got := strings.Join(types, " "); got != "statements/count calls/count time/nanoseconds" {
+		t.Errorf("wrong sample types: %s", got)
+	}
+	if got := str(msg[14][0]); got != "time" {
+		t.Errorf("wrong default sample type: %s", got)
+	}
+
+	names := []string{}
+	for _, fn := range msg[5] {
+		f := fields(t, fn.([]byte))
+		names = append(names, str(f[2][0])+"="+str(f[3][0])+"@"+str(f[4][0]))
+	}
+	if got := strings.Join(names, " "); got != "main=<main>@main.mk double=double@main.mk" {
+		t.Errorf("wrong functions: %s", got)
+	}
+
+	// The samples add up to the totals of the report.
+	var statements, calls, total uint64
+	for _, s := range msg[2] {
+		values := packed(t, fields(t, s.([]byte))[2][0].([]byte))
+		statements += values[0]
+		calls += values[1]
+		total += values[2]
+	}
+	if statements != 5 || calls != 2 || time.Duration(total) != p.total {
+		t.Errorf("wrong sums of samples: %d statements, %d calls, %d ns", statements, calls, total)
+	}
+}
@@ -0,0 +1,185 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// WriteProto writes the profile as a gzipped profile.proto, the format
+// that `go tool pprof` reads. Each stack of calls is a sample with the
+// statements run, the calls made and the time spent there.
+func (p *Profiler) WriteProto(w io.Writer) error {
+	var b protoBuffer
+	index := map[string]int{}
+	str := func(s string) uint64 {
+		i, ok := index[s]
+		if !ok {
+			i = len(index)
+			index[s] = i
+		}
+		return uint64(i)
+	}
+	str("")
+
+	valueType := func(field int, typ, unit string) {
+		b.message(field, func(b *protoBuffer) {
+			b.uint64(1, str(typ))
+			b.uint64(2, str(unit))
+		})
+	}
+	valueType(1, "statements", "count")
+	valueType(1, "calls", "count")
+	valueType(1, "time", "nanoseconds")
+
+	// Locations are the lines of functions, and functions are told
+	// apart by their start lines too.
+	type fnKey struct {
+		function
+		start int
+	}
+	type locKey struct {
+		fn   fnKey
+		line int
+	}
+	fnIDs := map[fnKey]uint64{}
+	var fnOrder []fnKey
+	locIDs := map[locKey]uint64{}
+	var locOrder []locKey
+
+	for _, key := range p.order {
+		s := p.samples[key]
+		ids := make([]uint64, len(s.stack))
+		for i, f := range s.stack {
+			fn := fnKey{f.fn, f.start}
+			if _, ok := fnIDs[fn]; !ok {
+				fnIDs[fn] = uint64(len(fnIDs) + 1)
+				fnOrder = append(fnOrder, fn)
+			}
+			loc := locKey{fn, f.line}
+			if _, ok := locIDs[loc]; !ok {
+				locIDs[loc] = uint64(len(locIDs) + 1)
+				locOrder = append(locOrder, loc)
+			}
+			ids[i] = locIDs[loc]
+		}
+		b.message(2, func(b *protoBuffer) {
+			b.packed(1, ids)
+			b.packed(2, []uint64{uint64(s.statements), uint64(s.calls), uint64(s.time)})
+		})
+	}
+
+	// One mapping tells pprof that the locations are symbolized already.
+	b.message(3, func(b *protoBuffer) {
+		b.uint64(1, 1)
+		b.bool(7, true)
+		b.bool(8, true)
+		b.bool(9, true)
+	})
+	for _, loc := range locOrder {
+		b.message(4, func(b *protoBuffer) {
+			b.uint64(1, locIDs[loc])
+			b.uint64(2, 1)
+			b.message(4, func(b *protoBuffer) {
+				b.uint64(1, fnIDs[loc.fn])
+				b.uint64(2, uint64(loc.line))
+			})
+		})
+	}
+	for _, fn := range fnOrder {
+		b.message(5, func(b *protoBuffer) {
+			b.uint64(1, fnIDs[fn])
+			// pprof drops what is in angle brackets from names, as it
+			// does with C++ templates, which would leave <main> empty.
+			b.uint64(2, str(strings.Trim(fn.name, "<>")))
+			b.uint64(3, str(fn.name))
+			b.uint64(4, str(fn.file))
+			b.uint64(5, uint64(fn.start))
+		})
+	}
+
+	// The string table goes last, once every string is known.
+	var rest protoBuffer
+	if !p.start.IsZero() {
+		rest.uint64(9, uint64(p.start.UnixNano()))
+	}
+	rest.uint64(10, uint64(p.last.Sub(p.start)))
+	rest.message(11, func(b *protoBuffer) {
+		b.uint64(1, str("time"))
+		b.uint64(2, str("nanoseconds"))
+	})
+	rest.uint64(12, 1)
+	rest.uint64(14, str("time"))
+
+	table := make([]string, len(index))
+	for s, i := range index {
+		table[i] = s
+	}
+	for _, s := range table {
+		b.string(6, s)
+	}
+	b.data = append(b.data, rest.data...)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuffer encodes the fields of a protocol buffer message.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64 writes a varint field, omitted if it is zero as proto3 does.
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x != 0 {
+		b.key(field, 0)
+		b.varint(x)
+	}
+}
+
+func (b *protoBuffer) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// string writes a string field. Unlike the others, empty strings are
+// written, since the string table starts with one.
+func (b *protoBuffer) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	var p protoBuffer
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p.data)
+}
+
+func (b *protoBuffer) message(field int, write func(b *protoBuffer)) {
+	var m protoBuffer
+	write(&m)
+	b.bytes(field, m.data)
+}
@@ -0,0 +1,111 @@
+package repl
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/lexer"
+	tk "github.com/ryym/monkey/token"
+)
+
+// ANSI escape sequences for colours.
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// useColor reports whether the output should be colourised: it must be
+// a terminal, and the user must not have opted out with NO_COLOR.
+func useColor(out io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	return ok && isTerminal(f.Fd())
+}
+
+func paint(color, text string) string {
+	return color + text + colorReset
+}
+
+// tokenColor returns the colour of a token class, or an empty string
+// for tokens shown as they are.
+func tokenColor(tok tk.Token) string {
+	switch tok.Type {
+	case tk.LET, tk.FUNCTION, tk.IF, tk.ELSE, tk.RETURN,
+		tk.TRY, tk.CATCH, tk.FINALLY, tk.THROW, tk.IMPORT:
+		return colorMagenta
+	case tk.INT, tk.TRUE, tk.FALSE:
+		return colorYellow
+	case tk.STRING:
+		return colorGreen
+	case tk.ILLEGAL:
+		return colorRed
+	case tk.IDENT:
+		if isBuiltin(tok.Literal) {
+			return colorCyan
+		}
+	}
+	return ""
+}
+
+func isBuiltin(name string) bool {
+	for _, b := range evaluator.BuiltinNames() {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight colourises a line of source code by token class. The text
+// between tokens, such as spaces, is kept as it is.
+func highlight(line string) string {
+	l := lexer.New(line)
+
+	var out strings.Builder
+	prev := 0
+	for {
+		tok := l.NextToken()
+		start := tok.Pos.Column - 1
+		if start > len(line) {
+			start = len(line)
+		}
+		out.WriteString(line[prev:start])
+		if tok.Type == tk.EOF {
+			break
+		}
+
+		end := tokenEnd(line, start, tok)
+		if color := tokenColor(tok); color != "" {
+			out.WriteString(paint(color, line[start:end]))
+		} else {
+			out.WriteString(line[start:end])
+		}
+		prev = end
+	}
+	return out.String()
+}
+
+// tokenEnd returns where the token ends in the line. Only strings are
+// written differently from their literals, with the quotes around.
+func tokenEnd(line string, start int, tok tk.Token) int {
+	end := start + len(tok.Literal)
+	if tok.Type == tk.STRING {
+		end++ // the opening quote
+		if end < len(line) {
+			end++ // the closing quote, unless the string is unterminated
+		}
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	return end
+}
@@ -0,0 +1,163 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+	tk "github.com/ryym/monkey/token"
+)
+
+// command is a REPL command starting with a colon, like `:env`.
+type command struct {
+	args string // Description of the argument, if any
+	help string
+	run  func(s *session, arg string)
+}
+
+var commands map[string]command
+
+// Assigned in init since :help refers to the commands.
+func init() {
+	commands = map[string]command{
+		"tokens": {"<src>", "show the tokens of the source", (*session).showTokens},
+		"ast":    {"[-dot|-sexp] <src>", "show the syntax tree of the source", (*session).showAST},
+		"env":    {"", "show the current bindings", (*session).showEnv},
+		"load":   {"<file>", "evaluate a file in the session", (*session).load},
+		"reset":  {"", "discard all the bindings", (*session).reset},
+		"time":   {"<expr>", "evaluate and show how long it took", (*session).timeEval},
+		"type":   {"<expr>", "evaluate and show the type of the result", (*session).showType},
+		"help":   {"", "show this help", (*session).showHelp},
+	}
+}
+
+var commandOrder = []string{"tokens", "ast", "env", "load", "reset", "time", "type", "help"}
+
+func (s *session) runCommand(line string) {
+	name := strings.TrimPrefix(line, ":")
+	arg := ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command: :%s (try :help)\n", name)
+		return
+	}
+	if cmd.args != "" && arg == "" {
+		fmt.Fprintf(s.out, "usage: :%s %s\n", name, cmd.args)
+		return
+	}
+	if cmd.args == "" && arg != "" {
+		fmt.Fprintf(s.out, "usage: :%s\n", name)
+		return
+	}
+
+	cmd.run(s, arg)
+}
+
+func (s *session) showTokens(src string) {
+	l := lexer.New(src)
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(s.out, "%-6s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+		if tok.Type == tk.EOF {
+			return
+		}
+	}
+}
+
+// showAST prints the tree of the source, as a Graphviz graph or an
+// S-expression if the source is preceded by -dot or -sexp.
+func (s *session) showAST(arg string) {
+	render := func(program *ast.Program) { io.WriteString(s.out, ast.Tree(program)) }
+	src := arg
+	if i := strings.IndexAny(arg, " \t"); i >= 0 {
+		switch arg[:i] {
+		case "-dot":
+			render = func(program *ast.Program) { io.WriteString(s.out, ast.DOT(program)) }
+			src = strings.TrimSpace(arg[i:])
+		case "-sexp":
+			render = func(program *ast.Program) { io.WriteString(s.out, ast.Sexp(program)) }
+			src = strings.TrimSpace(arg[i:])
+		}
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(s.out, p.Errors())
+		return
+	}
+	render(program)
+}
+
+func (s *session) showEnv(string) {
+	for _, name := range s.env.Names() {
+		val, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, s.printer.layout(val, 0, len(name)+3))
+	}
+}
+
+func (s *session) load(path string) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "could not load %s: %s\n", path, err)
+		return
+	}
+	// Imports in the file are relative to it.
+	file := s.env.File
+	s.env.File = path
+	defer func() { s.env.File = file }()
+
+	s.eval(string(src))
+}
+
+func (s *session) reset(string) {
+	s.env = newEnvironment()
+	io.WriteString(s.out, "environment reset\n")
+}
+
+func (s *session) timeEval(src string) {
+	start := time.Now()
+	evaluated, ok := s.evalSilently(src)
+	elapsed := time.Since(start)
+	if ok {
+		s.printResult(evaluated)
+		fmt.Fprintf(s.out, "time: %s\n", elapsed)
+	}
+}
+
+func (s *session) showType(src string) {
+	evaluated, ok := s.evalSilently(src)
+	if !ok {
+		return
+	}
+	if err, isErr := evaluated.(*object.Error); isErr {
+		s.printResult(err)
+		return
+	}
+	if evaluated == nil {
+		io.WriteString(s.out, "no value\n")
+		return
+	}
+	fmt.Fprintf(s.out, "%s\n", evaluated.Type())
+}
+
+func (s *session) showHelp(string) {
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		usage := ":" + name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		fmt.Fprintf(s.out, "  %-16s %s\n", usage, cmd.help)
+	}
+}
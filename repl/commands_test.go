@@ -0,0 +1,171 @@
+package repl
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/internal/scripttest"
+)
+
+// runSession runs the REPL over the input and returns the output
+// without the prompts.
+func runSession(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	output := strings.ReplaceAll(out.String(), PROMPT, "")
+	return strings.ReplaceAll(output, CONTINUATION_PROMPT, "")
+}
+
+func TestTokensCommand(t *testing.T) {
+	output := runSession(":tokens let x = \"a\";\n")
+
+	expected := `1:1    LET        "let"
+1:5    IDENT      "x"
+1:7    =          "="
+1:9    STRING     "a"
+1:12   ;          ";"
+1:13   EOF        ""
+`
+	if output != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, output)
+	}
+}
+
+func TestASTCommand(t *testing.T) {
+	output := runSession(":ast let f = fn(a) { if (a > 1) { a } else { -a } }; f(2)\n")
+
+	expected := `Program
+  statements[0]: LetStatement
+    name: Identifier f
+    value: FunctionLiteral
+      parameters[0]: Identifier a
+      body: BlockStatement
+        statements[0]: ExpressionStatement
+          expression: IfExpression
+            condition: InfixExpression >
+              left: Identifier a
+              right: IntegerLiteral 1
+            consequence: BlockStatement
+              statements[0]: ExpressionStatement
+                expression: Identifier a
+            alternative: BlockStatement
+              statements[0]: ExpressionStatement
+                expression: PrefixExpression -
+                  right: Identifier a
+  statements[1]: ExpressionStatement
+    expression: CallExpression
+      function: Identifier f
+      arguments[0]: IntegerLiteral 2
+`
+	if output != expected {
+		t.Errorf("wrong output.\nwant=%s\ngot= %s", expected, output)
+	}
+
+	output = runSession(":ast -sexp 1 + 2 * 3\n")
+	if output != "(program (+ 1 (* 2 3)))\n" {
+		t.Errorf("wrong S-expression output. got=%q", output)
+	}
+
+	output = runSession(":ast -dot x\n")
+	if !strings.HasPrefix(output, "digraph AST {\n") || !strings.Contains(output, `n1 -> n2 [label="expression"];`) {
+		t.Errorf("wrong DOT output. got=%q", output)
+	}
+
+	output = runSession(":ast let = 1\n")
+	if !strings.HasPrefix(output, "ERROR\n\texpected next token to be IDENT") {
+		t.Errorf("parse errors not reported. got=%q", output)
+	}
+}
+
+func TestEnvAndResetCommands(t *testing.T) {
+	output := runSession("let b = [1, 2];\nlet a = \"x\";\n:env\n:reset\n:env\na\n")
+
+	expected := `a = "x"
+b = [1, 2]
+environment reset
+ERROR: identifier not found: a
+	at <main> (1:1)
+`
+	if output != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, output)
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	path := scripttest.WriteFile(t, "lib.mk", "let double = fn(x) {\n  x * 2\n};\ndouble(1)\n")
+
+	output := runSession(":load " + path + "\ndouble(21)\n:load nowhere.mk\n")
+
+	expected := "2\n42\ncould not load nowhere.mk: open nowhere.mk: no such file or directory\n"
+	if output != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, output)
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	output := runSession(":time 6 * 7\n")
+
+	pattern := regexp.MustCompile(`^42\ntime: [0-9.]+[µn]?m?s\n$`)
+	if !pattern.MatchString(output) {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestTypeCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":type 1 + 2\n", "INTEGER\n"},
+		{":type \"a\"\n", "STRING\n"},
+		{":type fn(x) { x }\n", "FUNCTION\n"},
+		{":type json_parse\n", "BUILTIN\n"},
+		{":type let x = 1\n", "no value\n"},
+		{":type nope\n", "ERROR: identifier not found: nope\n\tat <main> (1:1)\n"},
+	}
+
+	for _, tt := range tests {
+		output := runSession(tt.input)
+		if output != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":nope\n", "unknown command: :nope (try :help)\n"},
+		{":tokens\n", "usage: :tokens <src>\n"},
+		{":env x\n", "usage: :env\n"},
+	}
+
+	for _, tt := range tests {
+		output := runSession(tt.input)
+		if output != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	output := runSession(":help\n")
+
+	for _, name := range commandOrder {
+		if !strings.Contains(output, ":"+name) {
+			t.Errorf("help does not mention :%s. got=%q", name, output)
+		}
+	}
+}
+
+func TestCommandsOnlyAtStartOfInput(t *testing.T) {
+	output := runSession("let h = {\n:env\n}\n")
+
+	if !strings.HasPrefix(output, "ERROR") {
+		t.Errorf("command in continuation line should be parsed as code. got=%q", output)
+	}
+}
@@ -0,0 +1,421 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errInterrupted is returned when the user discards the line with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads a line of input after showing a prompt.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader is used when the input is not a terminal.
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Keys decoded from escape sequences, outside of the Unicode range.
+const (
+	keyUp = iota + 0x110000
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// editor is an Emacs-like line editor working on a terminal in raw mode.
+// It knows nothing about the terminal itself, so it can be driven by
+// any reader and writer.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+
+	// complete returns the words starting with the given prefix.
+	complete func(prefix string) []string
+
+	// highlight decorates the line for display, if set.
+	highlight func(line string) string
+
+	// The line being edited.
+	prompt string
+	buf    []rune
+	pos    int
+
+	// Position in the history while navigating it.
+	// It equals the history length while editing a new line.
+	histIdx int
+	pending []rune // The new line, kept while navigating the history
+}
+
+func newEditor(in io.Reader, out io.Writer, h *history, complete func(string) []string) *editor {
+	return &editor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		history:  h,
+		complete: complete,
+	}
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf = nil
+	e.pos = 0
+	e.histIdx = len(e.history.entries)
+	e.pending = nil
+	e.refresh()
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, '\n':
+			return e.acceptLine(), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyCtrlR:
+			line, accepted, err := e.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				return line, nil
+			}
+		default:
+			e.edit(key)
+		}
+		e.refresh()
+	}
+}
+
+func (e *editor) acceptLine() string {
+	io.WriteString(e.out, "\r\n")
+	line := string(e.buf)
+	e.history.add(line)
+	return line
+}
+
+// edit applies a key that only changes the line being edited.
+func (e *editor) edit(key rune) {
+	switch key {
+	case keyCtrlA, keyHome:
+		e.pos = 0
+	case keyCtrlE, keyEnd:
+		e.pos = len(e.buf)
+	case keyCtrlB, keyLeft:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case keyCtrlF, keyRight:
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case keyBackspace, keyDelete:
+		if e.pos > 0 {
+			e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+			e.pos--
+		}
+	case keyDeleteForward:
+		e.deleteForward()
+	case keyCtrlK:
+		e.buf = e.buf[:e.pos]
+	case keyCtrlU:
+		e.buf = e.buf[e.pos:]
+		e.pos = 0
+	case keyCtrlW:
+		start := e.pos
+		for start > 0 && e.buf[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && e.buf[start-1] != ' ' {
+			start--
+		}
+		e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+		e.pos = start
+	case keyCtrlP, keyUp:
+		e.historyPrev()
+	case keyCtrlN, keyDown:
+		e.historyNext()
+	case keyTab:
+		e.completeWord()
+	case keyCtrlL:
+		io.WriteString(e.out, "\x1b[H\x1b[2J")
+	default:
+		if key >= ' ' && key < keyUp {
+			e.insert(key)
+		}
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *editor) deleteForward() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+func (e *editor) setLine(line []rune) {
+	e.buf = append([]rune(nil), line...)
+	e.pos = len(e.buf)
+}
+
+func (e *editor) historyPrev() {
+	if e.histIdx == 0 {
+		return
+	}
+	if e.histIdx == len(e.history.entries) {
+		e.pending = e.buf
+	}
+	e.histIdx--
+	e.setLine([]rune(e.history.entries[e.histIdx]))
+}
+
+func (e *editor) historyNext() {
+	if e.histIdx == len(e.history.entries) {
+		return
+	}
+	e.histIdx++
+	if e.histIdx == len(e.history.entries) {
+		e.setLine(e.pending)
+	} else {
+		e.setLine([]rune(e.history.entries[e.histIdx]))
+	}
+}
+
+// reverseSearch searches the history incrementally, newest first.
+// Enter runs the matched line, Ctrl-R finds an older match, and Ctrl-G
+// cancels the search. Any other key leaves the match in the line
+// and is processed as usual.
+func (e *editor) reverseSearch() (line string, accepted bool, err error) {
+	original := e.buf
+	query := []rune{}
+	idx := len(e.history.entries)
+	match := ""
+
+	search := func(from int) {
+		if from >= len(e.history.entries) {
+			from = len(e.history.entries) - 1
+		}
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history.entries[i], string(query)) {
+				idx = i
+				match = e.history.entries[i]
+				return
+			}
+		}
+	}
+
+	for {
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), match)
+
+		key, err := e.readKey()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch {
+		case key == keyCtrlR:
+			search(idx - 1)
+		case key == keyBackspace || key == keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				search(len(e.history.entries) - 1)
+			}
+		case key == keyCtrlG || key == keyCtrlC:
+			e.setLine(original)
+			return "", false, nil
+		case key == keyEnter || key == '\n':
+			e.setLine([]rune(match))
+			return e.acceptLine(), true, nil
+		case key >= ' ' && key < keyUp && key != keyDelete:
+			query = append(query, key)
+			search(idx)
+		default:
+			e.setLine([]rune(match))
+			e.edit(key)
+			return "", false, nil
+		}
+	}
+}
+
+// completeWord completes the word before the cursor. When there are several
+// candidates it inserts their common prefix, and lists them when the
+// word cannot be extended any further.
+func (e *editor) completeWord() {
+	start := e.pos
+	for start > 0 && isWordChar(e.buf[start-1]) {
+		start--
+	}
+	prefix := string(e.buf[start:e.pos])
+	if prefix == "" || e.complete == nil {
+		return
+	}
+
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		io.WriteString(e.out, "\a")
+		return
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if len(common) > len(prefix) {
+		for _, r := range common[len(prefix):] {
+			e.insert(r)
+		}
+		return
+	}
+
+	if len(candidates) > 1 {
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+func isWordChar(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
+
+// refresh redraws the line and puts the cursor back in place.
+func (e *editor) refresh() {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	if e.highlight != nil {
+		b.WriteString(e.highlight(string(e.buf)))
+	} else {
+		b.WriteString(string(e.buf))
+	}
+	b.WriteString("\x1b[K")
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", n)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+// readKey reads a key, decoding the escape sequences of special keys.
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return keyUnknown, nil
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	}
+
+	// Sequences like ESC [ 3 ~
+	if r < '0' || '9' < r {
+		return keyUnknown, nil
+	}
+	code := string(r)
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r < '0' || '9' < r {
+			break
+		}
+		code += string(r)
+	}
+	if r != '~' {
+		return keyUnknown, nil
+	}
+	switch code {
+	case "1", "7":
+		return keyHome, nil
+	case "4", "8":
+		return keyEnd, nil
+	case "3":
+		return keyDeleteForward, nil
+	}
+	return keyUnknown, nil
+}
@@ -0,0 +1,180 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/object"
+)
+
+const (
+	up    = "\x1b[A"
+	down  = "\x1b[B"
+	right = "\x1b[C"
+	left  = "\x1b[D"
+)
+
+// readLines feeds keys to an editor and collects the lines it returns.
+func readLines(t *testing.T, keys string, h *history, complete func(string) []string) ([]string, string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	e := newEditor(strings.NewReader(keys), &out, h, complete)
+
+	lines := []string{}
+	for {
+		line, err := e.ReadLine(">> ")
+		if err == io.EOF {
+			return lines, out.String()
+		}
+		if err == errInterrupted {
+			lines = append(lines, "<interrupted>")
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEditorEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"ac" + left + "b\r", "abc"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"abd\x7fc\r", "abc"},
+		{"abxc" + left + left + "\x04\r", "abc"},
+		{"abxc" + left + left + "\x1b[3~\r", "abc"},
+		{"abc" + left + left + "\x0b\r", "a"},
+		{"abc" + left + "\x15\r", "c"},
+		{"let foo bar\x17baz\r", "let foo baz"},
+		{"a\x02\x02b\x06\x06c\r", "bac"},
+		{"x\x1b[H" + "y" + "\x1b[F" + "z\r", "yxz"},
+		{"a\x1bxb\r", "ab"},
+	}
+
+	for _, tt := range tests {
+		lines, _ := readLines(t, tt.keys, &history{}, nil)
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("keys %q: want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+}
+
+func TestEditorInterruptAndEOF(t *testing.T) {
+	lines, _ := readLines(t, "abc\x03def\r\x04", &history{}, nil)
+
+	expected := []string{"<interrupted>", "def"}
+	if strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("want=%q, got=%q", expected, lines)
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	h := &history{}
+	keys := "first\r" + "second\r" +
+		up + "\r" + // second
+		up + up + "!\r" + // first!
+		"new" + up + down + "\r" // new
+
+	lines, _ := readLines(t, keys, h, nil)
+
+	expected := []string{"first", "second", "second", "first!", "new"}
+	if strings.Join(lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("want=%q, got=%q", expected, lines)
+	}
+
+	expectedEntries := []string{"first", "second", "first!", "new"}
+	if strings.Join(h.entries, ",") != strings.Join(expectedEntries, ",") {
+		t.Errorf("wrong history. want=%q, got=%q", expectedEntries, h.entries)
+	}
+}
+
+func TestEditorReverseSearch(t *testing.T) {
+	h := &history{entries: []string{"let abc = 1", "let x = 2", "abc + 1", "puts(x)"}}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"\x12abc\r", "abc + 1"},
+		{"\x12abc\x12\r", "let abc = 1"},
+		{"\x12abcd\x7f\r", "abc + 1"},
+		{"\x12x\x05!\r", "puts(x)!"},
+		{"old\x12let\x07\r", "old"},
+	}
+
+	for _, tt := range tests {
+		lines, _ := readLines(t, tt.keys, &history{entries: h.entries}, nil)
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("keys %q: want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("counter", &object.Integer{Value: 1})
+	env.Set("count_all", &object.Integer{Value: 2})
+	complete := completer(&session{env: env})
+
+	tests := []struct {
+		keys     string
+		expected string
+		listed   string
+	}{
+		{"ret\t 1\r", "return 1", ""},
+		{"json_s\t(1)\r", "json_stringify(1)", ""},
+		{"1 + co\t\r", "1 + count", ""},
+		{"1 + count\t\r", "1 + count", "count_all  counter"},
+		{"zzz\t\r", "zzz", ""},
+	}
+
+	for _, tt := range tests {
+		lines, out := readLines(t, tt.keys, &history{}, complete)
+		if len(lines) != 1 || lines[0] != tt.expected {
+			t.Errorf("keys %q: want=%q, got=%q", tt.keys, tt.expected, lines)
+		}
+		if tt.listed != "" && !strings.Contains(out, "\r\n"+tt.listed+"\r\n") {
+			t.Errorf("keys %q: candidates %q not listed in %q", tt.keys, tt.listed, out)
+		}
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".monkey_history")
+
+	h, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("loadHistory failed: %s", err)
+	}
+	for _, line := range []string{"a", "b", "b", "", "c"} {
+		if err := h.add(line); err != nil {
+			t.Fatalf("add failed: %s", err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("history file not written: %s", err)
+	}
+	if string(content) != "a\nb\nc\n" {
+		t.Errorf("wrong history file. got=%q", content)
+	}
+
+	h, err = loadHistory(path)
+	if err != nil {
+		t.Fatalf("loadHistory failed: %s", err)
+	}
+	if strings.Join(h.entries, ",") != "a,b,c" {
+		t.Errorf("wrong loaded history. got=%q", h.entries)
+	}
+}
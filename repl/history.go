@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+// Only the latest entries are loaded from the history file.
+const maxHistory = 1000
+
+// history keeps the lines entered by the user. When it has a path,
+// each line is appended to the file so that it survives the session.
+type history struct {
+	entries []string
+	path    string
+}
+
+// historyPath returns the path of the history file, or an empty string
+// when the home directory is unknown.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// loadHistory reads the history file at path. A missing file is
+// treated as an empty history.
+func loadHistory(path string) (*history, error) {
+	h := &history{path: path}
+	if path == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+	return h, scanner.Err()
+}
+
+// add records a line unless it is blank or repeats the previous one.
+func (h *history) add(line string) error {
+	if line == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+
+	if h.path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line + "\n")
+	return err
+}
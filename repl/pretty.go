@@ -0,0 +1,170 @@
+package repl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ryym/monkey/object"
+)
+
+const (
+	// Collections wider than this are printed one element per line.
+	maxLineWidth = 72
+
+	// Elements after this many are omitted from the output.
+	maxCollectionItems = 100
+)
+
+// printer renders values for the REPL: strings are quoted, collections
+// that don't fit on a line are indented, and long collections are truncated.
+type printer struct {
+	color bool
+}
+
+func (p *printer) paint(color, text string) string {
+	if !p.color {
+		return text
+	}
+	return paint(color, text)
+}
+
+func (p *printer) format(obj object.Object) string {
+	return p.layout(obj, 0, 0)
+}
+
+// layout renders a value that starts at the given column of a line
+// indented by indent.
+func (p *printer) layout(obj object.Object, indent, column int) string {
+	text, width := p.flat(obj)
+	if column+width <= maxLineWidth {
+		return text
+	}
+
+	inner := indent + 2
+	switch obj := obj.(type) {
+	case *object.Array:
+		items := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			items[i] = p.layout(el, inner, inner)
+		}
+		return p.block("[", "]", items, indent)
+	case *object.Hash:
+		pairs := obj.OrderedPairs()
+		items := make([]string, len(pairs))
+		for i, pair := range pairs {
+			key, keyWidth := p.flat(pair.Key)
+			items[i] = key + ": " + p.layout(pair.Value, inner, inner+keyWidth+2)
+		}
+		return p.block("{", "}", items, indent)
+	case *object.Record:
+		items := make([]string, len(obj.Fields))
+		for i, f := range obj.Fields {
+			items[i] = f.Name + ": " + p.layout(f.Value, inner, inner+len(f.Name)+2)
+		}
+		return p.block(obj.Name+"{", "}", items, indent)
+	default:
+		return text
+	}
+}
+
+// block puts each item on its own line.
+func (p *printer) block(open, close string, items []string, indent int) string {
+	items, more := truncate(items)
+
+	pad := strings.Repeat(" ", indent+2)
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for _, item := range items {
+		out.WriteString(pad + item + ",\n")
+	}
+	if more != "" {
+		out.WriteString(pad + p.paint(colorGray, more) + "\n")
+	}
+	out.WriteString(strings.Repeat(" ", indent) + close)
+	return out.String()
+}
+
+// flat renders a value on a single line, and returns it with its width
+// on the screen.
+func (p *printer) flat(obj object.Object) (string, int) {
+	switch obj := obj.(type) {
+	case *object.Integer, *object.Boolean:
+		text := obj.Inspect()
+		return p.paint(colorYellow, text), len(text)
+	case *object.String:
+		text := strconv.Quote(obj.Value)
+		return p.paint(colorGreen, text), len(text)
+	case *object.Null:
+		return p.paint(colorGray, "null"), 4
+	case *object.Function:
+		params := make([]string, len(obj.Parameters))
+		for i, param := range obj.Parameters {
+			params[i] = param.Value
+		}
+		text := fmt.Sprintf("fn(%s) { ... }", strings.Join(params, ", "))
+		return p.paint(colorCyan, text), len(text)
+	case *object.Builtin:
+		text := obj.Inspect()
+		return p.paint(colorCyan, text), len(text)
+	case *object.Error, *object.ErrorValue:
+		text := obj.Inspect()
+		return p.paint(colorRed, text), len(text)
+	case *object.Array:
+		items := make([]string, len(obj.Elements))
+		widths := make([]int, len(obj.Elements))
+		for i, el := range obj.Elements {
+			items[i], widths[i] = p.flat(el)
+		}
+		return p.flatList("[", "]", items, widths)
+	case *object.Hash:
+		pairs := obj.OrderedPairs()
+		items := make([]string, len(pairs))
+		widths := make([]int, len(pairs))
+		for i, pair := range pairs {
+			key, keyWidth := p.flat(pair.Key)
+			value, valueWidth := p.flat(pair.Value)
+			items[i], widths[i] = key+": "+value, keyWidth+2+valueWidth
+		}
+		return p.flatList("{", "}", items, widths)
+	case *object.Record:
+		items := make([]string, len(obj.Fields))
+		widths := make([]int, len(obj.Fields))
+		for i, f := range obj.Fields {
+			value, valueWidth := p.flat(f.Value)
+			items[i], widths[i] = f.Name+": "+value, len(f.Name)+2+valueWidth
+		}
+		return p.flatList(obj.Name+"{", "}", items, widths)
+	default:
+		text := obj.Inspect()
+		return text, len(text)
+	}
+}
+
+func (p *printer) flatList(open, close string, items []string, widths []int) (string, int) {
+	items, more := truncate(items)
+
+	width := len(open) + len(close)
+	for i := range items {
+		width += widths[i]
+		if i > 0 {
+			width += 2
+		}
+	}
+	if more != "" {
+		items = append(items, p.paint(colorGray, more))
+		width += len(more) + 2
+	}
+
+	return open + strings.Join(items, ", ") + close, width
+}
+
+// truncate keeps the first items of a long collection and describes
+// how many were left out.
+func truncate(items []string) ([]string, string) {
+	if len(items) <= maxCollectionItems {
+		return items, ""
+	}
+	more := fmt.Sprintf("... %d more", len(items)-maxCollectionItems)
+	return items[:maxCollectionItems], more
+}
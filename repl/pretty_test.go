@@ -0,0 +1,145 @@
+package repl
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+)
+
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+func TestPrinterFlat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1`, `1`},
+		{`"a\"b"`, `"a\"b"`},
+		{`if (false) { 1 }`, `null`},
+		{`fn(a, b) { a + b }`, `fn(a, b) { ... }`},
+		{`[1, "two", [true]]`, `[1, "two", [true]]`},
+		{`{"b": 1, "a": {}}`, `{"b": 1, "a": {}}`},
+		{`try { throw "x" } catch (e) { e }`, `Error: x`},
+	}
+
+	p := &printer{}
+	for _, tt := range tests {
+		actual := p.format(testEval(t, tt.input))
+		if actual != tt.expected {
+			t.Errorf("%s: want=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestPrinterIndentsWideCollections(t *testing.T) {
+	input := `{
+		"name": "a fairly long string to push the width",
+		"items": [1, 2, 3],
+		"nested": ["another long string that will not fit", "and this one as well"]
+	}`
+
+	expected := `{
+  "name": "a fairly long string to push the width",
+  "items": [1, 2, 3],
+  "nested": [
+    "another long string that will not fit",
+    "and this one as well",
+  ],
+}`
+
+	actual := (&printer{}).format(testEval(t, input))
+	if actual != expected {
+		t.Errorf("wrong output.\nwant=%s\ngot= %s", expected, actual)
+	}
+}
+
+func TestPrinterTruncatesLongCollections(t *testing.T) {
+	elements := make([]object.Object, 250)
+	for i := range elements {
+		elements[i] = &object.Integer{Value: int64(i)}
+	}
+
+	actual := (&printer{}).format(&object.Array{Elements: elements})
+
+	lines := strings.Split(actual, "\n")
+	if len(lines) != maxCollectionItems+3 {
+		t.Fatalf("wrong number of lines. got=%d", len(lines))
+	}
+	if lines[maxCollectionItems] != "  99," {
+		t.Errorf("wrong last element. got=%q", lines[maxCollectionItems])
+	}
+	if lines[maxCollectionItems+1] != "  ... 150 more" {
+		t.Errorf("wrong truncation line. got=%q", lines[maxCollectionItems+1])
+	}
+}
+
+func TestPrinterColors(t *testing.T) {
+	actual := (&printer{color: true}).format(testEval(t, `[1, "a", if (false) { 1 }]`))
+
+	expected := "[" + paint(colorYellow, "1") + ", " + paint(colorGreen, `"a"`) + ", " + paint(colorGray, "null") + "]"
+	if actual != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, actual)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let x = "a b";`,
+			paint(colorMagenta, "let") + ` x = ` + paint(colorGreen, `"a b"`) + `;`,
+		},
+		{
+			`if (true) { json_parse("1") }`,
+			paint(colorMagenta, "if") + ` (` + paint(colorYellow, "true") + `) { ` +
+				paint(colorCyan, "json_parse") + `(` + paint(colorGreen, `"1"`) + `) }`,
+		},
+		{
+			`1 @ "open`,
+			paint(colorYellow, "1") + ` ` + paint(colorRed, "@") + ` ` + paint(colorGreen, `"open`),
+		},
+		{`  x  `, `  x  `},
+	}
+
+	for _, tt := range tests {
+		actual := highlight(tt.input)
+		if actual != tt.expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	if useColor(&strings.Builder{}) {
+		t.Errorf("colours should not be used for non-terminal output")
+	}
+
+	orig, had := os.LookupEnv("NO_COLOR")
+	os.Setenv("NO_COLOR", "1")
+	defer func() {
+		if had {
+			os.Setenv("NO_COLOR", orig)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+
+	if useColor(os.Stdout) {
+		t.Errorf("colours should not be used when NO_COLOR is set")
+	}
+}
@@ -4,39 +4,201 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ryym/monkey/evaluator"
 	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
 	"github.com/ryym/monkey/parser"
+	tk "github.com/ryym/monkey/token"
 )
 
 const PROMPT = ">> "
 
+// CONTINUATION_PROMPT is shown while the input so far is incomplete.
+const CONTINUATION_PROMPT = ".. "
+
+// Start runs a session whose bindings live until the input ends.
+// A statement can span several lines. When the input is a terminal,
+// lines are read with a line editor that keeps the history in a file.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	s := &session{
+		env:     newEnvironment(),
+		out:     out,
+		printer: &printer{color: useColor(out)},
+	}
+	lines := newLineReader(in, out, s)
 
+	var input strings.Builder
 	for {
-		fmt.Printf(PROMPT)
-		if !scanner.Scan() {
+		prompt := PROMPT
+		if input.Len() > 0 {
+			prompt = CONTINUATION_PROMPT
+		}
+
+		line, err := lines.ReadLine(prompt)
+		if err == errInterrupted {
+			input.Reset()
+			continue
+		}
+		if err != nil {
+			if input.Len() > 0 {
+				io.WriteString(out, "\n")
+				s.eval(input.String())
+			}
 			return
 		}
-		line := scanner.Text()
 
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) > 0 {
-			printParseErrors(out, p.Errors())
+		if input.Len() == 0 && strings.HasPrefix(line, ":") {
+			s.runCommand(line)
 			continue
 		}
 
-		evaluated := evaluator.Eval(program)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		input.WriteString(line)
+		input.WriteString("\n")
+		if isIncomplete(input.String()) {
+			continue
+		}
+
+		s.eval(input.String())
+		input.Reset()
+	}
+}
+
+// session is the state of a REPL session.
+type session struct {
+	env     *object.Environment
+	out     io.Writer
+	printer *printer
+}
+
+// newEnvironment creates the top-level environment of a session, where
+// modules are searched relative to the current directory and then in
+// the directories listed in MONKEY_PATH.
+func newEnvironment() *object.Environment {
+	env := object.NewEnvironment()
+	env.Importer = evaluator.NewLoader(filepath.SplitList(os.Getenv("MONKEY_PATH")))
+	return env
+}
+
+func newLineReader(in io.Reader, out io.Writer, s *session) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		h, err := loadHistory(historyPath())
+		if err != nil {
+			fmt.Fprintf(out, "could not load history: %s\n", err)
+		}
+		e := newEditor(f, out, h, completer(s))
+		if s.printer.color {
+			e.highlight = highlight
+		}
+		return &terminalReader{fd: f.Fd(), editor: e}
+	}
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// terminalReader switches the terminal to raw mode only while editing
+// a line, so that evaluation output is printed as usual.
+type terminalReader struct {
+	fd     uintptr
+	editor *editor
+}
+
+func (r *terminalReader) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return r.editor.ReadLine(prompt)
+}
+
+// completer completes keywords, builtins and the names bound in the session.
+func completer(s *session) func(string) []string {
+	return func(prefix string) []string {
+		words := tk.Keywords()
+		words = append(words, evaluator.BuiltinNames()...)
+		words = append(words, s.env.Names()...)
+		sort.Strings(words)
+
+		matches := []string{}
+		for i, w := range words {
+			if strings.HasPrefix(w, prefix) && (i == 0 || words[i-1] != w) {
+				matches = append(matches, w)
+			}
+		}
+		return matches
+	}
+}
+
+func (s *session) eval(input string) {
+	evaluated, ok := s.evalSilently(input)
+	if ok {
+		s.printResult(evaluated)
+	}
+}
+
+// evalSilently evaluates the input without printing the result.
+// Parse errors are printed and reported as not ok.
+func (s *session) evalSilently(input string) (object.Object, bool) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(s.out, p.Errors())
+		return nil, false
+	}
+
+	return evaluator.Eval(program, s.env), true
+}
+
+func (s *session) printResult(evaluated object.Object) {
+	if evaluated != nil {
+		io.WriteString(s.out, s.printer.format(evaluated))
+		io.WriteString(s.out, "\n")
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		printStackTrace(s.out, err)
+	}
+}
+
+// Tokens after which an expression must continue.
+var continuingTokens = map[tk.TokenType]bool{
+	tk.ASSIGN:   true,
+	tk.PLUS:     true,
+	tk.MINUS:    true,
+	tk.BANG:     true,
+	tk.ASTERISK: true,
+	tk.SLASH:    true,
+	tk.LT:       true,
+	tk.GT:       true,
+	tk.EQ:       true,
+	tk.NOT_EQ:   true,
+	tk.COMMA:    true,
+	tk.COLON:    true,
+	tk.DOT:      true,
+}
+
+// isIncomplete reports whether the input has unclosed brackets
+// or ends with an operator. Such input is not evaluated yet.
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	var last tk.TokenType
+
+	for tok := l.NextToken(); tok.Type != tk.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case tk.LPAREN, tk.LBRACE, tk.LBRACKET:
+			depth++
+		case tk.RPAREN, tk.RBRACE, tk.RBRACKET:
+			depth--
 		}
+		last = tok.Type
 	}
 
+	return depth > 0 || continuingTokens[last]
 }
 
 func printParseErrors(out io.Writer, errs []string) {
@@ -45,3 +207,9 @@ func printParseErrors(out io.Writer, errs []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printStackTrace(out io.Writer, err *object.Error) {
+	for _, frame := range err.Stack {
+		io.WriteString(out, "\t"+frame.String()+"\n")
+	}
+}
@@ -0,0 +1,81 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"1 + 2\n",
+			">> 3\n>> ",
+		},
+		{
+			"let x = 5;\nx * 2\n",
+			">> >> 10\n>> ",
+		},
+		{
+			"let add = fn(a, b) {\n  a + b\n};\nadd(1, 2)\n",
+			">> .. .. >> 3\n>> ",
+		},
+		{
+			"[1,\n2][1]\n",
+			">> .. 2\n>> ",
+		},
+		{
+			"1 +\n2\n",
+			">> .. 3\n>> ",
+		},
+		{
+			"let x = \n",
+			">> .. \nERROR\n\tno prefix parse function for EOF found\n",
+		},
+		{
+			"let = 1\n2\n",
+			">> ERROR\n\texpected next token to be IDENT, got = instead\n\tno prefix parse function for = found\n>> 2\n>> ",
+		},
+		{
+			"let f = fn() { 1 + true };\nf()\n",
+			">> >> ERROR: type mismatch: INTEGER + BOOLEAN\n\tat f (1:18)\n\tat <main> (1:2)\n>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"fn(x) {", true},
+		{"fn(x) { x }", false},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{`{"a": 1`, true},
+		{"let x =", true},
+		{"x.", true},
+		{"1 *", true},
+		{"}", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if actual := isIncomplete(tt.input); actual != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package repl
+
+import "errors"
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
@@ -0,0 +1,275 @@
+// Package resolver binds the identifiers of a program to their
+// declarations before it runs.
+//
+// Each identifier gets an ast.Address telling the evaluator where its
+// value is: globals and builtins are looked up by name, while the names
+// bound in a function, including those bound in its blocks, have a slot
+// in the environment of the function call. Names that are bound nowhere,
+// and names bound twice in a function, are reported as diagnostics.
+//
+// Blocks do not make scopes, except for catch clauses, so a function
+// scope has every name bound by the let statements and imports of its
+// body, except for those of nested functions and catch clauses. A catch
+// clause has a scope of its own, like a function, with its parameter
+// and the names bound in its block. A use that comes before the first
+// binding of a local name in the source refers to the enclosing scopes
+// instead, as it does when evaluated.
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/ryym/monkey/ast"
+	tk "github.com/ryym/monkey/token"
+)
+
+// Diagnostic is a problem found in a program before running it.
+type Diagnostic struct {
+	Pos     tk.Position
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// Info records the symbols of the identifiers of a program, for tools
+// such as linters and editors.
+type Info struct {
+	Defs map[*ast.Identifier]*Symbol // Names being bound
+	Uses map[*ast.Identifier]*Symbol // Names referred to, except undefined ones
+}
+
+func NewInfo() *Info {
+	return &Info{Defs: make(map[*ast.Identifier]*Symbol), Uses: make(map[*ast.Identifier]*Symbol)}
+}
+
+// Resolve sets the addresses of the identifiers of a program and the
+// locals of its function literals. The names bound at the top level of
+// the program are defined in the global table.
+func Resolve(program *ast.Program, globals *SymbolTable) []Diagnostic {
+	return ResolveInfo(program, globals, nil)
+}
+
+// ResolveInfo resolves a program as Resolve does, and records the
+// symbols in info unless it is nil.
+func ResolveInfo(program *ast.Program, globals *SymbolTable, info *Info) []Diagnostic {
+	r := &resolver{table: globals, info: info}
+	for _, decl := range declarations(program) {
+		globals.Define(decl.name.Value, decl.kind, decl.name.Pos())
+	}
+	r.statements(program.Statements, nil)
+	return r.diagnostics
+}
+
+type resolver struct {
+	table *SymbolTable
+	info  *Info
+
+	// bound has the local names of the current function bound so far.
+	bound map[string]bool
+
+	diagnostics []Diagnostic
+}
+
+func (r *resolver) errorf(pos tk.Position, format string, a ...interface{}) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+// statements resolves a list of statements. In a function, names bound
+// twice in the list, or bound in it after being in names, are reported.
+// Globals can be bound again, as in `import "m"; let m = m.sub;`.
+func (r *resolver) statements(stmts []ast.Statement, names map[string]tk.Position) {
+	if names == nil {
+		names = make(map[string]tk.Position)
+	}
+	for _, stmt := range stmts {
+		r.resolve(stmt)
+		if r.bound == nil {
+			continue
+		}
+
+		var name *ast.Identifier
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			name = stmt.Name
+		case *ast.ImportStatement:
+			name = stmt.Name
+		default:
+			continue
+		}
+		if pos, ok := names[name.Value]; ok {
+			r.errorf(name.Pos(), "duplicate binding of %s, first bound at %s", name.Value, pos)
+			continue
+		}
+		names[name.Value] = name.Pos()
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		r.statements(node.Statements, nil)
+	case *ast.LetStatement:
+		// The value is resolved first so that `let x = x` refers to
+		// the outer x.
+		r.resolve(node.Value)
+		r.bind(node.Name, LetKind)
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+	case *ast.ImportStatement:
+		r.bind(node.Name, ImportKind)
+
+	case *ast.Identifier:
+		r.use(node)
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		r.function(node)
+	case *ast.CallExpression:
+		r.resolve(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolve(arg)
+		}
+	case *ast.MemberExpression:
+		// The property is a member name, not a variable.
+		r.resolve(node.Object)
+	case *ast.TryExpression:
+		r.resolve(node.Block)
+		if node.Catch != nil {
+			r.catch(node)
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.resolve(el)
+		}
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			r.resolve(pair.Key)
+			r.resolve(pair.Value)
+		}
+	}
+}
+
+func (r *resolver) function(fn *ast.FunctionLiteral) {
+	outer, outerBound := r.table, r.bound
+	r.table, r.bound = NewEnclosedSymbolTable(outer), make(map[string]bool)
+	defer func() { r.table, r.bound = outer, outerBound }()
+
+	params := make(map[string]tk.Position)
+	for _, param := range fn.Parameters {
+		if pos, ok := params[param.Value]; ok {
+			r.errorf(param.Pos(), "duplicate binding of %s, first bound at %s", param.Value, pos)
+			continue
+		}
+		params[param.Value] = param.Pos()
+		r.bind(param, ParamKind)
+	}
+	for _, decl := range declarations(fn.Body) {
+		r.table.Define(decl.name.Value, decl.kind, decl.name.Pos())
+	}
+
+	r.statements(fn.Body.Statements, params)
+	fn.Locals = r.table.Locals
+}
+
+// catch resolves a catch clause in a scope of its own, so that its
+// parameter hides an outer binding of the name instead of replacing it.
+func (r *resolver) catch(node *ast.TryExpression) {
+	outer, outerBound := r.table, r.bound
+	r.table, r.bound = NewEnclosedSymbolTable(outer), make(map[string]bool)
+	defer func() { r.table, r.bound = outer, outerBound }()
+
+	r.bind(node.Param, CatchKind)
+	for _, decl := range declarations(node.Catch) {
+		r.table.Define(decl.name.Value, decl.kind, decl.name.Pos())
+	}
+	r.statements(node.Catch.Statements, map[string]tk.Position{node.Param.Value: node.Param.Pos()})
+	node.CatchLocals = r.table.Locals
+}
+
+// bind sets the address of a name being bound.
+func (r *resolver) bind(name *ast.Identifier, kind Kind) {
+	sym := r.table.Define(name.Value, kind, name.Pos())
+	name.Address = sym.Address(0)
+	if r.info != nil {
+		r.info.Defs[name] = sym
+	}
+	if r.bound != nil {
+		r.bound[name.Value] = true
+	}
+}
+
+// use sets the address of a name being referred to.
+func (r *resolver) use(name *ast.Identifier) {
+	sym, depth, ok := r.table.Lookup(name.Value)
+	if !ok {
+		r.errorf(name.Pos(), "undefined: %s", name.Value)
+		return
+	}
+	if depth == 0 && sym.Scope == ast.LocalScope && !r.bound[name.Value] {
+		// Not bound yet, so the name still refers to an outer binding.
+		if outer, d, ok := r.table.Outer.Lookup(name.Value); ok {
+			sym, depth = outer, d+1
+		}
+	}
+	name.Address = sym.Address(depth)
+	if r.info != nil {
+		r.info.Uses[name] = sym
+	}
+}
+
+// declaration is a name bound by a statement.
+type declaration struct {
+	name *ast.Identifier
+	kind Kind
+}
+
+// declarations returns the names bound in a node by let statements and
+// imports, without looking into function literals and catch clauses.
+func declarations(node ast.Node) []declaration {
+	v := &declarationVisitor{}
+	ast.Walk(v, node)
+	return v.decls
+}
+
+type declarationVisitor struct {
+	decls []declaration
+}
+
+func (v *declarationVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.FunctionLiteral:
+		return nil
+	case *ast.LetStatement:
+		v.decls = append(v.decls, declaration{node.Name, LetKind})
+	case *ast.ImportStatement:
+		v.decls = append(v.decls, declaration{node.Name, ImportKind})
+	case *ast.TryExpression:
+		ast.Walk(v, node.Block)
+		if node.Finally != nil {
+			ast.Walk(v, node.Finally)
+		}
+		return nil
+	}
+	return v
+}
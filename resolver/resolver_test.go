@@ -0,0 +1,261 @@
+package resolver
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+	tk "github.com/ryym/monkey/token"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	return program
+}
+
+// addresses resolves a program and describes the address of each
+// identifier in the order of ast.Walk, like `x@LOCAL:0:1`.
+func addresses(t *testing.T, input string, globals ...string) []string {
+	t.Helper()
+	program := parse(t, input)
+	diags := Resolve(program, NewGlobalTable(globals, []string{"len", "puts"}))
+	if len(diags) > 0 {
+		t.Fatalf("%q: unexpected diagnostics: %v", input, diags)
+	}
+
+	idents := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if id, ok := node.(*ast.Identifier); ok {
+			idents = append(idents, describe(id))
+		}
+		return true
+	})
+	return idents
+}
+
+func describe(id *ast.Identifier) string {
+	if id.Address == nil {
+		return id.Value + "@?"
+	}
+	a := id.Address
+	return fmt.Sprintf("%s@%s:%d:%d", id.Value, a.Scope, a.Depth, a.Slot)
+}
+
+func TestAddresses(t *testing.T) {
+	tests := []struct {
+		input    string
+		globals  []string
+		expected []string
+	}{
+		{`let x = 1; x`, nil, []string{"x@GLOBAL:0:0", "x@GLOBAL:0:0"}},
+		{`args`, []string{"args"}, []string{"args@GLOBAL:0:0"}},
+		{`puts(len)`, nil, []string{"puts@BUILTIN:0:1", "len@BUILTIN:0:0"}},
+		{`let puts = 1; puts`, nil, []string{"puts@GLOBAL:0:0", "puts@GLOBAL:0:0"}},
+		{
+			`fn(a, b) { let c = a; b + c }`,
+			nil,
+			[]string{"a@LOCAL:0:0", "b@LOCAL:0:1", "c@LOCAL:0:2", "a@LOCAL:0:0", "b@LOCAL:0:1", "c@LOCAL:0:2"},
+		},
+		{
+			`fn(a) { fn(b) { fn() { a + b } } }`,
+			nil,
+			[]string{"a@LOCAL:0:0", "b@LOCAL:0:0", "a@FREE:2:0", "b@FREE:1:0"},
+		},
+		{
+			// Blocks bind in the scope of the function.
+			`fn() { if (true) { let x = 1 } else { let y = 2 }; x + y }`,
+			nil,
+			[]string{"x@LOCAL:0:0", "y@LOCAL:0:1", "x@LOCAL:0:0", "y@LOCAL:0:1"},
+		},
+		{
+			`fn() { try { 1 } catch (e) { e } }`,
+			nil,
+			[]string{"e@LOCAL:0:0", "e@LOCAL:0:0"},
+		},
+		{
+			// Used before its let statement, x is still the global.
+			`let x = 1; fn() { let y = x; let x = 2; x + y }`,
+			nil,
+			[]string{"x@GLOBAL:0:0", "y@LOCAL:0:0", "x@GLOBAL:0:0", "x@LOCAL:0:1", "x@LOCAL:0:1", "y@LOCAL:0:0"},
+		},
+		{
+			`fn(x) { fn() { let x = x; x } }`,
+			nil,
+			[]string{"x@LOCAL:0:0", "x@LOCAL:0:0", "x@FREE:1:0", "x@LOCAL:0:0"},
+		},
+		{
+			// Nested functions see the names bound later in their scope.
+			`fn() { let f = fn() { g() }; let g = fn() { 1 }; f }`,
+			nil,
+			[]string{"f@LOCAL:0:0", "g@FREE:1:1", "g@LOCAL:0:1", "f@LOCAL:0:0"},
+		},
+		{`import "m"; m.x`, nil, []string{"m@GLOBAL:0:0", "m@GLOBAL:0:0", "x@?"}},
+		{
+			// A catch parameter hides the outer name instead of replacing it.
+			`let e = 1; try { 0 } catch (e) { e }; e`,
+			nil,
+			[]string{"e@GLOBAL:0:0", "e@LOCAL:0:0", "e@LOCAL:0:0", "e@GLOBAL:0:0"},
+		},
+		{
+			`fn(a) { try { 0 } catch (e) { let b = a; fn() { e + b } } }`,
+			nil,
+			[]string{"a@LOCAL:0:0", "e@LOCAL:0:0", "b@LOCAL:0:1", "a@FREE:1:0", "e@FREE:1:0", "b@FREE:1:1"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := addresses(t, tt.input, tt.globals...)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: wrong addresses.\nwant=%v\ngot= %v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLocals(t *testing.T) {
+	program := parse(t, `fn(a, b) { let c = 1; if (a) { let d = 2 }; try { 0 } catch (e) { fn(z) { let w = 1 } } }`)
+	Resolve(program, NewGlobalTable(nil, nil))
+
+	fns := []*ast.FunctionLiteral{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if fn, ok := node.(*ast.FunctionLiteral); ok {
+			fns = append(fns, fn)
+		}
+		return true
+	})
+
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(fns[0].Locals, want) {
+		t.Errorf("wrong locals. want=%v, got=%v", want, fns[0].Locals)
+	}
+	if want := []string{"z", "w"}; !reflect.DeepEqual(fns[1].Locals, want) {
+		t.Errorf("wrong locals. want=%v, got=%v", want, fns[1].Locals)
+	}
+
+	tryExp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral).Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+	if want := []string{"e"}; !reflect.DeepEqual(tryExp.CatchLocals, want) {
+		t.Errorf("wrong locals of the catch clause. want=%v, got=%v", want, tryExp.CatchLocals)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`x`, []string{"1:1: undefined: x"}},
+		{`fn() { y }; 1 + z`, []string{"1:8: undefined: y", "1:17: undefined: z"}},
+		{`let a = fn(p) { p }; p`, []string{"1:22: undefined: p"}},
+		{`fn(a, b, a) { a }`, []string{"1:10: duplicate binding of a, first bound at 1:4"}},
+		{`fn(a) { let a = 1; a }`, []string{"1:13: duplicate binding of a, first bound at 1:4"}},
+		{
+			"fn() {\n  let x = 1;\n  let x = 2;\n}",
+			[]string{"3:7: duplicate binding of x, first bound at 2:7"},
+		},
+		{`fn() { import "m"; let m = m.x; }`, []string{"1:24: duplicate binding of m, first bound at 1:15"}},
+
+		// Globals can be bound again, and blocks are separate lists.
+		{`let x = 1; let x = x + 1; x`, nil},
+		{`import "m"; let m = m.sub;`, nil},
+		{`fn() { if (true) { let x = 1 } else { let x = 2 } }`, nil},
+	}
+
+	for _, tt := range tests {
+		diags := Resolve(parse(t, tt.input), NewGlobalTable(nil, nil))
+		got := []string{}
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong diagnostics.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewGlobalTable([]string{"g"}, []string{"puts"})
+	local := NewEnclosedSymbolTable(global)
+	local.Define("a", LetKind, tk.Position{})
+	local.Define("b", LetKind, tk.Position{})
+	inner := NewEnclosedSymbolTable(local)
+
+	tests := []struct {
+		name     string
+		expected ast.Address
+	}{
+		{"g", ast.Address{Scope: ast.GlobalScope}},
+		{"puts", ast.Address{Scope: ast.BuiltinScope}},
+		{"b", ast.Address{Scope: ast.FreeScope, Depth: 1, Slot: 1}},
+	}
+	for _, tt := range tests {
+		sym, depth, ok := inner.Lookup(tt.name)
+		if !ok {
+			t.Fatalf("%s not found", tt.name)
+		}
+		if got := sym.Address(depth); *got != tt.expected {
+			t.Errorf("%s: wrong address. want=%+v, got=%+v", tt.name, tt.expected, *got)
+		}
+	}
+
+	if _, _, ok := inner.Lookup("nope"); ok {
+		t.Errorf("undefined name found")
+	}
+	if sym := local.Define("a", LetKind, tk.Position{}); sym.Slot != 0 || len(local.Locals) != 2 {
+		t.Errorf("defining a name again added a slot. locals=%v", local.Locals)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	program := parse(t, `let x = 1; let f = fn(x, y) { try { x } catch (e) { puts(e) } }; f(x, args)`)
+	info := NewInfo()
+	if diags := ResolveInfo(program, NewGlobalTable([]string{"args"}, []string{"puts"}), info); len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	defs := map[string]string{}
+	for id, sym := range info.Defs {
+		defs[id.Pos().String()] = fmt.Sprintf("%s %s", sym.Name, sym.Kind)
+	}
+	wantDefs := map[string]string{
+		"1:5":  "x let",
+		"1:16": "f let",
+		"1:23": "x parameter",
+		"1:26": "y parameter",
+		"1:48": "e catch parameter",
+	}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("wrong defs.\nwant=%v\ngot= %v", wantDefs, defs)
+	}
+
+	uses := map[string]string{}
+	for id, sym := range info.Uses {
+		uses[id.Pos().String()] = fmt.Sprintf("%s %s %s", sym.Name, sym.Kind, sym.Pos)
+	}
+	wantUses := map[string]string{
+		"1:37": "x parameter 1:23",
+		"1:53": "puts builtin 0:0",
+		"1:58": "e catch parameter 1:48",
+		"1:66": "f let 1:16",
+		"1:68": "x let 1:5",
+		"1:71": "args global 0:0",
+	}
+	if !reflect.DeepEqual(uses, wantUses) {
+		t.Errorf("wrong uses.\nwant=%v\ngot= %v", wantUses, uses)
+	}
+
+	for id, sym := range info.Defs {
+		if id.Pos().String() == "1:23" && (sym.Shadows == nil || sym.Shadows.Pos.String() != "1:5") {
+			t.Errorf("parameter x does not shadow the global x. shadows=%+v", sym.Shadows)
+		}
+		if id.Pos().String() == "1:26" && sym.Shadows != nil {
+			t.Errorf("parameter y shadows %+v", sym.Shadows)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"github.com/ryym/monkey/ast"
+	tk "github.com/ryym/monkey/token"
+)
+
+// Kind tells what binds a name.
+type Kind string
+
+const (
+	LetKind     Kind = "let"
+	ParamKind   Kind = "parameter"
+	CatchKind   Kind = "catch parameter"
+	ImportKind  Kind = "import"
+	GlobalKind  Kind = "global" // Predefined by the host
+	BuiltinKind Kind = "builtin"
+)
+
+// Symbol is a name bound in a scope.
+type Symbol struct {
+	Name  string
+	Kind  Kind
+	Scope ast.Scope // GlobalScope, LocalScope or BuiltinScope
+	Slot  int
+	Pos   tk.Position // Where it is first bound, zero for predefined names
+
+	// Shadows is the binding of the same name in an enclosing scope
+	// that this one hides, if any.
+	Shadows *Symbol
+}
+
+// SymbolTable holds the names bound in a scope. The outermost table is
+// the global scope, and each function literal and catch clause encloses
+// a new table whose names live in the slots of its environment.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// Locals are the names of the slots of a function scope, in order.
+	Locals []string
+
+	symbols map[string]*Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{symbols: make(map[string]*Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	t := NewSymbolTable()
+	t.Outer = outer
+	t.Locals = []string{}
+	return t
+}
+
+// NewGlobalTable returns a global scope where the given globals and
+// builtins are defined. Builtins are numbered in the given order.
+func NewGlobalTable(globals, builtins []string) *SymbolTable {
+	t := NewSymbolTable()
+	for i, name := range builtins {
+		t.DefineBuiltin(i, name)
+	}
+	for _, name := range globals {
+		t.Define(name, GlobalKind, tk.Position{})
+	}
+	return t
+}
+
+// Define binds a name in the table, as a global in the global scope and
+// as the next slot otherwise. A name already bound keeps its symbol
+// unless it is a builtin, which a global shadows.
+func (t *SymbolTable) Define(name string, kind Kind, pos tk.Position) *Symbol {
+	if sym, ok := t.symbols[name]; ok && sym.Scope != ast.BuiltinScope {
+		return sym
+	}
+	sym := &Symbol{Name: name, Kind: kind, Scope: ast.GlobalScope, Pos: pos}
+	if t.Outer != nil {
+		sym.Scope = ast.LocalScope
+		sym.Slot = len(t.Locals)
+		t.Locals = append(t.Locals, name)
+		if outer, _, ok := t.Outer.Lookup(name); ok {
+			sym.Shadows = outer
+		}
+	}
+	t.symbols[name] = sym
+	return sym
+}
+
+func (t *SymbolTable) DefineBuiltin(index int, name string) *Symbol {
+	sym := &Symbol{Name: name, Kind: BuiltinKind, Scope: ast.BuiltinScope, Slot: index}
+	t.symbols[name] = sym
+	return sym
+}
+
+// Lookup finds the symbol of a name, and how many tables out it is bound.
+func (t *SymbolTable) Lookup(name string) (*Symbol, int, bool) {
+	depth := 0
+	for table := t; table != nil; table = table.Outer {
+		if sym, ok := table.symbols[name]; ok {
+			return sym, depth, true
+		}
+		depth++
+	}
+	return nil, 0, false
+}
+
+// Address returns the address of a symbol seen from depth tables in.
+func (s *Symbol) Address(depth int) *ast.Address {
+	switch {
+	case s.Scope != ast.LocalScope:
+		return &ast.Address{Scope: s.Scope, Slot: s.Slot}
+	case depth == 0:
+		return &ast.Address{Scope: ast.LocalScope, Slot: s.Slot}
+	default:
+		return &ast.Address{Scope: ast.FreeScope, Depth: depth, Slot: s.Slot}
+	}
+}
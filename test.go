@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ryym/monkey/tester"
+)
+
+// testFiles runs the tests of the given files, and of the test files
+// found in the given directories or the current one. It fails if any
+// test does.
+func (c *cli) testFiles(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		io.WriteString(c.stderr, "usage: monkey test [-run regexp] [-format text|tap|junit] [path...]\n")
+		flags.PrintDefaults()
+	}
+	filter := flags.String("run", "", "run only the tests whose names match the regular expression")
+	format := flags.String("format", "text", "print the results as text, TAP or JUnit XML")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	r := tester.New()
+	r.SearchPath = filepath.SplitList(os.Getenv("MONKEY_PATH"))
+	if *filter != "" {
+		re, err := regexp.Compile(*filter)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey test: invalid -run: %s\n", err)
+			return exitUsage
+		}
+		r.Filter = re
+	}
+	var write func(*tester.Report, io.Writer) error
+	switch *format {
+	case "text":
+		write = (*tester.Report).WriteText
+	case "tap":
+		write = (*tester.Report).WriteTAP
+	case "junit":
+		write = (*tester.Report).WriteJUnit
+	default:
+		fmt.Fprintf(c.stderr, "monkey test: unknown format: %s\n", *format)
+		return exitUsage
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	code := exitOK
+	files := []string{}
+	for _, path := range paths {
+		err := walkScripts(path, func(file string) {
+			if file == path || strings.HasSuffix(file, tester.Suffix) {
+				files = append(files, file)
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey test: %s\n", err)
+			code = exitError
+		}
+	}
+
+	report := r.Run(files...)
+	if err := write(report, c.stdout); err != nil {
+		fmt.Fprintf(c.stderr, "monkey test: %s\n", err)
+		return exitError
+	}
+	if !report.Passed() {
+		code = exitError
+	}
+	return code
+}
@@ -0,0 +1,182 @@
+package tester
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/internal/diff"
+	"github.com/ryym/monkey/object"
+)
+
+// assertions are the builtins that tests have besides the usual ones.
+// A failed assertion raises an AssertionError, which fails the test
+// unless it is caught.
+var assertions = map[string]*object.Builtin{
+	// assert(value, message) fails unless the value is truthy. The message
+	// is optional.
+	"assert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.TYPE_ERROR, "wrong number of arguments: want=1 or 2, got=%d", len(args))
+			}
+			msg, err := message("assert", args[1:], "assertion failed")
+			if err != nil {
+				return err
+			}
+			if args[0] == evaluator.NULL || args[0] == evaluator.FALSE {
+				return newError(object.ASSERTION_ERROR, "%s", msg)
+			}
+			return evaluator.NULL
+		},
+	},
+
+	// assert_eq(got, want, message) fails unless the values are equal,
+	// and shows how they differ as printed. The message is optional.
+	"assert_eq": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(object.TYPE_ERROR, "wrong number of arguments: want=2 or 3, got=%d", len(args))
+			}
+			msg, err := message("assert_eq", args[2:], "values are not equal")
+			if err != nil {
+				return err
+			}
+			if equal(args[0], args[1]) {
+				return evaluator.NULL
+			}
+			got, want := args[0].Inspect(), args[1].Inspect()
+			if got == want {
+				// Strings print without quotes, so "1" and 1 look the same.
+				return newError(object.ASSERTION_ERROR, "%s, though both print as %s", msg, got)
+			}
+			d := diff.Unified("want", "got", want+"\n", got+"\n")
+			return newError(object.ASSERTION_ERROR, "%s\n%s", msg, strings.TrimSuffix(d, "\n"))
+		},
+	},
+
+	// assert_error(fn, message) calls a function without arguments, and
+	// fails unless it raises an error whose message contains the given
+	// one, if any. It returns the error as a catch clause would bind it.
+	"assert_error": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.TYPE_ERROR, "wrong number of arguments: want=1 or 2, got=%d", len(args))
+			}
+			switch fn := args[0].(type) {
+			case *object.Builtin:
+			case *object.Function:
+				if len(fn.Parameters) != 0 {
+					return newError(object.TYPE_ERROR, "function passed to `assert_error` must take no arguments, got %d", len(fn.Parameters))
+				}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `assert_error` must be FUNCTION, got %s", args[0].Type())
+			}
+			want := ""
+			if len(args) == 2 {
+				str, ok := args[1].(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "message of `assert_error` must be STRING, got %s", args[1].Type())
+				}
+				want = str.Value
+			}
+
+			raised, ok := evaluator.Apply(args[0]).(*object.Error)
+			if !ok {
+				return newError(object.ASSERTION_ERROR, "no error was raised")
+			}
+			if !strings.Contains(raised.Message, want) {
+				return newError(object.ASSERTION_ERROR, "error %q does not contain %q", raised.Error(), want)
+			}
+			return &object.ErrorValue{Error: raised}
+		},
+	},
+}
+
+// equal reports whether two values are equal. Arrays, hashes and records
+// are equal if their contents are, and functions and modules only to
+// themselves.
+func equal(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	case *object.Boolean:
+		b, ok := b.(*object.Boolean)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Null:
+		_, ok := b.(*object.Null)
+		return ok
+	case *object.Array:
+		b, ok := b.(*object.Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i, elem := range a.Elements {
+			if !equal(elem, b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		b, ok := b.(*object.Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	case *object.Record:
+		b, ok := b.(*object.Record)
+		if !ok || a.Name != b.Name || len(a.Fields) != len(b.Fields) {
+			return false
+		}
+		for i, field := range a.Fields {
+			if field.Name != b.Fields[i].Name || !equal(field.Value, b.Fields[i].Value) {
+				return false
+			}
+		}
+		return true
+	case *object.ErrorValue:
+		b, ok := b.(*object.ErrorValue)
+		return ok && a.Error.Kind == b.Error.Kind && a.Error.Message == b.Error.Message
+	default:
+		return a == b
+	}
+}
+
+// message returns the optional message argument of an assertion, or the
+// default one.
+func message(name string, args []object.Object, def string) (string, *object.Error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError(object.TYPE_ERROR, "message of `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	return str.Value, nil
+}
+
+// AssertionNames returns the names of the assertion builtins in
+// alphabetical order.
+func AssertionNames() []string {
+	names := make([]string, 0, len(assertions))
+	for name := range assertions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
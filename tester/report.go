@@ -0,0 +1,267 @@
+package tester
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/object"
+)
+
+// Passed reports whether every test passed.
+func (r *Report) Passed() bool {
+	for _, result := range r.Results {
+		if !result.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) failures() int {
+	n := 0
+	for _, result := range r.Results {
+		if !result.Passed() {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) time() time.Duration {
+	var total time.Duration
+	for _, result := range r.Results {
+		total += result.Time
+	}
+	return total
+}
+
+// WriteText writes a line for each test, followed by what failed tests
+// printed and why they failed, and a summary.
+func (r *Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(bw, "%s %s", status, title(result))
+		if result.Name != "" {
+			fmt.Fprintf(bw, " (%s)", ms(result.Time))
+		}
+		bw.WriteString("\n")
+		if result.Passed() {
+			continue
+		}
+		for _, line := range append(lines(result.Output), describe(result.Err)...) {
+			fmt.Fprintf(bw, "\t%s\n", line)
+		}
+	}
+
+	switch n := r.failures(); {
+	case len(r.Results) == 0:
+		bw.WriteString("no tests to run\n")
+	case n == 0:
+		fmt.Fprintf(bw, "PASS: %s (%s)\n", tests(len(r.Results)), ms(r.time()))
+	default:
+		fmt.Fprintf(bw, "FAIL: %d of %s failed (%s)\n", n, tests(len(r.Results)), ms(r.time()))
+	}
+	return bw.Flush()
+}
+
+// WriteTAP writes the results in the Test Anything Protocol, version 13.
+// Failed tests have a YAML block with why they failed and what they
+// printed.
+func (r *Report) WriteTAP(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "TAP version 13\n1..%d\n", len(r.Results))
+	for i, result := range r.Results {
+		status := "ok"
+		if !result.Passed() {
+			status = "not ok"
+		}
+		// A # in the description would start a directive.
+		fmt.Fprintf(bw, "%s %d - %s", status, i+1, strings.ReplaceAll(title(result), "#", `\#`))
+		if result.Name != "" {
+			fmt.Fprintf(bw, " # time=%s", ms(result.Time))
+		}
+		bw.WriteString("\n")
+		if result.Passed() {
+			continue
+		}
+		bw.WriteString("  ---\n")
+		yamlBlock(bw, "message", describe(result.Err))
+		if result.Output != "" {
+			yamlBlock(bw, "output", lines(result.Output))
+		}
+		bw.WriteString("  ...\n")
+	}
+	return bw.Flush()
+}
+
+func yamlBlock(w io.Writer, key string, lines []string) {
+	fmt.Fprintf(w, "  %s: |-\n", key)
+	for _, line := range lines {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+	time     time.Duration
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit writes the results as the JUnit XML that CI servers read,
+// with a test suite for each file. Failed assertions are failures, and
+// other errors are errors.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	root := junitTestSuites{Tests: len(r.Results), Time: seconds(r.time())}
+	for _, result := range r.Results {
+		if n := len(root.Suites); n == 0 || root.Suites[n-1].Name != result.File {
+			root.Suites = append(root.Suites, junitTestSuite{Name: result.File})
+		}
+		suite := &root.Suites[len(root.Suites)-1]
+		suite.Tests++
+		suite.time += result.Time
+
+		c := junitTestCase{Name: result.Name, Classname: result.File, Time: seconds(result.Time)}
+		if c.Name == "" {
+			c.Name = result.File
+		}
+		if !result.Passed() {
+			problem := &junitProblem{Type: kind(result.Err), Text: strings.Join(describe(result.Err), "\n")}
+			problem.Message = strings.SplitN(problem.Text, "\n", 2)[0]
+			if result.Failed() {
+				c.Failure = problem
+				suite.Failures++
+				root.Failures++
+			} else {
+				c.Error = problem
+				suite.Errors++
+				root.Errors++
+			}
+		}
+		if result.Output != "" {
+			c.SystemOut = &junitOutput{Text: result.Output}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	for i := range root.Suites {
+		root.Suites[i].Time = seconds(root.Suites[i].time)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func title(r *Result) string {
+	if r.Name == "" {
+		return r.File
+	}
+	return r.File + ": " + r.Name
+}
+
+// describe returns the lines telling why a test failed.
+func describe(err error) []string {
+	switch err := err.(type) {
+	case *object.Error:
+		lines := strings.Split(err.Error(), "\n")
+		for _, frame := range err.Stack {
+			lines = append(lines, frame.String())
+		}
+		return lines
+	case *interp.ParseError:
+		return append([]string{"parse error"}, err.Errors...)
+	case *interp.ResolveError:
+		lines := []string{"resolve error"}
+		for _, d := range err.Diagnostics {
+			lines = append(lines, d.String())
+		}
+		return lines
+	default:
+		return strings.Split(err.Error(), "\n")
+	}
+}
+
+// kind returns the kind of an error, as JUnit has a type for failures.
+func kind(err error) string {
+	switch err := err.(type) {
+	case *object.Error:
+		return err.Kind
+	case *interp.ParseError:
+		return "ParseError"
+	case *interp.ResolveError:
+		return "ResolveError"
+	default:
+		return "Error"
+	}
+}
+
+// lines splits a text into lines, without an empty one at the end.
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// tests returns a count of tests, like `1 test` or `2 tests`.
+func tests(n int) string {
+	if n == 1 {
+		return "1 test"
+	}
+	return fmt.Sprintf("%d tests", n)
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
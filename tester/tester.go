@@ -0,0 +1,153 @@
+// Package tester runs the tests of Monkey scripts.
+//
+// Tests are written in files named *_test.mk, as the functions that
+// their top-level let statements bind to names starting with test_:
+//
+//	let test_add = fn() {
+//	  assert_eq(1 + 2, 3);
+//	};
+//
+// Each test runs in an interpreter of its own, which evaluates the file
+// afresh before calling the test function, so that tests do not see what
+// the others changed. A test fails when it raises an error, as the
+// assertion builtins do when what they check does not hold.
+package tester
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/parser"
+)
+
+const (
+	// Suffix ends the names of the files that hold tests.
+	Suffix = "_test" + evaluator.Extension
+	// Prefix starts the names of test functions.
+	Prefix = "test_"
+)
+
+// Find returns the names of the tests in a source, in the order they
+// are defined.
+func Find(src string) ([]string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &interp.ParseError{Errors: p.Errors()}
+	}
+	names := []string{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, Prefix) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names, nil
+}
+
+type Runner struct {
+	// SearchPath is where imported modules are searched, after the
+	// directory of the importing file.
+	SearchPath []string
+	// Filter selects the tests to run by name, if it is set.
+	Filter *regexp.Regexp
+
+	now func() time.Time
+}
+
+func New() *Runner {
+	return &Runner{now: time.Now}
+}
+
+// Report is the results of the tests that ran, in the order they ran.
+type Report struct {
+	Results []*Result
+}
+
+// Result is the outcome of a test. A file whose tests could not be
+// found has a result of its own, without a name.
+type Result struct {
+	File   string
+	Name   string
+	Time   time.Duration
+	Output string // What the test printed
+	Err    error  // Why the test failed, or nil if it passed
+}
+
+func (r *Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Failed reports whether the test failed an assertion, as opposed to
+// raising another error.
+func (r *Result) Failed() bool {
+	err, ok := r.Err.(*object.Error)
+	return ok && err.Kind == object.ASSERTION_ERROR
+}
+
+// Run runs the tests of the files, one file after another. What the
+// tests print is kept in their results instead of written to
+// evaluator.Stdout.
+func (r *Runner) Run(files ...string) *Report {
+	stdout := evaluator.Stdout
+	defer func() { evaluator.Stdout = stdout }()
+
+	report := &Report{Results: []*Result{}}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		var names []string
+		if err == nil {
+			names, err = Find(string(src))
+		}
+		if err != nil {
+			report.Results = append(report.Results, &Result{File: file, Err: err})
+			continue
+		}
+		for _, name := range names {
+			if r.Filter == nil || r.Filter.MatchString(name) {
+				report.Results = append(report.Results, r.run(file, name))
+			}
+		}
+	}
+	return report
+}
+
+func (r *Runner) run(file, name string) *Result {
+	result := &Result{File: file, Name: name}
+	var out bytes.Buffer
+	evaluator.Stdout = &out
+	defer func() { result.Output = out.String() }()
+
+	in := interp.New()
+	in.SetSearchPath(r.SearchPath...)
+	for assertion, builtin := range assertions {
+		if err := in.SetGlobal(assertion, builtin); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+	if _, err := in.EvalFile(file); err != nil {
+		result.Err = err
+		return result
+	}
+
+	fn, _ := in.Global(name)
+	start := r.now()
+	value := evaluator.Apply(fn)
+	result.Time = r.now().Sub(start)
+	if err, ok := value.(*object.Error); ok {
+		result.Err = err
+	}
+	return result
+}
@@ -0,0 +1,298 @@
+package tester
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryym/monkey/internal/scripttest"
+	"github.com/ryym/monkey/interp"
+	"github.com/ryym/monkey/object"
+)
+
+const mathTest = `let add = fn(a, b) { a + b };
+
+let test_add = fn() {
+  assert_eq(add(1, 2), 3);
+};
+
+let test_sum = fn() {
+  puts("summing");
+  assert_eq([add(1, -1), 2], [0, 3], "wrong sums");
+};
+
+let test_division = fn() {
+  let e = assert_error(fn() { 1 / 0 }, "by zero");
+  assert(e.kind == "ValueError");
+};
+
+let test_throw = fn() {
+  throw "boom";
+};
+`
+
+// runTests runs the tests of the test files among the given ones, in
+// the order of their names, with a clock that advances by a millisecond
+// each time it is read. It returns the report and the directory of the
+// files.
+func runTests(t *testing.T, filter string, sources map[string]string) (*Report, string) {
+	t.Helper()
+	dir, files := scripttest.WriteFiles(t, sources)
+
+	r := New()
+	clock := time.Unix(0, 0)
+	r.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	if filter != "" {
+		r.Filter = regexp.MustCompile(filter)
+	}
+	paths := []string{}
+	for _, file := range files {
+		if strings.HasSuffix(file, Suffix) {
+			paths = append(paths, file)
+		}
+	}
+	return r.Run(paths...), dir
+}
+
+func TestFind(t *testing.T) {
+	names, err := Find(`let test_a = fn() { let test_nested = fn() {}; };
+let helper = fn() {};
+let test_value = 1;
+let test_b = fn(x) {};
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, " "); got != "test_a test_b" {
+		t.Errorf("wrong tests. want=%q, got=%q", "test_a test_b", got)
+	}
+
+	if _, err := Find("let = 1;"); err == nil {
+		t.Errorf("no error for a source that does not parse")
+	} else if _, ok := err.(*interp.ParseError); !ok {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string // The error of the test, or empty if it passes
+	}{
+		{`assert(true); assert(1); assert([])`, ""},
+		{`assert(false)`, "AssertionError: assertion failed"},
+		{`assert(if (false) { 1 }, "nothing")`, "AssertionError: nothing"},
+		{`assert(true, 1)`, "TypeError: message of `assert` must be STRING, got INTEGER"},
+		{`assert()`, "TypeError: wrong number of arguments: want=1 or 2, got=0"},
+		{`assert_eq({"a": [1, "x"]}, {"a": [1, "x"]})`, ""},
+		{`assert_eq(1, 2)`, "AssertionError: values are not equal\n--- want\n+++ got\n@@ -1 +1 @@\n-2\n+1"},
+		{`assert_eq(["1"], [1])`, "AssertionError: values are not equal, though both print as [1]"},
+		{`assert_eq({1: 2, 3: 4}, {3: 4, 1: 2})`, ""},
+		{`assert_eq({"a": 1}, {"b": 1})`, "AssertionError: values are not equal\n--- want\n+++ got\n@@ -1 +1 @@\n-{b: 1}\n+{a: 1}"},
+		{`assert_eq(1, 1, "same", 1)`, "TypeError: wrong number of arguments: want=2 or 3, got=4"},
+		{`let e = assert_error(fn() { throw "boom" }); assert_eq(e.message, "boom")`, ""},
+		{`assert_error(puts)`, "AssertionError: no error was raised"},
+		{`assert_error(fn() { 1 })`, "AssertionError: no error was raised"},
+		{`assert_error(fn() { 1 / 0 }, "null")`, `AssertionError: error "ValueError: division by zero" does not contain "null"`},
+		{`assert_error(fn(x) { x })`, "TypeError: function passed to `assert_error` must take no arguments, got 1"},
+		{`assert_error(1)`, "TypeError: argument to `assert_error` must be FUNCTION, got INTEGER"},
+		{`try { assert(false) } catch (e) { 1 }`, ""},
+	}
+
+	for _, tt := range tests {
+		report, _ := runTests(t, "", map[string]string{
+			"a_test.mk": "let test_it = fn() { " + tt.src + " };\n",
+		})
+		if len(report.Results) != 1 {
+			t.Fatalf("%s: wrong number of results. got=%d", tt.src, len(report.Results))
+		}
+		result := report.Results[0]
+		got := ""
+		if result.Err != nil {
+			got = result.Err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: wrong error.\nwant:\n%s\ngot:\n%s", tt.src, tt.expected, got)
+		}
+		if result.Failed() != strings.HasPrefix(tt.expected, object.ASSERTION_ERROR) {
+			t.Errorf("%s: wrong Failed(). got=%t", tt.src, result.Failed())
+		}
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	report, _ := runTests(t, "", map[string]string{
+		"a_test.mk": `import "counter";
+puts("loading");
+let test_first = fn() { counter.next() };
+let test_second = fn() { assert_eq(counter.next(), 1) };
+`,
+		"counter.mk": `let count = [0];
+let next = fn() { let n = count[0] + 1; puts(n); n };
+`,
+	})
+	for _, result := range report.Results {
+		if result.Err != nil {
+			t.Errorf("%s failed: %s", result.Name, result.Err)
+		}
+		if result.Output != "loading\n1\n" {
+			t.Errorf("wrong output of %s. got=%q", result.Name, result.Output)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	report, _ := runTests(t, "^test_(add|sum)$", map[string]string{"math_test.mk": mathTest})
+	names := []string{}
+	for _, result := range report.Results {
+		names = append(names, result.Name)
+	}
+	if got := strings.Join(names, " "); got != "test_add test_sum" {
+		t.Errorf("wrong tests run. want=%q, got=%q", "test_add test_sum", got)
+	}
+}
+
+// testReport runs the tests of math_test.mk and of a file that does not
+// parse, and returns the report written by write without the directory.
+func testReport(t *testing.T, write func(*Report, *bytes.Buffer) error) string {
+	t.Helper()
+	report, dir := runTests(t, "", map[string]string{
+		"math_test.mk":   mathTest,
+		"broken_test.mk": "let = 1;\n",
+	})
+	var out bytes.Buffer
+	if err := write(report, &out); err != nil {
+		t.Fatal(err)
+	}
+	return strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+}
+
+func TestText(t *testing.T) {
+	got := testReport(t, func(r *Report, out *bytes.Buffer) error { return r.WriteText(out) })
+	expected := `FAIL broken_test.mk
+	parse error
+	expected next token to be IDENT, got = instead
+	no prefix parse function for = found
+PASS math_test.mk: test_add (1.00ms)
+FAIL math_test.mk: test_sum (1.00ms)
+	summing
+	AssertionError: wrong sums
+	--- want
+	+++ got
+	@@ -1 +1 @@
+	-[0, 3]
+	+[0, 2]
+	at test_sum (math_test.mk:9:12)
+PASS math_test.mk: test_division (1.00ms)
+FAIL math_test.mk: test_throw (1.00ms)
+	Error: boom
+	at test_throw (math_test.mk:18:3)
+FAIL: 3 of 5 tests failed (4.00ms)
+`
+	if got != expected {
+		t.Errorf("wrong text.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestTextSummary(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{"^test_add$", "PASS: 1 test (1.00ms)\n"},
+		{"^test_(add|division)$", "PASS: 2 tests (2.00ms)\n"},
+		{"^test_sum$", "FAIL: 1 of 1 test failed (1.00ms)\n"},
+		{"^test_none$", "no tests to run\n"},
+	}
+	for _, tt := range tests {
+		report, _ := runTests(t, tt.filter, map[string]string{"math_test.mk": mathTest})
+		var out bytes.Buffer
+		if err := report.WriteText(&out); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); !strings.HasSuffix(got, "\n"+tt.expected) && got != tt.expected {
+			t.Errorf("%s: wrong summary. want=%q, got=%q", tt.filter, tt.expected, got)
+		}
+	}
+}
+
+func TestTAP(t *testing.T) {
+	got := testReport(t, func(r *Report, out *bytes.Buffer) error { return r.WriteTAP(out) })
+	expected := `TAP version 13
+1..5
+not ok 1 - broken_test.mk
+  ---
+  message: |-
+    parse error
+    expected next token to be IDENT, got = instead
+    no prefix parse function for = found
+  ...
+ok 2 - math_test.mk: test_add # time=1.00ms
+not ok 3 - math_test.mk: test_sum # time=1.00ms
+  ---
+  message: |-
+    AssertionError: wrong sums
+    --- want
+    +++ got
+    @@ -1 +1 @@
+    -[0, 3]
+    +[0, 2]
+    at test_sum (math_test.mk:9:12)
+  output: |-
+    summing
+  ...
+ok 4 - math_test.mk: test_division # time=1.00ms
+not ok 5 - math_test.mk: test_throw # time=1.00ms
+  ---
+  message: |-
+    Error: boom
+    at test_throw (math_test.mk:18:3)
+  ...
+`
+	if got != expected {
+		t.Errorf("wrong TAP.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	got := testReport(t, func(r *Report, out *bytes.Buffer) error { return r.WriteJUnit(out) })
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="5" failures="1" errors="2" time="0.004">
+  <testsuite name="broken_test.mk" tests="1" failures="0" errors="1" time="0.000">
+    <testcase name="broken_test.mk" classname="broken_test.mk" time="0.000">
+      <error message="parse error" type="ParseError"><![CDATA[parse error
+expected next token to be IDENT, got = instead
+no prefix parse function for = found]]></error>
+    </testcase>
+  </testsuite>
+  <testsuite name="math_test.mk" tests="4" failures="1" errors="1" time="0.004">
+    <testcase name="test_add" classname="math_test.mk" time="0.001"></testcase>
+    <testcase name="test_sum" classname="math_test.mk" time="0.001">
+      <failure message="AssertionError: wrong sums" type="AssertionError"><![CDATA[AssertionError: wrong sums
+--- want
++++ got
+@@ -1 +1 @@
+-[0, 3]
++[0, 2]
+at test_sum (math_test.mk:9:12)]]></failure>
+      <system-out><![CDATA[summing
+]]></system-out>
+    </testcase>
+    <testcase name="test_division" classname="math_test.mk" time="0.001"></testcase>
+    <testcase name="test_throw" classname="math_test.mk" time="0.001">
+      <error message="Error: boom" type="Error"><![CDATA[Error: boom
+at test_throw (math_test.mk:18:3)]]></error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if got != expected {
+		t.Errorf("wrong JUnit XML.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
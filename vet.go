@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+	"github.com/ryym/monkey/tester"
+	"github.com/ryym/monkey/vet"
+)
+
+// vetFiles checks the given files, and the Monkey files found in the given
+// directories, or the standard input. It fails if anything is reported.
+//
+// As in go vet, each rule has a flag: setting some of them to true runs
+// only those, and setting some to false runs all but those. The options
+// of a rule are flags prefixed by its name, like -unused.params=false.
+func (c *cli) vetFiles(args []string) int {
+	flags := flag.NewFlagSet("vet", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		io.WriteString(c.stderr, "usage: monkey vet [-json] [-rule...] [path...]\n")
+		flags.PrintDefaults()
+	}
+	asJSON := flags.Bool("json", false, "print the diagnostics as JSON")
+	enabled := make(map[string]*bool)
+	options := make(map[string]*bool)
+	for _, rule := range vet.Rules {
+		enabled[rule.Name] = flags.Bool(rule.Name, false, rule.Doc)
+		for _, opt := range rule.Options {
+			name := rule.Name + "." + opt.Name
+			options[name] = flags.Bool(name, opt.Default, opt.Doc)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	config := &vet.Config{Rules: []*vet.Rule{}, Options: make(map[string]bool), Globals: []string{"args"}}
+	set := make(map[string]bool)
+	onlySome := false
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if p, ok := enabled[f.Name]; ok && *p {
+			onlySome = true
+		}
+	})
+	for _, rule := range vet.Rules {
+		if on := *enabled[rule.Name]; on || !onlySome && !set[rule.Name] {
+			config.Rules = append(config.Rules, rule)
+		}
+	}
+	for name, value := range options {
+		config.Options[name] = *value
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	code := exitOK
+	results := []vetResult{}
+	for _, path := range paths {
+		err := walkScripts(path, func(file string) {
+			result, ok := c.vetFile(file, config)
+			if !ok {
+				code = exitError
+			}
+			results = append(results, result...)
+		})
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey vet: %s\n", err)
+			code = exitError
+		}
+	}
+	if len(results) > 0 {
+		code = exitError
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Fprintf(c.stdout, "%s\n", data)
+		return code
+	}
+	for _, r := range results {
+		fmt.Fprintf(c.stdout, "%s:%d:%d: %s (%s)\n", r.File, r.Line, r.Column, r.Message, r.Rule)
+	}
+	return code
+}
+
+// vetResult is a diagnostic of a file, as printed in JSON.
+type vetResult struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// vetFile checks a file, or the standard input if the path is empty.
+// It reports whether the file could be read and parsed.
+func (c *cli) vetFile(path string, config *vet.Config) ([]vetResult, bool) {
+	name, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey vet: %s\n", err)
+		return nil, false
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		fmt.Fprintf(c.stderr, "%s: parse error\n", name)
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(c.stderr, "\t%s\n", msg)
+		}
+		return nil, false
+	}
+
+	if strings.HasSuffix(name, tester.Suffix) {
+		// Tests have the assertion builtins too.
+		testConfig := *config
+		testConfig.Globals = append(append([]string{}, config.Globals...), tester.AssertionNames()...)
+		config = &testConfig
+	}
+	results := []vetResult{}
+	for _, d := range config.Check(program) {
+		results = append(results, vetResult{name, d.Pos.Line, d.Pos.Column, d.Rule, d.Message})
+	}
+	return results, true
+}
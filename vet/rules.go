@@ -0,0 +1,227 @@
+package vet
+
+import (
+	"strings"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/object"
+	"github.com/ryym/monkey/resolver"
+)
+
+// Unused does not report top-level bindings, which other modules or later
+// evaluations may use, nor names starting with an underscore.
+var Unused = &Rule{
+	Name: "unused",
+	Doc:  "report let bindings and parameters of functions that are never used",
+	Options: []Option{
+		{Name: "params", Doc: "report unused parameters", Default: true},
+	},
+	Run: runUnused,
+}
+
+func runUnused(pass *Pass) {
+	used := make(map[*resolver.Symbol]bool)
+	for _, sym := range pass.Info.Uses {
+		used[sym] = true
+	}
+
+	reported := make(map[*resolver.Symbol]bool)
+	for _, sym := range pass.Info.Defs {
+		if sym.Scope != ast.LocalScope || used[sym] || reported[sym] || strings.HasPrefix(sym.Name, "_") {
+			continue
+		}
+		switch {
+		case sym.Kind == resolver.LetKind:
+			pass.Reportf(sym.Pos, "%s is bound but never used", sym.Name)
+		case sym.Kind == resolver.ParamKind && pass.Option("params"):
+			pass.Reportf(sym.Pos, "parameter %s is never used", sym.Name)
+		}
+		reported[sym] = true
+	}
+}
+
+var Shadow = &Rule{
+	Name: "shadow",
+	Doc:  "report names bound in functions that hide a binding of an enclosing scope",
+	Options: []Option{
+		{Name: "builtins", Doc: "report names that hide builtin functions", Default: false},
+	},
+	Run: runShadow,
+}
+
+func runShadow(pass *Pass) {
+	for id, sym := range pass.Info.Defs {
+		outer := sym.Shadows
+		if outer == nil || id.Pos() != sym.Pos {
+			continue
+		}
+		switch outer.Kind {
+		case resolver.BuiltinKind:
+			if pass.Option("builtins") {
+				pass.Reportf(sym.Pos, "%s shadows the builtin function", sym.Name)
+			}
+		case resolver.GlobalKind:
+			pass.Reportf(sym.Pos, "%s shadows the global defined by the host", sym.Name)
+		default:
+			pass.Reportf(sym.Pos, "%s shadows the %s bound at %s", sym.Name, outer.Kind, outer.Pos)
+		}
+	}
+}
+
+var Unreachable = &Rule{
+	Name: "unreachable",
+	Doc:  "report statements after a return or a throw, which never run",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(node ast.Node) bool {
+			var stmts []ast.Statement
+			switch node := node.(type) {
+			case *ast.Program:
+				stmts = node.Statements
+			case *ast.BlockStatement:
+				stmts = node.Statements
+			}
+			for i := 0; i+1 < len(stmts); i++ {
+				switch stmts[i].(type) {
+				case *ast.ReturnStatement, *ast.ThrowStatement:
+					pass.Reportf(stmts[i+1].Pos(), "unreachable code")
+					return true
+				}
+			}
+			return true
+		})
+	},
+}
+
+var SelfCompare = &Rule{
+	Name: "selfcompare",
+	Doc:  "report comparisons of an expression with itself, whose result is known",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(node ast.Node) bool {
+			infix, ok := node.(*ast.InfixExpression)
+			if !ok || !isPure(infix.Left) || !ast.Equal(infix.Left, infix.Right) {
+				return true
+			}
+			switch infix.Operator {
+			case "==":
+				pass.Reportf(infix.Pos(), "comparison of %s with itself is always true", infix.Left)
+			case "!=":
+				pass.Reportf(infix.Pos(), "comparison of %s with itself is always false", infix.Left)
+			case "<", ">":
+				// Only integers are ordered, and other values raise a TypeError.
+				if isInteger(infix.Left) {
+					pass.Reportf(infix.Pos(), "comparison of %s with itself is always false", infix.Left)
+				} else {
+					pass.Reportf(infix.Pos(), "comparison of %s with itself is always false or an error", infix.Left)
+				}
+			}
+			return true
+		})
+	},
+}
+
+// isInteger reports whether an expression gives an integer if it gives
+// a value at all: minus, and arithmetic other than +, which also joins
+// strings, raise an error for anything else.
+func isInteger(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return exp.Operator == "-"
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "-", "*", "/":
+			return true
+		case "+":
+			return isInteger(exp.Left) || isInteger(exp.Right)
+		}
+	}
+	return false
+}
+
+// isPure reports whether an expression gives the same value each time it
+// is evaluated. Calls may not, and literals of arrays, hashes and
+// functions make new objects, which are never equal.
+func isPure(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		return isPure(exp.Right)
+	case *ast.InfixExpression:
+		return isPure(exp.Left) && isPure(exp.Right)
+	case *ast.MemberExpression:
+		return isPure(exp.Object)
+	case *ast.IndexExpression:
+		return isPure(exp.Left) && isPure(exp.Index)
+	}
+	return false
+}
+
+var ConstCond = &Rule{
+	Name: "constcond",
+	Doc:  "report if expressions whose condition does not depend on anything",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(node ast.Node) bool {
+			ifExp, ok := node.(*ast.IfExpression)
+			if !ok || !isConstant(ifExp.Condition) {
+				return true
+			}
+			// Constants have no names to look up, so any environment does.
+			switch cond := evaluator.Eval(ifExp.Condition, object.NewEnvironment()); cond {
+			case evaluator.FALSE, evaluator.NULL:
+				pass.Reportf(ifExp.Condition.Pos(), "if condition %s is always false", ifExp.Condition)
+			default:
+				if _, failed := cond.(*object.Error); !failed {
+					pass.Reportf(ifExp.Condition.Pos(), "if condition %s is always true", ifExp.Condition)
+				}
+			}
+			return true
+		})
+	},
+}
+
+// isConstant reports whether an expression is made of literals and
+// operators only.
+func isConstant(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		return isConstant(exp.Right)
+	case *ast.InfixExpression:
+		return isConstant(exp.Left) && isConstant(exp.Right)
+	}
+	return false
+}
+
+var CallNonFunc = &Rule{
+	Name: "callnonfunc",
+	Doc:  "report calls of literals that are not functions, such as 5()",
+	Run: func(pass *Pass) {
+		ast.Inspect(pass.Program, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+			var kind string
+			switch call.Function.(type) {
+			case *ast.IntegerLiteral:
+				kind = "an integer"
+			case *ast.StringLiteral:
+				kind = "a string"
+			case *ast.Boolean:
+				kind = "a boolean"
+			case *ast.ArrayLiteral:
+				kind = "an array"
+			case *ast.HashLiteral:
+				kind = "a hash"
+			default:
+				return true
+			}
+			pass.Reportf(call.Function.Pos(), "cannot call %s, which is not a function", kind)
+			return true
+		})
+	},
+}
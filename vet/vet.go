@@ -0,0 +1,134 @@
+// Package vet reports suspicious constructs in Monkey programs, such as
+// unused variables or code that can never run.
+//
+// Each check is a Rule. The rules of this package are listed in Rules,
+// and other rules can be written against the same Pass API and run
+// along with them. A Config selects the rules to run and sets their
+// options.
+package vet
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/evaluator"
+	"github.com/ryym/monkey/resolver"
+	tk "github.com/ryym/monkey/token"
+)
+
+// Diagnostic is a problem reported by a rule.
+type Diagnostic struct {
+	Pos     tk.Position
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Rule checks programs for one kind of mistake.
+type Rule struct {
+	Name    string
+	Doc     string
+	Options []Option
+	Run     func(pass *Pass)
+}
+
+// Option is a setting of a rule, named like "unused.params" in configs.
+type Option struct {
+	Name    string
+	Doc     string
+	Default bool
+}
+
+// Rules are the rules of this package, run by default.
+var Rules = []*Rule{
+	Unused,
+	Shadow,
+	Unreachable,
+	SelfCompare,
+	ConstCond,
+	CallNonFunc,
+}
+
+// Lookup finds a rule of this package by name.
+func Lookup(name string) (*Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// ResolveRule is the rule of the diagnostics from the resolver, which
+// are always reported.
+const ResolveRule = "resolve"
+
+// Config tells how to check programs.
+type Config struct {
+	Rules   []*Rule         // The rules to run, or all of Rules if nil
+	Options map[string]bool // Settings by "rule.option", defaults if missing
+	Globals []string        // Names that the host program defines
+}
+
+// Pass is the program being checked, given to a rule.
+type Pass struct {
+	Program *ast.Program
+	Info    *resolver.Info
+
+	rule        *Rule
+	config      *Config
+	diagnostics *[]Diagnostic
+}
+
+// Reportf reports a problem found by the rule.
+func (p *Pass) Reportf(pos tk.Position, format string, a ...interface{}) {
+	*p.diagnostics = append(*p.diagnostics, Diagnostic{Pos: pos, Rule: p.rule.Name, Message: fmt.Sprintf(format, a...)})
+}
+
+// Option returns the setting of an option of the rule.
+func (p *Pass) Option(name string) bool {
+	if value, ok := p.config.Options[p.rule.Name+"."+name]; ok {
+		return value
+	}
+	for _, opt := range p.rule.Options {
+		if opt.Name == name {
+			return opt.Default
+		}
+	}
+	panic(fmt.Sprintf("vet: rule %s has no option %s", p.rule.Name, name))
+}
+
+// Check resolves a program and runs the rules over it. The diagnostics
+// are sorted by position.
+func (c *Config) Check(program *ast.Program) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	info := resolver.NewInfo()
+	globals := resolver.NewGlobalTable(c.Globals, evaluator.BuiltinNames())
+	for _, d := range resolver.ResolveInfo(program, globals, info) {
+		diagnostics = append(diagnostics, Diagnostic{Pos: d.Pos, Rule: ResolveRule, Message: d.Message})
+	}
+
+	rules := c.Rules
+	if rules == nil {
+		rules = Rules
+	}
+	for _, rule := range rules {
+		pass := &Pass{Program: program, Info: info, rule: rule, config: c, diagnostics: &diagnostics}
+		rule.Run(pass)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Pos.Before(diagnostics[j].Pos)
+	})
+	return diagnostics
+}
+
+// Check checks a program with the default config.
+func Check(program *ast.Program) []Diagnostic {
+	return (&Config{}).Check(program)
+}
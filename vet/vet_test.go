@@ -0,0 +1,171 @@
+package vet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ryym/monkey/ast"
+	"github.com/ryym/monkey/lexer"
+	"github.com/ryym/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%q: parse errors: %v", input, p.Errors())
+	}
+	return program
+}
+
+// check runs a rule over the input and returns its diagnostics as strings.
+func check(t *testing.T, rule *Rule, input string, options map[string]bool) []string {
+	t.Helper()
+	config := &Config{Rules: []*Rule{rule}, Options: options}
+	got := []string{}
+	for _, d := range config.Check(parse(t, input)) {
+		got = append(got, d.String())
+	}
+	return got
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     *Rule
+		input    string
+		expected []string
+	}{
+		{Unused, `fn(a, b) { let c = 1; let d = 2; a + d }`, []string{
+			"1:7: parameter b is never used (unused)",
+			"1:16: c is bound but never used (unused)",
+		}},
+		{Unused, `let top = 1; fn(_a) { let _b = 1; 0 }`, nil},
+		{Unused, `fn() { let f = fn(n) { f(n) }; if (true) { let c = 0 } else { let c = 1 }; 0 }`, []string{
+			"1:48: c is bound but never used (unused)",
+		}},
+		{Unused, `fn(x) { fn() { x } }`, nil},
+
+		{Shadow, `let x = 1; fn(x) { let puts = 2; fn() { let x = 3; x + puts } }`, []string{
+			"1:15: x shadows the let bound at 1:5 (shadow)",
+			"1:45: x shadows the parameter bound at 1:15 (shadow)",
+		}},
+		{Shadow, `fn(a) { fn(b) { a + b } }`, nil},
+
+		{Unreachable, `fn() { return 1; 2; 3 }; if (true) { throw "x"; puts(1) } else { 1 }`, []string{
+			"1:18: unreachable code (unreachable)",
+			"1:49: unreachable code (unreachable)",
+		}},
+		{Unreachable, `fn() { if (true) { return 1 }; 2 }`, nil},
+
+		{SelfCompare, `let a = 1; let h = {}; a == a; h["k"] != h["k"]; -a < -a; a == -a; a + a`, []string{
+			"1:26: comparison of a with itself is always true (selfcompare)",
+			"1:39: comparison of (h[\"k\"]) with itself is always false (selfcompare)",
+			"1:53: comparison of (-a) with itself is always false (selfcompare)",
+		}},
+		{SelfCompare, `let f = fn() { 1 }; f() == f(); [1] == [1]; fn() {} == fn() {}`, nil},
+		{SelfCompare, `let a = 1; let h = {}; "a" < "a"; a > a; h < h; a * 2 > a * 2; 1 + a < 1 + a; a + "" < a + ""`, []string{
+			"1:28: comparison of \"a\" with itself is always false or an error (selfcompare)",
+			"1:37: comparison of a with itself is always false or an error (selfcompare)",
+			"1:44: comparison of h with itself is always false or an error (selfcompare)",
+			"1:55: comparison of (a * 2) with itself is always false (selfcompare)",
+			"1:70: comparison of (1 + a) with itself is always false (selfcompare)",
+			"1:86: comparison of (a + \"\") with itself is always false or an error (selfcompare)",
+		}},
+
+		{ConstCond, `if (true) { 1 }; if (1 > 2) { 1 }; if ("s") { 1 }; if (!0) { 1 }`, []string{
+			"1:5: if condition true is always true (constcond)",
+			"1:24: if condition (1 > 2) is always false (constcond)",
+			"1:40: if condition \"s\" is always true (constcond)",
+			"1:56: if condition (!0) is always false (constcond)",
+		}},
+		{ConstCond, `let x = true; if (x) { 1 }; if (1 / 0) { 1 }; if ("a" < "b") { 1 }`, nil},
+
+		{CallNonFunc, `5(); "s"(1); true(); [1](); {}(); fn() { 1 }(); puts(1)`, []string{
+			"1:1: cannot call an integer, which is not a function (callnonfunc)",
+			"1:6: cannot call a string, which is not a function (callnonfunc)",
+			"1:14: cannot call a boolean, which is not a function (callnonfunc)",
+			"1:22: cannot call an array, which is not a function (callnonfunc)",
+			"1:29: cannot call a hash, which is not a function (callnonfunc)",
+		}},
+	}
+
+	for _, tt := range tests {
+		got := check(t, tt.rule, tt.input, nil)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: %q: wrong diagnostics.\nwant=%q\ngot= %q", tt.rule.Name, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	got := check(t, Unused, `fn(a) { 0 }`, map[string]bool{"unused.params": false})
+	if len(got) != 0 {
+		t.Errorf("unused parameter reported with unused.params=false. got=%q", got)
+	}
+
+	input := `fn() { let puts = 1; puts }`
+	if got := check(t, Shadow, input, nil); len(got) != 0 {
+		t.Errorf("shadowed builtin reported by default. got=%q", got)
+	}
+	got = check(t, Shadow, input, map[string]bool{"shadow.builtins": true})
+	if want := "1:12: puts shadows the builtin function (shadow)"; len(got) != 1 || got[0] != want {
+		t.Errorf("wrong diagnostics with shadow.builtins=true. want=%q, got=%q", want, got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	input := "let f = fn(x) {\n  return 1;\n  nope\n};\n5()"
+	got := []string{}
+	for _, d := range Check(parse(t, input)) {
+		got = append(got, d.String())
+	}
+	expected := []string{
+		"1:12: parameter x is never used (unused)",
+		"3:3: undefined: nope (resolve)",
+		"3:3: unreachable code (unreachable)",
+		"5:1: cannot call an integer, which is not a function (callnonfunc)",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong diagnostics.\nwant=%q\ngot= %q", expected, got)
+	}
+
+	config := &Config{Rules: []*Rule{}, Globals: []string{"nope"}}
+	if got := config.Check(parse(t, input)); len(got) != 0 {
+		t.Errorf("diagnostics without rules. got=%v", got)
+	}
+}
+
+func TestCustomRule(t *testing.T) {
+	noPuts := &Rule{
+		Name: "noputs",
+		Doc:  "report calls of puts",
+		Run: func(pass *Pass) {
+			for id, sym := range pass.Info.Uses {
+				if sym.Name == "puts" {
+					pass.Reportf(id.Pos(), "puts left in the code")
+				}
+			}
+		},
+	}
+
+	config := &Config{Rules: append([]*Rule{noPuts}, Rules...)}
+	got := []string{}
+	for _, d := range config.Check(parse(t, `let a = 1; puts(a)`)) {
+		got = append(got, d.String())
+	}
+	if want := []string{"1:12: puts left in the code (noputs)"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong diagnostics.\nwant=%q\ngot= %q", want, got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, rule := range Rules {
+		if found, ok := Lookup(rule.Name); !ok || found != rule {
+			t.Errorf("%s not found", rule.Name)
+		}
+	}
+	if _, ok := Lookup("nope"); ok {
+		t.Errorf("unknown rule found")
+	}
+}